@@ -0,0 +1,183 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+)
+
+// CompressorID represents OP_COMPRESSED compressor ID.
+type CompressorID uint8
+
+const (
+	CompressorNoop   = CompressorID(0) // noop
+	CompressorSnappy = CompressorID(1) // snappy
+	CompressorZlib   = CompressorID(2) // zlib
+	CompressorZstd   = CompressorID(3) // zstd
+)
+
+// DefaultCompressionLevel selects the default compression level of the compressor.
+const DefaultCompressionLevel = -1
+
+// zstdDecoder is shared by all zstd decompressions; DecodeAll is safe for concurrent use.
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+	return zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(MaxMsgLen))
+})
+
+// zstdEncoders caches zstd encoders by compression level; EncodeAll is safe for concurrent use.
+var zstdEncoders sync.Map
+
+// zstdEncoder returns a cached zstd encoder for the given level.
+func zstdEncoder(level int) (*zstd.Encoder, error) {
+	if e, ok := zstdEncoders.Load(level); ok {
+		return e.(*zstd.Encoder), nil
+	}
+
+	l := zstd.SpeedDefault
+	if level != DefaultCompressionLevel {
+		l = zstd.EncoderLevelFromZstd(level)
+	}
+
+	e, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(l), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	actual, _ := zstdEncoders.LoadOrStore(level, e)
+
+	return actual.(*zstd.Encoder), nil
+}
+
+// compress compresses b with the given compressor and level.
+func compress(compressor CompressorID, level int, b []byte) ([]byte, error) {
+	switch compressor {
+	case CompressorNoop:
+		return bytes.Clone(b), nil
+
+	case CompressorSnappy:
+		return snappy.Encode(nil, b), nil
+
+	case CompressorZlib:
+		var buf bytes.Buffer
+
+		w, err := zlib.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		if _, err = w.Write(b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		if err = w.Close(); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		return buf.Bytes(), nil
+
+	case CompressorZstd:
+		e, err := zstdEncoder(level)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		return e.EncodeAll(b, nil), nil
+
+	default:
+		return nil, lazyerrors.Errorf("unsupported compressor %s", compressor)
+	}
+}
+
+// decompress decompresses b with the given compressor.
+// It returns an error if the decompressed size is not equal to the given size.
+func decompress(compressor CompressorID, size int, b []byte) ([]byte, error) {
+	if size < 0 || size > MaxMsgLen {
+		return nil, lazyerrors.Errorf("invalid uncompressed size %d", size)
+	}
+
+	var res []byte
+
+	switch compressor {
+	case CompressorNoop:
+		res = b
+
+	case CompressorSnappy:
+		l, err := snappy.DecodedLen(b)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		if l != size {
+			return nil, lazyerrors.Errorf("expected uncompressed size %d, got %d", size, l)
+		}
+
+		if res, err = snappy.Decode(nil, b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+	case CompressorZlib:
+		r, err := zlib.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		// read one more byte to detect too long output
+		res = make([]byte, 0, size)
+		buf := bytes.NewBuffer(res)
+
+		if _, err = io.Copy(buf, io.LimitReader(r, int64(size)+1)); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		if err = r.Close(); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		res = buf.Bytes()
+
+	case CompressorZstd:
+		d, err := zstdDecoder()
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		if res, err = d.DecodeAll(b, make([]byte, 0, size)); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+	default:
+		return nil, lazyerrors.Errorf("unsupported compressor %s", compressor)
+	}
+
+	if len(res) != size {
+		return nil, lazyerrors.Errorf("expected uncompressed size %d, got %d", size, len(res))
+	}
+
+	return res, nil
+}
+
+// check interfaces
+var (
+	_ fmt.Stringer = CompressorID(0)
+)
@@ -0,0 +1,43 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bsondiff provides unified diffs of BSON values for both tests and production code.
+package bsondiff
+
+import (
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// Unified returns the unified diff between two readable forms of values.
+func Unified(expectedS, actualS string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(expectedS),
+		FromFile: "expected",
+		B:        difflib.SplitLines(actualS),
+		ToFile:   "actual",
+		Context:  1,
+	})
+}
+
+// Diff returns the unified diff between readable forms of two BSON values.
+// It returns an empty string if values are equal according to [wirebson.Equal].
+func Diff(expected, actual any) (string, error) {
+	if wirebson.Equal(expected, actual) {
+		return "", nil
+	}
+
+	return Unified(wirebson.LogMessageIndent(expected), wirebson.LogMessageIndent(actual))
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bsondiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire/wirebson"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	d, err := Diff(wirebson.MustDocument("a", int32(1)), wirebson.MustDocument("a", int32(1)))
+	require.NoError(t, err)
+	assert.Empty(t, d)
+
+	d, err = Diff(wirebson.MustDocument("a", int32(1)), wirebson.MustDocument("a", int32(2)))
+	require.NoError(t, err)
+	expected := "--- expected\n+++ actual\n@@ -1,3 +1,3 @@\n {\n-  `a`: 1,\n+  `a`: 2,\n }\n"
+	assert.Equal(t, expected, d)
+}
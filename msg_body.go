@@ -55,6 +55,11 @@ var ErrZeroRead = errors.New("zero bytes read")
 
 // ReadMessage reads from reader and returns wire header and body.
 //
+// OP_COMPRESSED messages are decompressed transparently:
+// the returned header and body are those of the original message.
+//
+// OP_MSG checksum is verified if present; see [OpMsg.ChecksumVerified].
+//
 // Error is (possibly wrapped) [ErrZeroRead] if zero bytes was read.
 func ReadMessage(r *bufio.Reader) (*MsgHeader, MsgBody, error) {
 	var header MsgHeader
@@ -67,62 +72,197 @@ func ReadMessage(r *bufio.Reader) (*MsgHeader, MsgBody, error) {
 		return nil, nil, lazyerrors.Errorf("expected %d, read %d: %w", len(b), n, err)
 	}
 
-	switch header.OpCode {
+	body, err := readBody(&header, b, MaxMsgLen)
+	if err != nil {
+		if header.OpCode == OpCodeMsg {
+			return &header, nil, lazyerrors.Error(err)
+		}
+
+		return nil, nil, lazyerrors.Error(err)
+	}
+
+	return &header, body, nil
+}
+
+// readBody decodes the message body b without copying it.
+//
+// OP_COMPRESSED messages are decompressed (into a new slice) if the uncompressed size is not greater than maxMsgLen;
+// header is updated to match the original message.
+// OP_MSG checksum is verified if present.
+func readBody(header *MsgHeader, b []byte, maxMsgLen int) (MsgBody, error) {
+	if header.OpCode == OpCodeCompressed {
+		var compressed OpCompressed
+		if err := compressed.UnmarshalBinaryNocopy(b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		if int(compressed.UncompressedSize) > maxMsgLen-MsgHeaderLen {
+			return nil, lazyerrors.Errorf("invalid uncompressed size %d", compressed.UncompressedSize)
+		}
+
+		var err error
+		if b, err = compressed.Decompress(); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		header.MessageLength = int32(len(b) + MsgHeaderLen)
+		header.OpCode = compressed.OriginalOpCode
+	}
+
+	var checksumVerified bool
+
+	if header.OpCode == OpCodeMsg {
+		var err error
+		if checksumVerified, err = validateChecksum(header, b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	body, err := decodeBody(header.OpCode, b)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if msg, ok := body.(*OpMsg); ok {
+		msg.checksumVerified = checksumVerified
+	}
+
+	return body, nil
+}
+
+// decodeBody decodes the message body of the given opcode without copying b.
+func decodeBody(opCode OpCode, b []byte) (MsgBody, error) {
+	switch opCode {
 	case OpCodeReply: // not sent by clients, but we should be able to read replies from a proxy
 		var reply OpReply
 		if err := reply.UnmarshalBinaryNocopy(b); err != nil {
-			return nil, nil, lazyerrors.Error(err)
+			return nil, lazyerrors.Error(err)
 		}
 
-		return &header, &reply, nil
+		return &reply, nil
 
 	case OpCodeMsg:
-		if err := validateChecksum(&header, b); err != nil {
-			return &header, nil, lazyerrors.Error(err)
-		}
-
 		var msg OpMsg
 		if err := msg.UnmarshalBinaryNocopy(b); err != nil {
-			return &header, nil, lazyerrors.Error(err)
+			return nil, lazyerrors.Error(err)
 		}
 
-		return &header, &msg, nil
+		return &msg, nil
 
 	case OpCodeQuery:
 		var query OpQuery
 		if err := query.UnmarshalBinaryNocopy(b); err != nil {
-			return nil, nil, lazyerrors.Error(err)
+			return nil, lazyerrors.Error(err)
 		}
 
-		return &header, &query, nil
+		return &query, nil
 
 	case OpCodeUpdate:
-		fallthrough
+		var update OpUpdate
+		if err := update.UnmarshalBinaryNocopy(b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		return &update, nil
+
 	case OpCodeInsert:
-		fallthrough
-	case OpCodeGetByOID:
-		fallthrough
+		var insert OpInsert
+		if err := insert.UnmarshalBinaryNocopy(b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		return &insert, nil
+
 	case OpCodeGetMore:
-		fallthrough
+		var getMore OpGetMore
+		if err := getMore.UnmarshalBinaryNocopy(b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		return &getMore, nil
+
 	case OpCodeDelete:
-		fallthrough
+		var del OpDelete
+		if err := del.UnmarshalBinaryNocopy(b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		return &del, nil
+
 	case OpCodeKillCursors:
+		var killCursors OpKillCursors
+		if err := killCursors.UnmarshalBinaryNocopy(b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		return &killCursors, nil
+
+	case OpCodeGetByOID:
 		fallthrough
 	case OpCodeCompressed:
-		return nil, nil, lazyerrors.Errorf("unhandled opcode %s", header.OpCode)
+		return nil, lazyerrors.Errorf("unhandled opcode %s", opCode)
 
 	default:
-		return nil, nil, lazyerrors.Errorf("unexpected opcode %s", header.OpCode)
+		return nil, lazyerrors.Errorf("unexpected opcode %s", opCode)
 	}
 }
 
 // WriteMessage validates msg and headers and writes them to the writer.
+//
+// If OP_MSG has [OpMsgChecksumPresent] flag set, its CRC-32C checksum is computed automatically.
 func WriteMessage(w *bufio.Writer, header *MsgHeader, msg MsgBody) error {
-	b, err := msg.MarshalBinary()
+	b, err := marshalMessage(header, msg)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if err = writeMessage(w, header, b); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// WriteMessageCompressed validates msg and headers, compresses msg with the given compressor and level,
+// and writes it to the writer as OP_COMPRESSED message with the same request ID and response to.
+//
+// See [NewOpCompressed] for the level description.
+func WriteMessageCompressed(w *bufio.Writer, header *MsgHeader, msg MsgBody, compressor CompressorID, level int) error {
+	b, err := marshalMessage(header, msg)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	compressed, err := newOpCompressed(header.OpCode, b, compressor, level)
 	if err != nil {
 		return lazyerrors.Error(err)
 	}
 
+	if b, err = compressed.MarshalBinary(); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	compressedHeader := &MsgHeader{
+		MessageLength: int32(len(b) + MsgHeaderLen),
+		RequestID:     header.RequestID,
+		ResponseTo:    header.ResponseTo,
+		OpCode:        OpCodeCompressed,
+	}
+
+	if err = writeMessage(w, compressedHeader, b); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// marshalMessage validates msg and header and returns marshaled msg with computed OP_MSG checksum.
+func marshalMessage(header *MsgHeader, msg MsgBody) ([]byte, error) {
+	b, err := msg.MarshalBinary()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
 	if expected := len(b) + MsgHeaderLen; int32(expected) != header.MessageLength {
 		panic(fmt.Sprintf(
 			"expected length %d (marshaled body size) + %d (fixed marshaled header size) = %d, got %d",
@@ -131,22 +271,43 @@ func WriteMessage(w *bufio.Writer, header *MsgHeader, msg MsgBody) error {
 	}
 
 	if header.OpCode == OpCodeMsg {
-		if err = validateChecksum(header, b); err != nil {
-			return lazyerrors.Error(err)
+		if err = setChecksum(header, b); err != nil {
+			return nil, lazyerrors.Error(err)
 		}
 	}
 
-	if err = header.writeTo(w); err != nil {
+	return b, nil
+}
+
+// writeMessage writes header and marshaled body to the writer.
+func writeMessage(w *bufio.Writer, header *MsgHeader, b []byte) error {
+	if err := header.writeTo(w); err != nil {
 		return lazyerrors.Error(err)
 	}
 
-	if _, err = w.Write(b); err != nil {
+	if _, err := w.Write(b); err != nil {
 		return lazyerrors.Error(err)
 	}
 
 	return nil
 }
 
+// castagnoliTable is used for OP_MSG checksums.
+//
+// https://datatracker.ietf.org/doc/html/rfc4960#appendix-B
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumPresent returns true if the body of OP_MSG has the checksumPresent flag bit set.
+func checksumPresent(body []byte) (bool, error) {
+	if len(body) < flagsSize {
+		return false, lazyerrors.New("Message contains illegal flags value")
+	}
+
+	flagBit := OpMsgFlags(binary.LittleEndian.Uint32(body[:flagsSize]))
+
+	return flagBit.FlagSet(OpMsgChecksumPresent), nil
+}
+
 // getChecksum returns the checksum attached to an OP_MSG.
 func getChecksum(data []byte) (uint32, error) {
 	// ensure that the length of the body is at least the size of a flagbit
@@ -159,44 +320,64 @@ func getChecksum(data []byte) (uint32, error) {
 	return binary.LittleEndian.Uint32(data[n-crc32.Size:]), nil
 }
 
-// validateChecksum calculates checksum of the message (header + body)
-// and compares it with the checksum from the last bytes of the message.
-// If the flag bit for checksum presence is not set or the checksum is valid, it returns nil.
-// If the checksum is invalid, it returns an error.
-//
-// The callers of checksum validation should be closer to OP_MSG handling.
-// TODO https://github.com/FerretDB/FerretDB/issues/2690
-func validateChecksum(header *MsgHeader, body []byte) error {
-	if len(body) < flagsSize {
-		return lazyerrors.New("Message contains illegal flags value")
+// computeChecksum calculates CRC-32C checksum of the message (header + body without the last 4 bytes).
+func computeChecksum(header *MsgHeader, body []byte) uint32 {
+	var h [MsgHeaderLen]byte
+	binary.LittleEndian.PutUint32(h[0:4], uint32(header.MessageLength))
+	binary.LittleEndian.PutUint32(h[4:8], uint32(header.RequestID))
+	binary.LittleEndian.PutUint32(h[8:12], uint32(header.ResponseTo))
+	binary.LittleEndian.PutUint32(h[12:16], uint32(header.OpCode))
+
+	res := crc32.Update(0, castagnoliTable, h[:])
+	return crc32.Update(res, castagnoliTable, body[:len(body)-crc32.Size])
+}
+
+// setChecksum calculates checksum of the message (header + body)
+// and stores it in the last bytes of the body.
+// If the flag bit for checksum presence is not set, it does nothing.
+func setChecksum(header *MsgHeader, body []byte) error {
+	present, err := checksumPresent(body)
+	if err != nil {
+		return lazyerrors.Error(err)
 	}
 
-	flagBit := OpMsgFlags(binary.LittleEndian.Uint32(body[:flagsSize]))
-	if !flagBit.FlagSet(OpMsgChecksumPresent) {
+	if !present {
 		return nil
 	}
 
-	want, err := getChecksum(body)
-	if err != nil {
+	// check size
+	if _, err = getChecksum(body); err != nil {
 		return lazyerrors.Error(err)
 	}
 
-	// https://datatracker.ietf.org/doc/html/rfc4960#appendix-B
-	hasher := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	binary.LittleEndian.PutUint32(body[len(body)-crc32.Size:], computeChecksum(header, body))
 
-	if err = binary.Write(hasher, binary.LittleEndian, header); err != nil {
-		return lazyerrors.Error(err)
+	return nil
+}
+
+// validateChecksum calculates checksum of the message (header + body)
+// and compares it with the checksum from the last bytes of the message.
+// If the flag bit for checksum presence is not set, it returns false and nil.
+// If the checksum is valid, it returns true and nil.
+// If the checksum is invalid, it returns an error.
+func validateChecksum(header *MsgHeader, body []byte) (bool, error) {
+	present, err := checksumPresent(body)
+	if err != nil {
+		return false, lazyerrors.Error(err)
 	}
 
-	offset := len(body) - crc32.Size
-	if err = binary.Write(hasher, binary.LittleEndian, body[:offset]); err != nil {
-		return lazyerrors.Error(err)
+	if !present {
+		return false, nil
+	}
+
+	want, err := getChecksum(body)
+	if err != nil {
+		return false, lazyerrors.Error(err)
 	}
 
-	got := hasher.Sum32()
-	if want != got {
-		return lazyerrors.New("OP_MSG checksum does not match contents.")
+	if got := computeChecksum(header, body); want != got {
+		return false, lazyerrors.New("OP_MSG checksum does not match contents.")
 	}
 
-	return nil
+	return true, nil
 }
@@ -61,19 +61,35 @@ const (
 // Error is ErrZeroRead if zero bytes was read.
 func (msg *MsgHeader) readFrom(r *bufio.Reader) error {
 	b := make([]byte, MsgHeaderLen)
-	if n, err := io.ReadFull(r, b); err != nil {
+	if err := readHeader(r, b); err != nil {
+		return err
+	}
+
+	return msg.unmarshal(b, MaxMsgLen)
+}
+
+// readHeader reads MsgHeaderLen bytes into b.
+//
+// Error is ErrZeroRead if zero bytes was read.
+func readHeader(r io.Reader, b []byte) error {
+	if n, err := io.ReadFull(r, b[:MsgHeaderLen]); err != nil {
 		if err == io.EOF {
 			return ErrZeroRead
 		}
-		return lazyerrors.Errorf("expected %d, read %d: %w", len(b), n, err)
+		return lazyerrors.Errorf("expected %d, read %d: %w", MsgHeaderLen, n, err)
 	}
 
+	return nil
+}
+
+// unmarshal decodes header from b and checks that message length is not greater than maxMsgLen.
+func (msg *MsgHeader) unmarshal(b []byte, maxMsgLen int) error {
 	msg.MessageLength = int32(binary.LittleEndian.Uint32(b[0:4]))
 	msg.RequestID = int32(binary.LittleEndian.Uint32(b[4:8]))
 	msg.ResponseTo = int32(binary.LittleEndian.Uint32(b[8:12]))
 	msg.OpCode = OpCode(binary.LittleEndian.Uint32(b[12:16]))
 
-	if msg.MessageLength < MsgHeaderLen || msg.MessageLength > MaxMsgLen {
+	if msg.MessageLength < MsgHeaderLen || int(msg.MessageLength) > maxMsgLen {
 		return lazyerrors.Errorf("invalid message length %d", msg.MessageLength)
 	}
 
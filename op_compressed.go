@@ -0,0 +1,182 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// OpCompressed represents the OP_COMPRESSED wire protocol message type.
+// It wraps another message body compressed with one of the supported compressors.
+//
+// [ReadMessage] decompresses such messages transparently,
+// so it is mostly used for writing with [WriteMessage] or [WriteMessageCompressed].
+type OpCompressed struct {
+	// The order of fields is weird to make the struct smaller due to alignment.
+	// The wire order is: original opcode, uncompressed size, compressor ID, compressed message.
+
+	compressedMessage []byte
+	OriginalOpCode    OpCode
+	UncompressedSize  int32
+	CompressorID      CompressorID
+}
+
+// NewOpCompressed creates a new OpCompressed message
+// by compressing the given message body with the given compressor.
+//
+// The level is compressor-specific; [DefaultCompressionLevel] selects the default one.
+// It is ignored by compressors without levels.
+func NewOpCompressed(originalOpCode OpCode, msg MsgBody, compressor CompressorID, level int) (*OpCompressed, error) {
+	b, err := msg.MarshalBinary()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	res, err := newOpCompressed(originalOpCode, b, compressor, level)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return res, nil
+}
+
+// newOpCompressed creates a new OpCompressed message from the marshaled message body.
+func newOpCompressed(originalOpCode OpCode, b []byte, compressor CompressorID, level int) (*OpCompressed, error) {
+	if originalOpCode == OpCodeCompressed {
+		return nil, lazyerrors.New("nested OP_COMPRESSED")
+	}
+
+	compressed, err := compress(compressor, level, b)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &OpCompressed{
+		compressedMessage: compressed,
+		OriginalOpCode:    originalOpCode,
+		UncompressedSize:  int32(len(b)),
+		CompressorID:      compressor,
+	}, nil
+}
+
+func (msg *OpCompressed) msgbody() {}
+
+// check implements [MsgBody].
+func (msg *OpCompressed) check() error {
+	b, err := msg.Decompress()
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	body, err := decodeBody(msg.OriginalOpCode, b)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if err = body.check(); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// UnmarshalBinaryNocopy implements [MsgBody].
+func (msg *OpCompressed) UnmarshalBinaryNocopy(b []byte) error {
+	if len(b) < 9 {
+		return lazyerrors.Errorf("len=%d", len(b))
+	}
+
+	msg.OriginalOpCode = OpCode(binary.LittleEndian.Uint32(b[0:4]))
+	msg.UncompressedSize = int32(binary.LittleEndian.Uint32(b[4:8]))
+	msg.CompressorID = CompressorID(b[8])
+	msg.compressedMessage = b[9:]
+
+	if msg.OriginalOpCode == OpCodeCompressed {
+		return lazyerrors.New("nested OP_COMPRESSED")
+	}
+
+	if msg.UncompressedSize < 0 || msg.UncompressedSize > MaxMsgLen-MsgHeaderLen {
+		return lazyerrors.Errorf("uncompressedSize=%d", msg.UncompressedSize)
+	}
+
+	if Debug {
+		if err := msg.check(); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// Size implements [MsgBody].
+func (msg *OpCompressed) Size() int {
+	return 9 + len(msg.compressedMessage)
+}
+
+// MarshalBinary implements [MsgBody].
+func (msg *OpCompressed) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 9+len(msg.compressedMessage))
+
+	binary.LittleEndian.PutUint32(b[0:4], uint32(msg.OriginalOpCode))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(msg.UncompressedSize))
+	b[8] = byte(msg.CompressorID)
+	copy(b[9:], msg.compressedMessage)
+
+	return b, nil
+}
+
+// Decompress returns the decompressed original message body.
+func (msg *OpCompressed) Decompress() ([]byte, error) {
+	b, err := decompress(msg.CompressorID, int(msg.UncompressedSize), msg.compressedMessage)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return b, nil
+}
+
+// logMessage returns a string representation for logging.
+func (msg *OpCompressed) logMessage(logFunc func(v any) string) string {
+	if msg == nil {
+		return "<nil>"
+	}
+
+	m := wirebson.MustDocument(
+		"OriginalOpCode", msg.OriginalOpCode.String(),
+		"UncompressedSize", msg.UncompressedSize,
+		"CompressorID", msg.CompressorID.String(),
+		"CompressedSize", int32(len(msg.compressedMessage)),
+	)
+
+	return logFunc(m)
+}
+
+// String returns an string representation for logging.
+func (msg *OpCompressed) String() string {
+	return msg.logMessage(wirebson.LogMessage)
+}
+
+// StringIndent returns an indented string representation for logging.
+func (msg *OpCompressed) StringIndent() string {
+	return msg.logMessage(wirebson.LogMessageIndent)
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpCompressed)(nil)
+)
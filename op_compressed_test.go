@@ -0,0 +1,161 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire/internal/util/testutil"
+)
+
+// compressedNoopB is an OP_MSG with a single `{ping: 1}` document wrapped into OP_COMPRESSED with noop compressor.
+var compressedNoopB = []byte{
+	0x2d, 0x00, 0x00, 0x00, // MessageLength
+	0x2a, 0x00, 0x00, 0x00, // RequestID
+	0x00, 0x00, 0x00, 0x00, // ResponseTo
+	0xdc, 0x07, 0x00, 0x00, // OpCode
+
+	0xdd, 0x07, 0x00, 0x00, // OriginalOpCode
+	0x14, 0x00, 0x00, 0x00, // UncompressedSize
+	0x00, // CompressorID
+
+	0x00, 0x00, 0x00, 0x00, // FlagBits
+	0x00,                   // section kind
+	0x0f, 0x00, 0x00, 0x00, // document size
+	0x10, 0x70, 0x69, 0x6e, 0x67, 0x00, // int32 "ping"
+	0x01, 0x00, 0x00, 0x00, // 1
+	0x00, // end of document
+}
+
+func TestCompressed(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Noop", func(t *testing.T) {
+		t.Parallel()
+
+		header, body, err := ReadMessage(bufio.NewReader(bytes.NewReader(compressedNoopB)))
+		require.NoError(t, err)
+
+		expectedHeader := &MsgHeader{
+			MessageLength: 36,
+			RequestID:     42,
+			OpCode:        OpCodeMsg,
+		}
+		assert.Equal(t, expectedHeader, header)
+		assert.Equal(t, MustOpMsg("ping", int32(1)), body)
+
+		var buf bytes.Buffer
+		bufw := bufio.NewWriter(&buf)
+		require.NoError(t, WriteMessageCompressed(bufw, header, body, CompressorNoop, DefaultCompressionLevel))
+		require.NoError(t, bufw.Flush())
+		assert.Equal(t, compressedNoopB, buf.Bytes())
+	})
+
+	for _, compressor := range []CompressorID{CompressorNoop, CompressorSnappy, CompressorZlib, CompressorZstd} {
+		t.Run(compressor.String(), func(t *testing.T) {
+			t.Parallel()
+
+			for _, level := range []int{DefaultCompressionLevel, 1} {
+				header := &MsgHeader{
+					RequestID:  int32(13 + level),
+					ResponseTo: 12,
+					OpCode:     OpCodeQuery,
+				}
+
+				body := &OpQuery{
+					FullCollectionName: "admin.$cmd",
+					NumberToReturn:     -1,
+					query:              testutil.MustParseDumpFile("testdata", "handshake1_body.hex")[23:],
+				}
+
+				header.MessageLength = int32(body.Size() + MsgHeaderLen)
+
+				var buf bytes.Buffer
+				bufw := bufio.NewWriter(&buf)
+				require.NoError(t, WriteMessageCompressed(bufw, header, body, compressor, level))
+				require.NoError(t, bufw.Flush())
+
+				var raw OpCompressed
+				require.NoError(t, raw.UnmarshalBinaryNocopy(buf.Bytes()[MsgHeaderLen:]))
+				assert.Equal(t, OpCodeQuery, raw.OriginalOpCode)
+				assert.Equal(t, compressor, raw.CompressorID)
+				assert.EqualValues(t, body.Size(), raw.UncompressedSize)
+				assert.NotEmpty(t, raw.StringIndent())
+
+				actualHeader, actualBody, err := ReadMessage(bufio.NewReader(&buf))
+				require.NoError(t, err)
+				assert.Equal(t, header, actualHeader)
+				assert.Equal(t, body, actualBody)
+			}
+		})
+	}
+
+	t.Run("WriteMessage", func(t *testing.T) {
+		t.Parallel()
+
+		body, err := NewOpCompressed(OpCodeMsg, MustOpMsg("ping", int32(1)), CompressorNoop, DefaultCompressionLevel)
+		require.NoError(t, err)
+
+		header := &MsgHeader{
+			MessageLength: int32(body.Size() + MsgHeaderLen),
+			RequestID:     42,
+			OpCode:        OpCodeCompressed,
+		}
+
+		var buf bytes.Buffer
+		bufw := bufio.NewWriter(&buf)
+		require.NoError(t, WriteMessage(bufw, header, body))
+		require.NoError(t, bufw.Flush())
+		assert.Equal(t, compressedNoopB, buf.Bytes())
+	})
+
+	t.Run("UnsupportedCompressor", func(t *testing.T) {
+		t.Parallel()
+
+		b := bytes.Clone(compressedNoopB)
+		b[24] = 42
+
+		_, _, err := ReadMessage(bufio.NewReader(bytes.NewReader(b)))
+		require.Error(t, err)
+		assert.Equal(t, "unsupported compressor CompressorID(42)", lastErr(err).Error())
+	})
+
+	t.Run("InvalidSize", func(t *testing.T) {
+		t.Parallel()
+
+		b := bytes.Clone(compressedNoopB)
+		b[20] = 0x15
+
+		_, _, err := ReadMessage(bufio.NewReader(bytes.NewReader(b)))
+		require.Error(t, err)
+		assert.Equal(t, "expected uncompressed size 21, got 20", lastErr(err).Error())
+	})
+
+	t.Run("Nested", func(t *testing.T) {
+		t.Parallel()
+
+		b := bytes.Clone(compressedNoopB)
+		b[16] = 0xdc
+
+		_, _, err := ReadMessage(bufio.NewReader(bytes.NewReader(b)))
+		require.Error(t, err)
+		assert.Equal(t, "nested OP_COMPRESSED", lastErr(err).Error())
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// OpDelete represents the deprecated OP_DELETE wire protocol message type.
+// It stores BSON documents in the raw form.
+//
+// Message is checked during construction by [NewOpDelete] or [OpDelete.UnmarshalBinaryNocopy]
+// without decoding BSON documents inside.
+type OpDelete struct {
+	// The order of fields is weird to make the struct smaller due to alignment.
+	// The wire order is: reserved zero, collection name, flags, selector.
+
+	FullCollectionName string
+	selector           wirebson.RawDocument
+	Flags              OpDeleteFlags
+}
+
+// NewOpDelete creates a new OpDelete message.
+func NewOpDelete(selector wirebson.AnyDocument) (*OpDelete, error) {
+	raw, err := selector.Encode()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	del := &OpDelete{
+		selector: raw,
+	}
+
+	if Debug {
+		if err = del.check(); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	return del, nil
+}
+
+func (del *OpDelete) msgbody() {}
+
+// check implements [MsgBody].
+func (del *OpDelete) check() error {
+	if _, err := del.selector.DecodeDeep(); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// UnmarshalBinaryNocopy implements [MsgBody].
+func (del *OpDelete) UnmarshalBinaryNocopy(b []byte) error {
+	if len(b) < 4 {
+		return lazyerrors.Errorf("len=%d", len(b))
+	}
+
+	if zero := binary.LittleEndian.Uint32(b[0:4]); zero != 0 {
+		return lazyerrors.Errorf("ZERO=%d", zero)
+	}
+
+	var err error
+
+	del.FullCollectionName, err = wirebson.DecodeCString(b[4:])
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	flagsLow := 4 + wirebson.SizeCString(del.FullCollectionName)
+	if len(b) < flagsLow+4 {
+		return lazyerrors.Errorf("len=%d, can't unmarshal flags", len(b))
+	}
+
+	del.Flags = OpDeleteFlags(binary.LittleEndian.Uint32(b[flagsLow : flagsLow+4]))
+
+	selectorLow := flagsLow + 4
+
+	l, err := wirebson.FindRaw(b[selectorLow:])
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if len(b) != selectorLow+l {
+		return lazyerrors.Errorf("len=%d, expected=%d", len(b), selectorLow+l)
+	}
+	del.selector = b[selectorLow:]
+
+	if Debug {
+		if err = del.check(); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// Size implements [MsgBody].
+func (del *OpDelete) Size() int {
+	return 8 + wirebson.SizeCString(del.FullCollectionName) + len(del.selector)
+}
+
+// MarshalBinary implements [MsgBody].
+func (del *OpDelete) MarshalBinary() ([]byte, error) {
+	b := make([]byte, del.Size())
+
+	nameHigh := 4 + wirebson.SizeCString(del.FullCollectionName)
+	wirebson.EncodeCString(b[4:nameHigh], del.FullCollectionName)
+
+	binary.LittleEndian.PutUint32(b[nameHigh:nameHigh+4], uint32(del.Flags))
+	copy(b[nameHigh+4:], del.selector)
+
+	return b, nil
+}
+
+// Selector returns decoded selector document.
+// It may be shallowly or deeply decoded.
+func (del *OpDelete) Selector() (*wirebson.Document, error) {
+	doc, err := del.selector.Decode()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return doc, nil
+}
+
+// SelectorDeep returns deeply decoded selector document.
+func (del *OpDelete) SelectorDeep() (*wirebson.Document, error) {
+	doc, err := del.selector.DecodeDeep()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return doc, nil
+}
+
+// SelectorRaw returns raw selector document.
+func (del *OpDelete) SelectorRaw() wirebson.RawDocument {
+	return del.selector
+}
+
+// logMessage returns a string representation for logging.
+func (del *OpDelete) logMessage(logFunc func(v any) string) string {
+	if del == nil {
+		return "<nil>"
+	}
+
+	m := wirebson.MustDocument(
+		"FullCollectionName", del.FullCollectionName,
+		"Flags", del.Flags.String(),
+	)
+
+	doc, err := del.SelectorDeep()
+	if err == nil {
+		must.NoError(m.Add("Selector", doc))
+	} else {
+		must.NoError(m.Add("SelectorError", err.Error()))
+	}
+
+	return logFunc(m)
+}
+
+// String returns an string representation for logging.
+func (del *OpDelete) String() string {
+	return del.logMessage(wirebson.LogMessage)
+}
+
+// StringIndent returns an indented string representation for logging.
+func (del *OpDelete) StringIndent() string {
+	return del.logMessage(wirebson.LogMessageIndent)
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpDelete)(nil)
+)
@@ -0,0 +1,67 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"testing"
+)
+
+var deleteTestCases = []testCase{
+	{
+		name: "SingleRemove",
+		expectedB: []byte{
+			0x2f, 0x00, 0x00, 0x00, // MessageLength
+			0x03, 0x00, 0x00, 0x00, // RequestID
+			0x00, 0x00, 0x00, 0x00, // ResponseTo
+			0xd6, 0x07, 0x00, 0x00, // OpCode
+
+			0x00, 0x00, 0x00, 0x00, // ZERO
+			0x74, 0x65, 0x73, 0x74, 0x2e, 0x66, 0x6f, 0x6f, 0x00, // FullCollectionName "test.foo"
+			0x01, 0x00, 0x00, 0x00, // Flags
+
+			0x0e, 0x00, 0x00, 0x00, // document size
+			0x10, 0x5f, 0x69, 0x64, 0x00, // int32 "_id"
+			0x01, 0x00, 0x00, 0x00, // 1
+			0x00, // end of document
+		},
+		msgHeader: &MsgHeader{
+			MessageLength: 47,
+			RequestID:     3,
+			OpCode:        OpCodeDelete,
+		},
+		msgBody: &OpDelete{
+			FullCollectionName: "test.foo",
+			Flags:              OpDeleteFlags(OpDeleteSingleRemove),
+			selector:           makeRawDocument("_id", int32(1)),
+		},
+		si: `
+		{
+		  "FullCollectionName": "test.foo",
+		  "Flags": "[SingleRemove]",
+		  "Selector": {
+		    "_id": 1,
+		  },
+		}`,
+	},
+}
+
+func TestDelete(t *testing.T) {
+	t.Parallel()
+	testMessages(t, deleteTestCases)
+}
+
+func FuzzDelete(f *testing.F) {
+	fuzzMessages(f, deleteTestCases)
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// OpGetMore represents the deprecated OP_GET_MORE wire protocol message type.
+type OpGetMore struct {
+	// The order of fields is weird to make the struct smaller due to alignment.
+	// The wire order is: reserved zero, collection name, number to return, cursor ID.
+
+	FullCollectionName string
+	CursorID           int64
+	NumberToReturn     int32
+}
+
+func (getMore *OpGetMore) msgbody() {}
+
+// check implements [MsgBody].
+func (getMore *OpGetMore) check() error {
+	return nil
+}
+
+// UnmarshalBinaryNocopy implements [MsgBody].
+func (getMore *OpGetMore) UnmarshalBinaryNocopy(b []byte) error {
+	if len(b) < 4 {
+		return lazyerrors.Errorf("len=%d", len(b))
+	}
+
+	if zero := binary.LittleEndian.Uint32(b[0:4]); zero != 0 {
+		return lazyerrors.Errorf("ZERO=%d", zero)
+	}
+
+	var err error
+
+	getMore.FullCollectionName, err = wirebson.DecodeCString(b[4:])
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	numberLow := 4 + wirebson.SizeCString(getMore.FullCollectionName)
+	if len(b) != numberLow+12 {
+		return lazyerrors.Errorf("len=%d, expected=%d", len(b), numberLow+12)
+	}
+
+	getMore.NumberToReturn = int32(binary.LittleEndian.Uint32(b[numberLow : numberLow+4]))
+	getMore.CursorID = int64(binary.LittleEndian.Uint64(b[numberLow+4 : numberLow+12]))
+
+	return nil
+}
+
+// Size implements [MsgBody].
+func (getMore *OpGetMore) Size() int {
+	return 16 + wirebson.SizeCString(getMore.FullCollectionName)
+}
+
+// MarshalBinary implements [MsgBody].
+func (getMore *OpGetMore) MarshalBinary() ([]byte, error) {
+	b := make([]byte, getMore.Size())
+
+	nameHigh := 4 + wirebson.SizeCString(getMore.FullCollectionName)
+	wirebson.EncodeCString(b[4:nameHigh], getMore.FullCollectionName)
+
+	binary.LittleEndian.PutUint32(b[nameHigh:nameHigh+4], uint32(getMore.NumberToReturn))
+	binary.LittleEndian.PutUint64(b[nameHigh+4:nameHigh+12], uint64(getMore.CursorID))
+
+	return b, nil
+}
+
+// logMessage returns a string representation for logging.
+func (getMore *OpGetMore) logMessage(logFunc func(v any) string) string {
+	if getMore == nil {
+		return "<nil>"
+	}
+
+	m := wirebson.MustDocument(
+		"FullCollectionName", getMore.FullCollectionName,
+		"NumberToReturn", getMore.NumberToReturn,
+		"CursorID", getMore.CursorID,
+	)
+
+	return logFunc(m)
+}
+
+// String returns an string representation for logging.
+func (getMore *OpGetMore) String() string {
+	return getMore.logMessage(wirebson.LogMessage)
+}
+
+// StringIndent returns an indented string representation for logging.
+func (getMore *OpGetMore) StringIndent() string {
+	return getMore.logMessage(wirebson.LogMessageIndent)
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpGetMore)(nil)
+)
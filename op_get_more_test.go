@@ -0,0 +1,61 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"testing"
+)
+
+var getMoreTestCases = []testCase{
+	{
+		name: "GetMore",
+		expectedB: []byte{
+			0x29, 0x00, 0x00, 0x00, // MessageLength
+			0x04, 0x00, 0x00, 0x00, // RequestID
+			0x00, 0x00, 0x00, 0x00, // ResponseTo
+			0xd5, 0x07, 0x00, 0x00, // OpCode
+
+			0x00, 0x00, 0x00, 0x00, // ZERO
+			0x74, 0x65, 0x73, 0x74, 0x2e, 0x66, 0x6f, 0x6f, 0x00, // FullCollectionName "test.foo"
+			0x02, 0x00, 0x00, 0x00, // NumberToReturn
+			0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, // CursorID
+		},
+		msgHeader: &MsgHeader{
+			MessageLength: 41,
+			RequestID:     4,
+			OpCode:        OpCodeGetMore,
+		},
+		msgBody: &OpGetMore{
+			FullCollectionName: "test.foo",
+			NumberToReturn:     2,
+			CursorID:           0x0102030405060708,
+		},
+		si: `
+		{
+		  "FullCollectionName": "test.foo",
+		  "NumberToReturn": 2,
+		  "CursorID": int64(72623859790382856),
+		}`,
+	},
+}
+
+func TestGetMore(t *testing.T) {
+	t.Parallel()
+	testMessages(t, getMoreTestCases)
+}
+
+func FuzzGetMore(f *testing.F) {
+	fuzzMessages(f, getMoreTestCases)
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// OpInsert represents the deprecated OP_INSERT wire protocol message type.
+// It stores BSON documents in the raw form.
+//
+// Message is checked during construction by [NewOpInsert] or [OpInsert.UnmarshalBinaryNocopy]
+// without decoding BSON documents inside.
+type OpInsert struct {
+	// The order of fields is weird to make the struct smaller due to alignment.
+	// The wire order is: flags, collection name, documents.
+
+	FullCollectionName string
+	documents          []wirebson.RawDocument
+	Flags              OpInsertFlags
+}
+
+// NewOpInsert creates a new OpInsert message with the given documents.
+func NewOpInsert(docs ...wirebson.AnyDocument) (*OpInsert, error) {
+	if len(docs) == 0 {
+		return nil, lazyerrors.New("no documents")
+	}
+
+	insert := &OpInsert{
+		documents: make([]wirebson.RawDocument, len(docs)),
+	}
+
+	for i, doc := range docs {
+		raw, err := doc.Encode()
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		insert.documents[i] = raw
+	}
+
+	if Debug {
+		if err := insert.check(); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	return insert, nil
+}
+
+func (insert *OpInsert) msgbody() {}
+
+// check implements [MsgBody].
+func (insert *OpInsert) check() error {
+	for _, d := range insert.documents {
+		if _, err := d.DecodeDeep(); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalBinaryNocopy implements [MsgBody].
+func (insert *OpInsert) UnmarshalBinaryNocopy(b []byte) error {
+	if len(b) < 4 {
+		return lazyerrors.Errorf("len=%d", len(b))
+	}
+
+	insert.Flags = OpInsertFlags(binary.LittleEndian.Uint32(b[0:4]))
+
+	var err error
+
+	insert.FullCollectionName, err = wirebson.DecodeCString(b[4:])
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	offset := 4 + wirebson.SizeCString(insert.FullCollectionName)
+
+	insert.documents = nil
+
+	for offset < len(b) {
+		var l int
+		if l, err = wirebson.FindRaw(b[offset:]); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		insert.documents = append(insert.documents, b[offset:offset+l])
+		offset += l
+	}
+
+	if len(insert.documents) == 0 {
+		return lazyerrors.New("no documents")
+	}
+
+	if Debug {
+		if err = insert.check(); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// Size implements [MsgBody].
+func (insert *OpInsert) Size() int {
+	res := 4 + wirebson.SizeCString(insert.FullCollectionName)
+	for _, d := range insert.documents {
+		res += len(d)
+	}
+
+	return res
+}
+
+// MarshalBinary implements [MsgBody].
+func (insert *OpInsert) MarshalBinary() ([]byte, error) {
+	nameHigh := 4 + wirebson.SizeCString(insert.FullCollectionName)
+	b := make([]byte, nameHigh, insert.Size())
+
+	binary.LittleEndian.PutUint32(b[0:4], uint32(insert.Flags))
+	wirebson.EncodeCString(b[4:nameHigh], insert.FullCollectionName)
+
+	for _, d := range insert.documents {
+		b = append(b, d...)
+	}
+
+	return b, nil
+}
+
+// Documents returns decoded documents.
+// They may be shallowly or deeply decoded.
+func (insert *OpInsert) Documents() ([]*wirebson.Document, error) {
+	res := make([]*wirebson.Document, len(insert.documents))
+
+	for i, d := range insert.documents {
+		doc, err := d.Decode()
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		res[i] = doc
+	}
+
+	return res, nil
+}
+
+// DocumentsDeep returns deeply decoded documents.
+func (insert *OpInsert) DocumentsDeep() ([]*wirebson.Document, error) {
+	res := make([]*wirebson.Document, len(insert.documents))
+
+	for i, d := range insert.documents {
+		doc, err := d.DecodeDeep()
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		res[i] = doc
+	}
+
+	return res, nil
+}
+
+// DocumentsRaw returns raw documents.
+func (insert *OpInsert) DocumentsRaw() []wirebson.RawDocument {
+	return insert.documents
+}
+
+// logMessage returns a string representation for logging.
+func (insert *OpInsert) logMessage(logFunc func(v any) string) string {
+	if insert == nil {
+		return "<nil>"
+	}
+
+	m := wirebson.MustDocument(
+		"Flags", insert.Flags.String(),
+		"FullCollectionName", insert.FullCollectionName,
+	)
+
+	docs := wirebson.MakeArray(len(insert.documents))
+
+	for _, d := range insert.documents {
+		doc, err := d.DecodeDeep()
+		if err == nil {
+			must.NoError(docs.Add(doc))
+		} else {
+			must.NoError(docs.Add(wirebson.MustDocument("error", err.Error())))
+		}
+	}
+
+	must.NoError(m.Add("Documents", docs))
+
+	return logFunc(m)
+}
+
+// String returns an string representation for logging.
+func (insert *OpInsert) String() string {
+	return insert.logMessage(wirebson.LogMessage)
+}
+
+// StringIndent returns an indented string representation for logging.
+func (insert *OpInsert) StringIndent() string {
+	return insert.logMessage(wirebson.LogMessageIndent)
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpInsert)(nil)
+)
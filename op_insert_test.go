@@ -0,0 +1,94 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"testing"
+
+	"github.com/FerretDB/wire/wirebson"
+)
+
+var insertTestCases = []testCase{
+	{
+		name: "ContinueOnError",
+		expectedB: []byte{
+			0x39, 0x00, 0x00, 0x00, // MessageLength
+			0x01, 0x00, 0x00, 0x00, // RequestID
+			0x00, 0x00, 0x00, 0x00, // ResponseTo
+			0xd2, 0x07, 0x00, 0x00, // OpCode
+
+			0x01, 0x00, 0x00, 0x00, // Flags
+			0x74, 0x65, 0x73, 0x74, 0x2e, 0x66, 0x6f, 0x6f, 0x00, // FullCollectionName "test.foo"
+
+			0x0e, 0x00, 0x00, 0x00, // document size
+			0x10, 0x5f, 0x69, 0x64, 0x00, // int32 "_id"
+			0x01, 0x00, 0x00, 0x00, // 1
+			0x00, // end of document
+
+			0x0e, 0x00, 0x00, 0x00, // document size
+			0x10, 0x5f, 0x69, 0x64, 0x00, // int32 "_id"
+			0x02, 0x00, 0x00, 0x00, // 2
+			0x00, // end of document
+		},
+		msgHeader: &MsgHeader{
+			MessageLength: 57,
+			RequestID:     1,
+			OpCode:        OpCodeInsert,
+		},
+		msgBody: &OpInsert{
+			Flags:              OpInsertFlags(OpInsertContinueOnError),
+			FullCollectionName: "test.foo",
+			documents: []wirebson.RawDocument{
+				makeRawDocument("_id", int32(1)),
+				makeRawDocument("_id", int32(2)),
+			},
+		},
+		si: `
+		{
+		  "Flags": "[ContinueOnError]",
+		  "FullCollectionName": "test.foo",
+		  "Documents": [
+		    {
+		      "_id": 1,
+		    },
+		    {
+		      "_id": 2,
+		    },
+		  ],
+		}`,
+	},
+	{
+		name: "NoDocuments",
+		expectedB: []byte{
+			0x1d, 0x00, 0x00, 0x00, // MessageLength
+			0x01, 0x00, 0x00, 0x00, // RequestID
+			0x00, 0x00, 0x00, 0x00, // ResponseTo
+			0xd2, 0x07, 0x00, 0x00, // OpCode
+
+			0x00, 0x00, 0x00, 0x00, // Flags
+			0x74, 0x65, 0x73, 0x74, 0x2e, 0x66, 0x6f, 0x6f, 0x00, // FullCollectionName "test.foo"
+		},
+		err: "no documents",
+	},
+}
+
+func TestInsert(t *testing.T) {
+	t.Parallel()
+	testMessages(t, insertTestCases)
+}
+
+func FuzzInsert(f *testing.F) {
+	fuzzMessages(f, insertTestCases)
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// OpKillCursors represents the deprecated OP_KILL_CURSORS wire protocol message type.
+type OpKillCursors struct {
+	// The wire order is: reserved zero, number of cursor IDs, cursor IDs.
+
+	CursorIDs []int64
+}
+
+func (killCursors *OpKillCursors) msgbody() {}
+
+// check implements [MsgBody].
+func (killCursors *OpKillCursors) check() error {
+	return nil
+}
+
+// UnmarshalBinaryNocopy implements [MsgBody].
+func (killCursors *OpKillCursors) UnmarshalBinaryNocopy(b []byte) error {
+	if len(b) < 8 {
+		return lazyerrors.Errorf("len=%d", len(b))
+	}
+
+	if zero := binary.LittleEndian.Uint32(b[0:4]); zero != 0 {
+		return lazyerrors.Errorf("ZERO=%d", zero)
+	}
+
+	n := int32(binary.LittleEndian.Uint32(b[4:8]))
+	if n < 0 || len(b) != 8+8*int(n) {
+		return lazyerrors.Errorf("len=%d, numberOfCursorIDs=%d", len(b), n)
+	}
+
+	killCursors.CursorIDs = make([]int64, n)
+	for i := range killCursors.CursorIDs {
+		offset := 8 + 8*i
+		killCursors.CursorIDs[i] = int64(binary.LittleEndian.Uint64(b[offset : offset+8]))
+	}
+
+	return nil
+}
+
+// Size implements [MsgBody].
+func (killCursors *OpKillCursors) Size() int {
+	return 8 + 8*len(killCursors.CursorIDs)
+}
+
+// MarshalBinary implements [MsgBody].
+func (killCursors *OpKillCursors) MarshalBinary() ([]byte, error) {
+	b := make([]byte, killCursors.Size())
+
+	binary.LittleEndian.PutUint32(b[4:8], uint32(len(killCursors.CursorIDs)))
+
+	for i, id := range killCursors.CursorIDs {
+		offset := 8 + 8*i
+		binary.LittleEndian.PutUint64(b[offset:offset+8], uint64(id))
+	}
+
+	return b, nil
+}
+
+// logMessage returns a string representation for logging.
+func (killCursors *OpKillCursors) logMessage(logFunc func(v any) string) string {
+	if killCursors == nil {
+		return "<nil>"
+	}
+
+	ids := wirebson.MakeArray(len(killCursors.CursorIDs))
+	for _, id := range killCursors.CursorIDs {
+		must.NoError(ids.Add(id))
+	}
+
+	m := wirebson.MustDocument(
+		"NumberOfCursorIDs", int32(len(killCursors.CursorIDs)),
+		"CursorIDs", ids,
+	)
+
+	return logFunc(m)
+}
+
+// String returns an string representation for logging.
+func (killCursors *OpKillCursors) String() string {
+	return killCursors.logMessage(wirebson.LogMessage)
+}
+
+// StringIndent returns an indented string representation for logging.
+func (killCursors *OpKillCursors) StringIndent() string {
+	return killCursors.logMessage(wirebson.LogMessageIndent)
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpKillCursors)(nil)
+)
@@ -0,0 +1,75 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"testing"
+)
+
+var killCursorsTestCases = []testCase{
+	{
+		name: "KillCursors",
+		expectedB: []byte{
+			0x28, 0x00, 0x00, 0x00, // MessageLength
+			0x05, 0x00, 0x00, 0x00, // RequestID
+			0x00, 0x00, 0x00, 0x00, // ResponseTo
+			0xd7, 0x07, 0x00, 0x00, // OpCode
+
+			0x00, 0x00, 0x00, 0x00, // ZERO
+			0x02, 0x00, 0x00, 0x00, // NumberOfCursorIDs
+			0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // CursorID
+			0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, // CursorID
+		},
+		msgHeader: &MsgHeader{
+			MessageLength: 40,
+			RequestID:     5,
+			OpCode:        OpCodeKillCursors,
+		},
+		msgBody: &OpKillCursors{
+			CursorIDs: []int64{1, 0x0102030405060708},
+		},
+		si: `
+		{
+		  "NumberOfCursorIDs": 2,
+		  "CursorIDs": [
+		    int64(1),
+		    int64(72623859790382856),
+		  ],
+		}`,
+	},
+	{
+		name: "InvalidNumber",
+		expectedB: []byte{
+			0x20, 0x00, 0x00, 0x00, // MessageLength
+			0x05, 0x00, 0x00, 0x00, // RequestID
+			0x00, 0x00, 0x00, 0x00, // ResponseTo
+			0xd7, 0x07, 0x00, 0x00, // OpCode
+
+			0x00, 0x00, 0x00, 0x00, // ZERO
+			0x02, 0x00, 0x00, 0x00, // NumberOfCursorIDs
+			0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // CursorID
+		},
+		err: "len=16, numberOfCursorIDs=2",
+	},
+}
+
+func TestKillCursors(t *testing.T) {
+	t.Parallel()
+	testMessages(t, killCursorsTestCases)
+}
+
+func FuzzKillCursors(f *testing.F) {
+	fuzzMessages(f, killCursorsTestCases)
+}
@@ -17,6 +17,8 @@ package wire
 import (
 	"encoding/binary"
 	"fmt"
+	"iter"
+	"slices"
 
 	"github.com/FerretDB/wire/internal/util/lazyerrors"
 	"github.com/FerretDB/wire/internal/util/must"
@@ -32,12 +34,14 @@ type OpMsg struct {
 	// The order of fields is weird to make the struct smaller due to alignment.
 	// The wire order is: flags, sections, optional checksum.
 
-	sections []opMsgSection
-	Flags    OpMsgFlags
-	checksum uint32
+	sections         []opMsgSection
+	Flags            OpMsgFlags
+	checksum         uint32
+	checksumVerified bool
 }
 
 // NewOpMsg creates a message with a single section of kind 0 with a single document.
+// Sections of kind 1 could be added with [OpMsg.AddSequence].
 func NewOpMsg(doc wirebson.AnyDocument) (*OpMsg, error) {
 	raw, err := doc.Encode()
 	if err != nil {
@@ -73,6 +77,44 @@ func MustOpMsg(pairs ...any) *OpMsg {
 	return msg
 }
 
+// AddSequence adds a section of kind 1 (document sequence) with the given identifier and documents.
+//
+// The identifier must be unique for the message.
+func (msg *OpMsg) AddSequence(identifier string, docs []wirebson.AnyDocument) error {
+	section := opMsgSection{
+		kind:       1,
+		identifier: identifier,
+		documents:  make([]wirebson.RawDocument, len(docs)),
+	}
+
+	for i, doc := range docs {
+		raw, err := doc.Encode()
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		section.documents[i] = raw
+	}
+
+	sections := append(slices.Clip(msg.sections), section)
+
+	if err := checkSections(sections); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if Debug {
+		for _, d := range section.documents {
+			if _, err := d.DecodeDeep(); err != nil {
+				return lazyerrors.Error(err)
+			}
+		}
+	}
+
+	msg.sections = sections
+
+	return nil
+}
+
 // msgbody implements [MsgBody].
 func (msg *OpMsg) msgbody() {}
 
@@ -177,8 +219,7 @@ func (msg *OpMsg) UnmarshalBinaryNocopy(b []byte) error {
 	}
 
 	if msg.Flags.FlagSet(OpMsgChecksumPresent) {
-		// Move checksum validation here. It needs header data to be available.
-		// TODO https://github.com/FerretDB/FerretDB/issues/2690
+		// it is verified by ReadMessage that has header data
 		msg.checksum = binary.LittleEndian.Uint32(b[offset:])
 	}
 
@@ -259,8 +300,7 @@ func (msg *OpMsg) MarshalBinary() ([]byte, error) {
 	}
 
 	if msg.Flags.FlagSet(OpMsgChecksumPresent) {
-		// Calculate checksum before writing it. It needs header data to be ready and available here.
-		// TODO https://github.com/FerretDB/FerretDB/issues/2690
+		// it is (re)computed by WriteMessage that has header data
 		var checksum [4]byte
 		binary.LittleEndian.PutUint32(checksum[:], msg.checksum)
 		b = append(b, checksum[:]...)
@@ -382,6 +422,38 @@ func (msg *OpMsg) Sections() (*wirebson.Document, wirebson.RawDocument, []byte,
 	return doc, spec, seq, nil
 }
 
+// Sequence returns raw documents of the section of kind 1 with the given identifier,
+// or nil if there is no such section.
+func (msg *OpMsg) Sequence(identifier string) []wirebson.RawDocument {
+	for _, s := range msg.sections {
+		if s.kind == 1 && s.identifier == identifier {
+			return s.documents
+		}
+	}
+
+	return nil
+}
+
+// Sequences returns an iterator over identifiers and raw documents of all sections of kind 1.
+func (msg *OpMsg) Sequences() iter.Seq2[string, []wirebson.RawDocument] {
+	return func(yield func(string, []wirebson.RawDocument) bool) {
+		for _, s := range msg.sections {
+			if s.kind != 1 {
+				continue
+			}
+
+			if !yield(s.identifier, s.documents) {
+				return
+			}
+		}
+	}
+}
+
+// ChecksumVerified returns true if the message had a checksum that was verified by [ReadMessage].
+func (msg *OpMsg) ChecksumVerified() bool {
+	return msg.checksumVerified
+}
+
 // logMessage returns a string representation for logging.
 func (msg *OpMsg) logMessage(logFunc func(v any) string) string {
 	if msg == nil {
@@ -37,7 +37,7 @@ func checkSections(sections []opMsgSection) error {
 
 	var kind0Found bool
 
-	for _, s := range sections {
+	for i, s := range sections {
 		switch s.kind {
 		case 0:
 			if kind0Found {
@@ -58,6 +58,13 @@ func checkSections(sections []opMsgSection) error {
 				return lazyerrors.New("kind 1 section has no identifier")
 			}
 
+			// there are only a few sections, so that is faster than a map
+			for _, prev := range sections[:i] {
+				if prev.identifier == s.identifier {
+					return lazyerrors.Errorf("duplicate kind 1 section identifier %q", s.identifier)
+				}
+			}
+
 		default:
 			return lazyerrors.Errorf("unknown kind %d", s.kind)
 		}
@@ -15,9 +15,17 @@
 package wire
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
 	"math"
+	"slices"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/FerretDB/wire/internal/util/testutil"
 	"github.com/FerretDB/wire/wirebson"
 )
@@ -472,7 +480,8 @@ var msgTestCases = []testCase{
 					)},
 				},
 			},
-			checksum: 1737537506,
+			checksum:         1737537506,
+			checksumVerified: true,
 		},
 		command: "insert",
 		si: `
@@ -581,7 +590,8 @@ var msgTestCases = []testCase{
 					)},
 				},
 			},
-			checksum: 2932997361,
+			checksum:         2932997361,
+			checksumVerified: true,
 		},
 		command: "update",
 		si: `
@@ -650,33 +660,6 @@ var msgTestCases = []testCase{
 
 			0xe2, 0xb7, 0x90, 0x67, // invalid checksum value
 		},
-		msgHeader: &MsgHeader{
-			MessageLength: 119,
-			RequestID:     15,
-			ResponseTo:    0,
-			OpCode:        OpCodeMsg,
-		},
-		msgBody: &OpMsg{
-			Flags: OpMsgFlags(OpMsgChecksumPresent),
-			sections: []opMsgSection{
-				{
-					kind:       1,
-					identifier: "documents",
-					documents: []wirebson.RawDocument{makeRawDocument(
-						"_id", wirebson.ObjectID{0x63, 0x8c, 0xec, 0x46, 0xaa, 0x77, 0x8b, 0xf3, 0x70, 0x10, 0x54, 0x29},
-						"a", float64(3),
-					)},
-				},
-				{
-					documents: []wirebson.RawDocument{makeRawDocument(
-						"insert", "fooo",
-						"ordered", true,
-						"$db", "test",
-					)},
-				},
-			},
-			checksum: 1737537506,
-		},
 		err: "OP_MSG checksum does not match contents.",
 	},
 }
@@ -689,3 +672,134 @@ func TestMsg(t *testing.T) {
 func FuzzMsg(f *testing.F) {
 	fuzzMessages(f, msgTestCases)
 }
+
+func TestMsgSequences(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Build", func(t *testing.T) {
+		t.Parallel()
+
+		msg, err := NewOpMsg(wirebson.MustDocument(
+			"insert", "TestInsertSimple",
+			"ordered", true,
+			"$db", "testinsertsimple",
+		))
+		require.NoError(t, err)
+
+		err = msg.AddSequence("documents", []wirebson.AnyDocument{wirebson.MustDocument(
+			"_id", wirebson.ObjectID{0x63, 0x7c, 0xfa, 0xd8, 0x8d, 0xc3, 0xce, 0xcd, 0xe3, 0x8e, 0x1e, 0x6b},
+			"v", math.Copysign(0, -1),
+		)})
+		require.NoError(t, err)
+
+		i := slices.IndexFunc(msgTestCases, func(tc testCase) bool { return tc.name == "negative zero" })
+		require.NotEqual(t, -1, i)
+		assert.Equal(t, msgTestCases[i].msgBody, msg)
+
+		expected := []wirebson.RawDocument{makeRawDocument(
+			"_id", wirebson.ObjectID{0x63, 0x7c, 0xfa, 0xd8, 0x8d, 0xc3, 0xce, 0xcd, 0xe3, 0x8e, 0x1e, 0x6b},
+			"v", math.Copysign(0, -1),
+		)}
+		assert.Equal(t, expected, msg.Sequence("documents"))
+		assert.Nil(t, msg.Sequence("updates"))
+
+		var identifiers []string
+		for identifier, docs := range msg.Sequences() {
+			identifiers = append(identifiers, identifier)
+			assert.Equal(t, expected, docs)
+		}
+		assert.Equal(t, []string{"documents"}, identifiers)
+
+		_, err = msg.DocumentRaw()
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+
+		msg := MustOpMsg("update", "test", "$db", "test")
+
+		err := msg.AddSequence("", nil)
+		require.Error(t, err)
+		assert.Equal(t, "kind 1 section has no identifier", lastErr(err).Error())
+
+		require.NoError(t, msg.AddSequence("updates", nil))
+
+		err = msg.AddSequence("updates", []wirebson.AnyDocument{wirebson.MustDocument("q", wirebson.MustDocument())})
+		require.Error(t, err)
+		assert.Equal(t, `duplicate kind 1 section identifier "updates"`, lastErr(err).Error())
+
+		assert.Equal(t, []wirebson.RawDocument{}, msg.Sequence("updates"))
+	})
+}
+
+func TestMsgChecksum(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Compute", func(t *testing.T) {
+		t.Parallel()
+
+		i := slices.IndexFunc(msgTestCases, func(tc testCase) bool { return tc.name == "MultiSectionInsert" })
+		require.NotEqual(t, -1, i)
+		tc := msgTestCases[i]
+
+		// checksum is not set for new messages
+		body := *tc.msgBody.(*OpMsg)
+		body.checksum = 0
+		body.checksumVerified = false
+
+		var buf bytes.Buffer
+		bufw := bufio.NewWriter(&buf)
+		require.NoError(t, WriteMessage(bufw, tc.msgHeader, &body))
+		require.NoError(t, bufw.Flush())
+		assert.Equal(t, tc.expectedB, buf.Bytes())
+
+		_, actual, err := ReadMessage(bufio.NewReader(&buf))
+		require.NoError(t, err)
+		assert.True(t, actual.(*OpMsg).ChecksumVerified())
+	})
+
+	t.Run("New", func(t *testing.T) {
+		t.Parallel()
+
+		body := MustOpMsg("ping", int32(1), "$db", "admin")
+		body.Flags |= OpMsgFlags(OpMsgChecksumPresent)
+
+		header := &MsgHeader{
+			MessageLength: int32(body.Size() + MsgHeaderLen),
+			RequestID:     42,
+			OpCode:        OpCodeMsg,
+		}
+
+		var buf bytes.Buffer
+		bufw := bufio.NewWriter(&buf)
+		require.NoError(t, WriteMessage(bufw, header, body))
+		require.NoError(t, bufw.Flush())
+
+		b := buf.Bytes()
+		expected := crc32.Checksum(b[:len(b)-crc32.Size], crc32.MakeTable(crc32.Castagnoli))
+		assert.Equal(t, expected, binary.LittleEndian.Uint32(b[len(b)-crc32.Size:]))
+
+		_, actual, err := ReadMessage(bufio.NewReader(&buf))
+		require.NoError(t, err)
+		assert.True(t, actual.(*OpMsg).ChecksumVerified())
+
+		doc, err := actual.(*OpMsg).Document()
+		require.NoError(t, err)
+		assert.Equal(t, "ping", doc.Command())
+	})
+
+	t.Run("Absent", func(t *testing.T) {
+		t.Parallel()
+
+		i := slices.IndexFunc(msgTestCases, func(tc testCase) bool { return tc.name == "handshake5" })
+		require.NotEqual(t, -1, i)
+		tc := msgTestCases[i]
+
+		b := append(bytes.Clone(tc.headerB), tc.bodyB...)
+
+		_, actual, err := ReadMessage(bufio.NewReader(bytes.NewReader(b)))
+		require.NoError(t, err)
+		assert.False(t, actual.(*OpMsg).ChecksumVerified())
+	})
+}
@@ -0,0 +1,247 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// OpUpdate represents the deprecated OP_UPDATE wire protocol message type.
+// It stores BSON documents in the raw form.
+//
+// Message is checked during construction by [NewOpUpdate] or [OpUpdate.UnmarshalBinaryNocopy]
+// without decoding BSON documents inside.
+type OpUpdate struct {
+	// The order of fields is weird to make the struct smaller due to alignment.
+	// The wire order is: reserved zero, collection name, flags, selector, update.
+
+	FullCollectionName string
+	selector           wirebson.RawDocument
+	update             wirebson.RawDocument
+	Flags              OpUpdateFlags
+}
+
+// NewOpUpdate creates a new OpUpdate message.
+func NewOpUpdate(selector, updateDoc wirebson.AnyDocument) (*OpUpdate, error) {
+	selectorRaw, err := selector.Encode()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	updateRaw, err := updateDoc.Encode()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	update := &OpUpdate{
+		selector: selectorRaw,
+		update:   updateRaw,
+	}
+
+	if Debug {
+		if err = update.check(); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	return update, nil
+}
+
+func (update *OpUpdate) msgbody() {}
+
+// check implements [MsgBody].
+func (update *OpUpdate) check() error {
+	if _, err := update.selector.DecodeDeep(); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if _, err := update.update.DecodeDeep(); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// UnmarshalBinaryNocopy implements [MsgBody].
+func (update *OpUpdate) UnmarshalBinaryNocopy(b []byte) error {
+	if len(b) < 4 {
+		return lazyerrors.Errorf("len=%d", len(b))
+	}
+
+	if zero := binary.LittleEndian.Uint32(b[0:4]); zero != 0 {
+		return lazyerrors.Errorf("ZERO=%d", zero)
+	}
+
+	var err error
+
+	update.FullCollectionName, err = wirebson.DecodeCString(b[4:])
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	flagsLow := 4 + wirebson.SizeCString(update.FullCollectionName)
+	if len(b) < flagsLow+4 {
+		return lazyerrors.Errorf("len=%d, can't unmarshal flags", len(b))
+	}
+
+	update.Flags = OpUpdateFlags(binary.LittleEndian.Uint32(b[flagsLow : flagsLow+4]))
+
+	selectorLow := flagsLow + 4
+
+	l, err := wirebson.FindRaw(b[selectorLow:])
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+	update.selector = b[selectorLow : selectorLow+l]
+
+	updateLow := selectorLow + l
+
+	if l, err = wirebson.FindRaw(b[updateLow:]); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if len(b) != updateLow+l {
+		return lazyerrors.Errorf("len=%d, expected=%d", len(b), updateLow+l)
+	}
+	update.update = b[updateLow:]
+
+	if Debug {
+		if err = update.check(); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// Size implements [MsgBody].
+func (update *OpUpdate) Size() int {
+	return 8 + wirebson.SizeCString(update.FullCollectionName) + len(update.selector) + len(update.update)
+}
+
+// MarshalBinary implements [MsgBody].
+func (update *OpUpdate) MarshalBinary() ([]byte, error) {
+	b := make([]byte, update.Size())
+
+	nameHigh := 4 + wirebson.SizeCString(update.FullCollectionName)
+	wirebson.EncodeCString(b[4:nameHigh], update.FullCollectionName)
+
+	binary.LittleEndian.PutUint32(b[nameHigh:nameHigh+4], uint32(update.Flags))
+
+	selectorHigh := nameHigh + 4 + len(update.selector)
+	copy(b[nameHigh+4:selectorHigh], update.selector)
+	copy(b[selectorHigh:], update.update)
+
+	return b, nil
+}
+
+// Selector returns decoded selector document.
+// It may be shallowly or deeply decoded.
+func (update *OpUpdate) Selector() (*wirebson.Document, error) {
+	doc, err := update.selector.Decode()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return doc, nil
+}
+
+// SelectorDeep returns deeply decoded selector document.
+func (update *OpUpdate) SelectorDeep() (*wirebson.Document, error) {
+	doc, err := update.selector.DecodeDeep()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return doc, nil
+}
+
+// SelectorRaw returns raw selector document.
+func (update *OpUpdate) SelectorRaw() wirebson.RawDocument {
+	return update.selector
+}
+
+// Update returns decoded update document.
+// It may be shallowly or deeply decoded.
+func (update *OpUpdate) Update() (*wirebson.Document, error) {
+	doc, err := update.update.Decode()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return doc, nil
+}
+
+// UpdateDeep returns deeply decoded update document.
+func (update *OpUpdate) UpdateDeep() (*wirebson.Document, error) {
+	doc, err := update.update.DecodeDeep()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return doc, nil
+}
+
+// UpdateRaw returns raw update document.
+func (update *OpUpdate) UpdateRaw() wirebson.RawDocument {
+	return update.update
+}
+
+// logMessage returns a string representation for logging.
+func (update *OpUpdate) logMessage(logFunc func(v any) string) string {
+	if update == nil {
+		return "<nil>"
+	}
+
+	m := wirebson.MustDocument(
+		"FullCollectionName", update.FullCollectionName,
+		"Flags", update.Flags.String(),
+	)
+
+	doc, err := update.SelectorDeep()
+	if err == nil {
+		must.NoError(m.Add("Selector", doc))
+	} else {
+		must.NoError(m.Add("SelectorError", err.Error()))
+	}
+
+	doc, err = update.UpdateDeep()
+	if err == nil {
+		must.NoError(m.Add("Update", doc))
+	} else {
+		must.NoError(m.Add("UpdateError", err.Error()))
+	}
+
+	return logFunc(m)
+}
+
+// String returns an string representation for logging.
+func (update *OpUpdate) String() string {
+	return update.logMessage(wirebson.LogMessage)
+}
+
+// StringIndent returns an indented string representation for logging.
+func (update *OpUpdate) StringIndent() string {
+	return update.logMessage(wirebson.LogMessageIndent)
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpUpdate)(nil)
+)
@@ -0,0 +1,110 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"testing"
+
+	"github.com/FerretDB/wire/wirebson"
+)
+
+var updateTestCases = []testCase{
+	{
+		name: "UpsertMulti",
+		expectedB: []byte{
+			0x46, 0x00, 0x00, 0x00, // MessageLength
+			0x02, 0x00, 0x00, 0x00, // RequestID
+			0x00, 0x00, 0x00, 0x00, // ResponseTo
+			0xd1, 0x07, 0x00, 0x00, // OpCode
+
+			0x00, 0x00, 0x00, 0x00, // ZERO
+			0x74, 0x65, 0x73, 0x74, 0x2e, 0x66, 0x6f, 0x6f, 0x00, // FullCollectionName "test.foo"
+			0x03, 0x00, 0x00, 0x00, // Flags
+
+			0x0e, 0x00, 0x00, 0x00, // document size
+			0x10, 0x5f, 0x69, 0x64, 0x00, // int32 "_id"
+			0x01, 0x00, 0x00, 0x00, // 1
+			0x00, // end of document
+
+			0x17, 0x00, 0x00, 0x00, // document size
+			0x03, 0x24, 0x73, 0x65, 0x74, 0x00, // document "$set"
+			0x0c, 0x00, 0x00, 0x00, // document size
+			0x10, 0x76, 0x00, // int32 "v"
+			0x02, 0x00, 0x00, 0x00, // 2
+			0x00, // end of document
+			0x00, // end of document
+		},
+		msgHeader: &MsgHeader{
+			MessageLength: 70,
+			RequestID:     2,
+			OpCode:        OpCodeUpdate,
+		},
+		msgBody: &OpUpdate{
+			FullCollectionName: "test.foo",
+			Flags:              OpUpdateFlags(OpUpdateUpsert | OpUpdateMultiUpdate),
+			selector:           makeRawDocument("_id", int32(1)),
+			update:             makeRawDocument("$set", wirebson.MustDocument("v", int32(2))),
+		},
+		si: `
+		{
+		  "FullCollectionName": "test.foo",
+		  "Flags": "[Upsert|MultiUpdate]",
+		  "Selector": {
+		    "_id": 1,
+		  },
+		  "Update": {
+		    "$set": {
+		      "v": 2,
+		    },
+		  },
+		}`,
+	},
+	{
+		name: "NonZero",
+		expectedB: []byte{
+			0x46, 0x00, 0x00, 0x00, // MessageLength
+			0x02, 0x00, 0x00, 0x00, // RequestID
+			0x00, 0x00, 0x00, 0x00, // ResponseTo
+			0xd1, 0x07, 0x00, 0x00, // OpCode
+
+			0x01, 0x00, 0x00, 0x00, // ZERO
+			0x74, 0x65, 0x73, 0x74, 0x2e, 0x66, 0x6f, 0x6f, 0x00, // FullCollectionName "test.foo"
+			0x03, 0x00, 0x00, 0x00, // Flags
+
+			0x0e, 0x00, 0x00, 0x00, // document size
+			0x10, 0x5f, 0x69, 0x64, 0x00, // int32 "_id"
+			0x01, 0x00, 0x00, 0x00, // 1
+			0x00, // end of document
+
+			0x17, 0x00, 0x00, 0x00, // document size
+			0x03, 0x24, 0x73, 0x65, 0x74, 0x00, // document "$set"
+			0x0c, 0x00, 0x00, 0x00, // document size
+			0x10, 0x76, 0x00, // int32 "v"
+			0x02, 0x00, 0x00, 0x00, // 2
+			0x00, // end of document
+			0x00, // end of document
+		},
+		err: "ZERO=1",
+	},
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+	testMessages(t, updateTestCases)
+}
+
+func FuzzUpdate(f *testing.F) {
+	fuzzMessages(f, updateTestCases)
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"io"
+	"sync"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+)
+
+// maxPooledBufferSize is the maximum capacity of a buffer returned to the pool.
+// Larger buffers are left for the garbage collector so rare huge messages do not pin memory.
+const maxPooledBufferSize = 1024 * 1024
+
+// bufferPool contains *[]byte buffers for message bodies.
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// messagePool contains *Message values.
+var messagePool = sync.Pool{
+	New: func() any {
+		return new(Message)
+	},
+}
+
+// Message represents a wire protocol message returned by [Reader.Read].
+//
+// Body references a pooled buffer;
+// neither Body nor any documents or slices obtained from it may be used after [Message.Release].
+type Message struct {
+	Body   MsgBody
+	buf    *[]byte
+	Header MsgHeader
+}
+
+// Release returns message's buffers to the pool.
+// Message must not be used after that.
+//
+// It is safe to call Release on nil message.
+func (m *Message) Release() {
+	if m == nil {
+		return
+	}
+
+	if m.buf != nil && cap(*m.buf) <= maxPooledBufferSize {
+		*m.buf = (*m.buf)[:0]
+		bufferPool.Put(m.buf)
+	}
+
+	*m = Message{}
+	messagePool.Put(m)
+}
+
+// Reader reads wire protocol messages into pooled buffers.
+//
+// Compared to [ReadMessage], it does not allocate buffers for headers and bodies in the steady state,
+// but the caller must call [Message.Release] for every returned message.
+//
+// It is not safe for concurrent use.
+type Reader struct {
+	r         io.Reader
+	maxMsgLen int
+	header    [MsgHeaderLen]byte
+}
+
+// NewReader creates a new Reader for the given reader.
+//
+// Messages with length greater than maxMsgLen (including header) are rejected.
+// If maxMsgLen is zero or negative, [MaxMsgLen] is used.
+// The reader should be buffered (for example, with [bufio.Reader]) for performance.
+func NewReader(r io.Reader, maxMsgLen int) *Reader {
+	if maxMsgLen <= 0 {
+		maxMsgLen = MaxMsgLen
+	}
+
+	return &Reader{
+		r:         r,
+		maxMsgLen: maxMsgLen,
+	}
+}
+
+// Read reads the next message.
+//
+// OP_COMPRESSED messages are decompressed transparently, as with [ReadMessage].
+// The returned message should be released by the caller with [Message.Release].
+//
+// Error is (possibly wrapped) [ErrZeroRead] if zero bytes was read.
+func (r *Reader) Read() (*Message, error) {
+	if err := readHeader(r.r, r.header[:]); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := messagePool.Get().(*Message)
+
+	if err := m.Header.unmarshal(r.header[:], r.maxMsgLen); err != nil {
+		m.Release()
+		return nil, lazyerrors.Error(err)
+	}
+
+	m.buf = bufferPool.Get().(*[]byte)
+
+	l := int(m.Header.MessageLength) - MsgHeaderLen
+	if cap(*m.buf) < l {
+		*m.buf = make([]byte, l)
+	}
+
+	b := (*m.buf)[:l]
+
+	if n, err := io.ReadFull(r.r, b); err != nil {
+		m.Release()
+		return nil, lazyerrors.Errorf("expected %d, read %d: %w", l, n, err)
+	}
+
+	var err error
+	if m.Body, err = readBody(&m.Header, b, r.maxMsgLen); err != nil {
+		m.Release()
+		return nil, lazyerrors.Error(err)
+	}
+
+	return m, nil
+}
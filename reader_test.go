@@ -0,0 +1,195 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readerTestCases returns all message test cases.
+func readerTestCases() []testCase {
+	return slices.Concat(
+		msgTestCases, queryTestCases, replyTestCases,
+		insertTestCases, updateTestCases, deleteTestCases, getMoreTestCases, killCursorsTestCases,
+	)
+}
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range readerTestCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.setExpectedB(t)
+
+			br := bytes.NewReader(tc.expectedB)
+			r := NewReader(bufio.NewReader(br), 0)
+
+			m, err := r.Read()
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Equal(t, tc.err, lastErr(err).Error())
+				require.Nil(t, m)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			require.Equal(t, *tc.msgHeader, m.Header)
+			require.Equal(t, tc.msgBody, m.Body)
+
+			m.Release()
+
+			_, err = r.Read()
+			require.ErrorIs(t, err, ErrZeroRead)
+		})
+	}
+}
+
+func TestReaderStream(t *testing.T) {
+	t.Parallel()
+
+	var expected []MsgBody
+	var buf bytes.Buffer
+
+	for _, tc := range readerTestCases() {
+		if tc.err != "" {
+			continue
+		}
+
+		tc.setExpectedB(t)
+
+		expected = append(expected, tc.msgBody)
+		buf.Write(tc.expectedB)
+	}
+
+	r := NewReader(bufio.NewReader(&buf), 0)
+
+	for i, body := range expected {
+		m, err := r.Read()
+		require.NoError(t, err, "message %d", i)
+
+		// compare the encoding, not the structure, because of unexported fields like checksumVerified
+		expectedB, err := body.MarshalBinary()
+		require.NoError(t, err)
+
+		actualB, err := m.Body.MarshalBinary()
+		require.NoError(t, err)
+
+		assert.Equal(t, expectedB, actualB, "message %d", i)
+
+		m.Release()
+	}
+
+	_, err := r.Read()
+	require.ErrorIs(t, err, ErrZeroRead)
+}
+
+func TestReaderMaxMsgLen(t *testing.T) {
+	t.Parallel()
+
+	tc := msgTestCases[0]
+	tc.setExpectedB(t)
+
+	r := NewReader(bytes.NewReader(tc.expectedB), len(tc.expectedB))
+	m, err := r.Read()
+	require.NoError(t, err)
+	m.Release()
+
+	r = NewReader(bytes.NewReader(tc.expectedB), len(tc.expectedB)-1)
+	m, err = r.Read()
+	require.Error(t, err)
+	assert.Nil(t, m)
+	assert.False(t, errors.Is(err, ErrZeroRead))
+}
+
+var drain any
+
+func BenchmarkReadMessage(b *testing.B) {
+	for _, tc := range msgTestCases {
+		if tc.err != "" {
+			continue
+		}
+
+		tc.setExpectedB(b)
+
+		b.Run(tc.name, func(b *testing.B) {
+			br := bytes.NewReader(tc.expectedB)
+			bufr := bufio.NewReader(br)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(tc.expectedB)))
+
+			var err error
+			for range b.N {
+				br.Reset(tc.expectedB)
+				bufr.Reset(br)
+
+				_, drain, err = ReadMessage(bufr)
+			}
+
+			b.StopTimer()
+
+			require.NoError(b, err)
+			require.NotNil(b, drain)
+		})
+	}
+}
+
+func BenchmarkReader(b *testing.B) {
+	for _, tc := range msgTestCases {
+		if tc.err != "" {
+			continue
+		}
+
+		tc.setExpectedB(b)
+
+		b.Run(tc.name, func(b *testing.B) {
+			br := bytes.NewReader(tc.expectedB)
+			bufr := bufio.NewReader(br)
+			r := NewReader(bufr, 0)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(tc.expectedB)))
+
+			var m *Message
+			var err error
+			for range b.N {
+				br.Reset(tc.expectedB)
+				bufr.Reset(br)
+
+				m, err = r.Read()
+				if err == nil {
+					drain = m.Body
+					m.Release()
+				}
+			}
+
+			b.StopTimer()
+
+			require.NoError(b, err)
+			require.NotNil(b, drain)
+		})
+	}
+}
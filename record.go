@@ -17,21 +17,30 @@ package wire
 import (
 	"bufio"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/FerretDB/wire/internal/util/lazyerrors"
 )
 
 // Record represents a single recorded wire protocol message, loaded from a .bin file.
+//
+// Files are sequences of messages (header and body) in the wire format; see [RecordWriter].
 type Record struct {
 	// those may be unset if message is invalid
 	Header *MsgHeader
 	Body   MsgBody
 
-	// those are always set
+	// Err is set if message is invalid
+	Err error
+
+	// those are always set, but may be truncated if message is invalid
 	HeaderB []byte
 	BodyB   []byte
 }
@@ -81,6 +90,10 @@ func LoadRecords(dir string, limit int) ([]Record, error) {
 }
 
 // loadRecordFile parses a single .bin file.
+//
+// Malformed messages are returned as records with Err set.
+// Reading continues after a message with a malformed body if its header contains a valid message length;
+// otherwise, the rest of the file is returned as a single malformed record.
 func loadRecordFile(file string) ([]Record, error) {
 	f, err := os.Open(file)
 	if err != nil {
@@ -94,35 +107,263 @@ func loadRecordFile(file string) ([]Record, error) {
 	var res []Record
 
 	for {
-		var header *MsgHeader
-		var body MsgBody
-		if header, body, err = ReadMessage(r); errors.Is(err, ErrZeroRead) {
-			break
+		headerB := make([]byte, MsgHeaderLen)
+
+		var n int
+		n, err = io.ReadFull(r, headerB)
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return res, nil
+
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			res = append(res, Record{
+				HeaderB: headerB[:n],
+				BodyB:   []byte{},
+				Err:     lazyerrors.Errorf("expected %d, read %d: %w", MsgHeaderLen, n, err),
+			})
+
+			return res, nil
+
+		case err != nil:
+			return nil, lazyerrors.Error(err)
 		}
 
-		// we should still set HeaderB and BodyB
-		// TODO https://github.com/FerretDB/FerretDB/issues/1636
-		if err != nil {
-			break
+		var header MsgHeader
+		if headerErr := header.unmarshal(headerB, MaxMsgLen); headerErr != nil {
+			// we can't find the next message without a valid length
+			var rest []byte
+			if rest, err = io.ReadAll(r); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+
+			res = append(res, Record{
+				HeaderB: headerB,
+				BodyB:   rest,
+				Err:     lazyerrors.Error(headerErr),
+			})
+
+			return res, nil
 		}
 
-		var headerB []byte
-		if headerB, err = header.MarshalBinary(); err != nil {
-			return nil, lazyerrors.Error(err)
+		bodyB := make([]byte, header.MessageLength-MsgHeaderLen)
+
+		if n, err = io.ReadFull(r, bodyB); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, lazyerrors.Error(err)
+			}
+
+			res = append(res, Record{
+				Header:  &header,
+				HeaderB: headerB,
+				BodyB:   bodyB[:n],
+				Err:     lazyerrors.Errorf("expected %d, read %d: %w", len(bodyB), n, err),
+			})
+
+			return res, nil
 		}
 
-		var bodyB []byte
-		if bodyB, err = body.MarshalBinary(); err != nil {
-			return nil, lazyerrors.Error(err)
+		res = append(res, newRecord(&header, headerB, bodyB))
+	}
+}
+
+// newRecord creates a new record for the given message bytes.
+func newRecord(header *MsgHeader, headerB, bodyB []byte) Record {
+	h := *header
+
+	body, err := readBody(&h, bodyB, MaxMsgLen)
+	if err != nil {
+		return Record{
+			Header:  header,
+			HeaderB: headerB,
+			BodyB:   bodyB,
+			Err:     lazyerrors.Error(err),
 		}
+	}
 
-		res = append(res, Record{
+	// OP_COMPRESSED messages are stored decompressed, as returned by ReadMessage
+	rec := Record{
+		Header: &h,
+		Body:   body,
+	}
+
+	if rec.HeaderB, err = h.MarshalBinary(); err == nil {
+		rec.BodyB, err = body.MarshalBinary()
+	}
+
+	if err != nil {
+		return Record{
 			Header:  header,
-			Body:    body,
 			HeaderB: headerB,
 			BodyB:   bodyB,
-		})
+			Err:     lazyerrors.Error(err),
+		}
 	}
 
-	return res, nil
+	return rec
+}
+
+// RecordWriterOpts represents [RecordWriter] options.
+type RecordWriterOpts struct {
+	// Dir is a directory for .bin files; it is created if needed.
+	Dir string
+
+	// MaxFileSize is the size in bytes after which a new file is started.
+	// A single message is never split between files.
+	// Zero means no limit.
+	MaxFileSize int64
+
+	// MaxFiles is the maximum number of files created by this writer that are kept;
+	// the oldest files are removed on rotation.
+	// Zero means no limit.
+	MaxFiles int
+}
+
+// RecordWriter writes wire protocol messages to rotating .bin files in the format read by [LoadRecords].
+//
+// It is safe for concurrent use.
+type RecordWriter struct {
+	opts *RecordWriterOpts
+
+	// m protects f, files, size, and seq
+	f     *os.File
+	files []string
+	m     sync.Mutex
+	size  int64
+	seq   int
+}
+
+// NewRecordWriter creates a new RecordWriter.
+//
+// Files are created lazily on the first write.
+func NewRecordWriter(opts *RecordWriterOpts) (*RecordWriter, error) {
+	if opts == nil || opts.Dir == "" {
+		return nil, lazyerrors.New("directory is not set")
+	}
+
+	if opts.MaxFileSize < 0 || opts.MaxFiles < 0 {
+		return nil, lazyerrors.Errorf("invalid limits: MaxFileSize=%d, MaxFiles=%d", opts.MaxFileSize, opts.MaxFiles)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o777); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &RecordWriter{
+		opts: opts,
+	}, nil
+}
+
+// Write appends a single message, given as raw header and body bytes, to the current file.
+//
+// The bytes are written as-is, so malformed messages (for example, ones that [ReadMessage] can't parse)
+// can be recorded too.
+func (w *RecordWriter) Write(headerB, bodyB []byte) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	n := int64(len(headerB) + len(bodyB))
+
+	if w.f != nil && w.opts.MaxFileSize > 0 && w.size > 0 && w.size+n > w.opts.MaxFileSize {
+		if err := w.closeFile(); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	if w.f == nil {
+		if err := w.openFile(); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	for _, b := range [][]byte{headerB, bodyB} {
+		written, err := w.f.Write(b)
+		w.size += int64(written)
+
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// WriteMessage marshals and appends a single message to the current file.
+//
+// The message is marshaled the same way as [WriteMessage] does, including OP_MSG checksum computation.
+// Unlike [WriteMessage], it returns an error if the header's message length does not match the body.
+func (w *RecordWriter) WriteMessage(header *MsgHeader, body MsgBody) error {
+	if expected := body.Size() + MsgHeaderLen; int32(expected) != header.MessageLength {
+		return lazyerrors.Errorf("expected length %d, got %d", expected, header.MessageLength)
+	}
+
+	bodyB, err := marshalMessage(header, body)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	headerB, err := header.MarshalBinary()
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return w.Write(headerB, bodyB)
+}
+
+// Close closes the current file.
+// Next write will start a new file.
+func (w *RecordWriter) Close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+
+	return w.closeFile()
+}
+
+// openFile creates a new file and removes the oldest files if there are too many.
+//
+// It should be called with held lock.
+func (w *RecordWriter) openFile() error {
+	w.seq++
+	name := fmt.Sprintf("%s-%d-%04d.bin", time.Now().UTC().Format("20060102-150405"), os.Getpid(), w.seq)
+	path := filepath.Join(w.opts.Dir, name)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	w.f = f
+	w.size = 0
+	w.files = append(w.files, path)
+
+	if w.opts.MaxFiles > 0 {
+		for len(w.files) > w.opts.MaxFiles {
+			if err = os.Remove(w.files[0]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return lazyerrors.Error(err)
+			}
+
+			w.files = w.files[1:]
+		}
+	}
+
+	return nil
+}
+
+// closeFile closes the current file.
+//
+// It should be called with held lock.
+func (w *RecordWriter) closeFile() error {
+	err := w.f.Close()
+	w.f = nil
+	w.size = 0
+
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
 }
@@ -0,0 +1,254 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordWriter(t *testing.T) {
+	t.Parallel()
+
+	var cases []testCase
+	for _, tc := range msgTestCases {
+		if tc.err != "" {
+			continue
+		}
+
+		tc.setExpectedB(t)
+		cases = append(cases, tc)
+	}
+
+	t.Run("Roundtrip", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		w, err := NewRecordWriter(&RecordWriterOpts{Dir: dir})
+		require.NoError(t, err)
+
+		for _, tc := range cases {
+			require.NoError(t, w.WriteMessage(tc.msgHeader, tc.msgBody))
+		}
+
+		require.NoError(t, w.Close())
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.bin"))
+		require.NoError(t, err)
+		assert.Len(t, files, 1)
+
+		records, err := LoadRecords(dir, 0)
+		require.NoError(t, err)
+		require.Len(t, records, len(cases))
+
+		for i, tc := range cases {
+			assert.Equal(t, tc.expectedB[:MsgHeaderLen], records[i].HeaderB)
+			assert.Equal(t, tc.expectedB[MsgHeaderLen:], records[i].BodyB)
+			assert.Equal(t, tc.msgHeader, records[i].Header)
+		}
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		// every message gets its own file
+		w, err := NewRecordWriter(&RecordWriterOpts{Dir: dir, MaxFileSize: 1, MaxFiles: 2})
+		require.NoError(t, err)
+
+		for _, tc := range cases {
+			require.NoError(t, w.Write(tc.expectedB[:MsgHeaderLen], tc.expectedB[MsgHeaderLen:]))
+		}
+
+		require.NoError(t, w.Close())
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.bin"))
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+
+		for i, file := range files {
+			var b []byte
+			b, err = os.ReadFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, cases[len(cases)-2+i].expectedB, b)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		w, err := NewRecordWriter(&RecordWriterOpts{Dir: dir})
+		require.NoError(t, err)
+
+		require.NoError(t, w.Write([]byte{0x01, 0x02}, nil))
+		require.NoError(t, w.Close())
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.bin"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+
+		b, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x01, 0x02}, b)
+	})
+
+	t.Run("Checksum", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		w, err := NewRecordWriter(&RecordWriterOpts{Dir: dir})
+		require.NoError(t, err)
+
+		body := MustOpMsg("ping", int32(1), "$db", "admin")
+		body.Flags |= OpMsgFlags(OpMsgChecksumPresent)
+
+		header := &MsgHeader{
+			MessageLength: int32(body.Size() + MsgHeaderLen),
+			RequestID:     42,
+			OpCode:        OpCodeMsg,
+		}
+
+		require.NoError(t, w.WriteMessage(header, body))
+		require.NoError(t, w.Close())
+
+		records, err := LoadRecords(dir, 0)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.NoError(t, records[0].Err)
+		assert.True(t, records[0].Body.(*OpMsg).ChecksumVerified())
+	})
+
+	t.Run("InvalidLength", func(t *testing.T) {
+		t.Parallel()
+
+		w, err := NewRecordWriter(&RecordWriterOpts{Dir: t.TempDir()})
+		require.NoError(t, err)
+
+		body := MustOpMsg("ping", int32(1), "$db", "admin")
+		header := &MsgHeader{
+			MessageLength: int32(body.Size()),
+			OpCode:        OpCodeMsg,
+		}
+
+		require.ErrorContains(t, w.WriteMessage(header, body), "expected length")
+		require.NoError(t, w.Close())
+	})
+
+	t.Run("NoDir", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewRecordWriter(&RecordWriterOpts{})
+		require.Error(t, err)
+	})
+}
+
+func TestLoadRecordsMalformed(t *testing.T) {
+	t.Parallel()
+
+	var valid []testCase
+	for _, tc := range msgTestCases {
+		if tc.err != "" {
+			continue
+		}
+
+		tc.setExpectedB(t)
+		valid = append(valid, tc)
+	}
+
+	require.GreaterOrEqual(t, len(valid), 2)
+
+	first, second := valid[0].expectedB, valid[1].expectedB
+
+	// valid header length, invalid body
+	badBody := append([]byte{}, first[:MsgHeaderLen]...)
+	badBody = append(badBody, make([]byte, len(first)-MsgHeaderLen)...)
+
+	for name, tc := range map[string]struct {
+		b        []byte
+		expected []Record // only HeaderB, BodyB and presence of Err are checked
+	}{
+		"Resync": {
+			b: slices.Concat(first, badBody, second),
+			expected: []Record{
+				{HeaderB: first[:MsgHeaderLen], BodyB: first[MsgHeaderLen:]},
+				{HeaderB: badBody[:MsgHeaderLen], BodyB: badBody[MsgHeaderLen:], Err: errors.New("")},
+				{HeaderB: second[:MsgHeaderLen], BodyB: second[MsgHeaderLen:]},
+			},
+		},
+		"InvalidLength": {
+			b: slices.Concat(first, []byte{0xff, 0xff, 0xff, 0x7f}, second[4:]),
+			expected: []Record{
+				{HeaderB: first[:MsgHeaderLen], BodyB: first[MsgHeaderLen:]},
+				{
+					HeaderB: slices.Concat([]byte{0xff, 0xff, 0xff, 0x7f}, second[4:MsgHeaderLen]),
+					BodyB:   second[MsgHeaderLen:],
+					Err:     errors.New(""),
+				},
+			},
+		},
+		"TruncatedBody": {
+			b: slices.Concat(first, second[:len(second)-1]),
+			expected: []Record{
+				{HeaderB: first[:MsgHeaderLen], BodyB: first[MsgHeaderLen:]},
+				{HeaderB: second[:MsgHeaderLen], BodyB: second[MsgHeaderLen : len(second)-1], Err: errors.New("")},
+			},
+		},
+		"TruncatedHeader": {
+			b: slices.Concat(first, second[:5]),
+			expected: []Record{
+				{HeaderB: first[:MsgHeaderLen], BodyB: first[MsgHeaderLen:]},
+				{HeaderB: second[:5], BodyB: []byte{}, Err: errors.New("")},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "test.bin"), tc.b, 0o666))
+
+			records, err := LoadRecords(dir, 0)
+			require.NoError(t, err)
+			require.Len(t, records, len(tc.expected))
+
+			for i, expected := range tc.expected {
+				actual := records[i]
+
+				assert.Equal(t, expected.HeaderB, actual.HeaderB, "record %d", i)
+				assert.Equal(t, expected.BodyB, actual.BodyB, "record %d", i)
+
+				if expected.Err == nil {
+					assert.NoError(t, actual.Err, "record %d", i)
+					assert.NotNil(t, actual.Header, "record %d", i)
+					assert.NotNil(t, actual.Body, "record %d", i)
+				} else {
+					assert.Error(t, actual.Err, "record %d", i)
+					assert.Nil(t, actual.Body, "record %d", i)
+				}
+			}
+		})
+	}
+}
@@ -1,4 +1,4 @@
-// Code generated by "stringer -linecomment -output stringers.go -type OpCode,OpMsgFlagBit,OpQueryFlagBit,OpReplyFlagBit"; DO NOT EDIT.
+// Code generated by "stringer -linecomment -output stringers.go -type OpCode,OpMsgFlagBit,OpQueryFlagBit,OpReplyFlagBit,OpInsertFlagBit,OpUpdateFlagBit,OpDeleteFlagBit,CompressorID"; DO NOT EDIT.
 
 package wire
 
@@ -150,3 +150,79 @@ func (i OpReplyFlagBit) String() string {
 		return "OpReplyFlagBit(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
 }
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[OpInsertContinueOnError-1]
+}
+
+const _OpInsertFlagBit_name = "ContinueOnError"
+
+var _OpInsertFlagBit_index = [...]uint8{0, 15}
+
+func (i OpInsertFlagBit) String() string {
+	idx := int(i) - 1
+	if i < 1 || idx >= len(_OpInsertFlagBit_index)-1 {
+		return "OpInsertFlagBit(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _OpInsertFlagBit_name[_OpInsertFlagBit_index[idx]:_OpInsertFlagBit_index[idx+1]]
+}
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[OpUpdateUpsert-1]
+	_ = x[OpUpdateMultiUpdate-2]
+}
+
+const _OpUpdateFlagBit_name = "UpsertMultiUpdate"
+
+var _OpUpdateFlagBit_index = [...]uint8{0, 6, 17}
+
+func (i OpUpdateFlagBit) String() string {
+	idx := int(i) - 1
+	if i < 1 || idx >= len(_OpUpdateFlagBit_index)-1 {
+		return "OpUpdateFlagBit(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _OpUpdateFlagBit_name[_OpUpdateFlagBit_index[idx]:_OpUpdateFlagBit_index[idx+1]]
+}
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[OpDeleteSingleRemove-1]
+}
+
+const _OpDeleteFlagBit_name = "SingleRemove"
+
+var _OpDeleteFlagBit_index = [...]uint8{0, 12}
+
+func (i OpDeleteFlagBit) String() string {
+	idx := int(i) - 1
+	if i < 1 || idx >= len(_OpDeleteFlagBit_index)-1 {
+		return "OpDeleteFlagBit(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _OpDeleteFlagBit_name[_OpDeleteFlagBit_index[idx]:_OpDeleteFlagBit_index[idx+1]]
+}
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[CompressorNoop-0]
+	_ = x[CompressorSnappy-1]
+	_ = x[CompressorZlib-2]
+	_ = x[CompressorZstd-3]
+}
+
+const _CompressorID_name = "noopsnappyzlibzstd"
+
+var _CompressorID_index = [...]uint8{0, 4, 10, 14, 18}
+
+func (i CompressorID) String() string {
+	idx := int(i) - 0
+	if i < 0 || idx >= len(_CompressorID_index)-1 {
+		return "CompressorID(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _CompressorID_name[_CompressorID_index[idx]:_CompressorID_index[idx+1]]
+}
@@ -17,7 +17,7 @@
 // [MongoDB wire protocol]: https://www.mongodb.com/docs/manual/reference/mongodb-wire-protocol/
 package wire
 
-//go:generate ./bin/stringer -linecomment -output stringers.go -type OpCode,OpMsgFlagBit,OpQueryFlagBit,OpReplyFlagBit
+//go:generate ./bin/stringer -linecomment -output stringers.go -type OpCode,OpMsgFlagBit,OpQueryFlagBit,OpReplyFlagBit,OpInsertFlagBit,OpUpdateFlagBit,OpDeleteFlagBit,CompressorID
 
 // Debug set to true performs additional slow checks during encoding/decoding that are not normally required.
 // It is exposed mainly to simplify testing.
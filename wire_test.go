@@ -17,6 +17,7 @@ package wire
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"os"
 	"path/filepath"
@@ -220,6 +221,18 @@ func fuzzMessages(f *testing.F, testCases []testCase) {
 			// remove random tail
 			expectedB = b[:len(b)-bufr.Buffered()-br.Len()]
 
+			// OP_COMPRESSED messages are decompressed by ReadMessage
+			if OpCode(binary.LittleEndian.Uint32(expectedB[12:16])) == OpCodeCompressed {
+				expectedB, err = msgHeader.MarshalBinary()
+				require.NoError(t, err)
+
+				var bodyB []byte
+				bodyB, err = msgBody.MarshalBinary()
+				require.NoError(t, err)
+
+				expectedB = append(expectedB, bodyB...)
+			}
+
 			require.NotNil(t, msgHeader)
 			require.NotNil(t, msgBody)
 
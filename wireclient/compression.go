@@ -0,0 +1,172 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"io"
+	"slices"
+	"sync/atomic"
+
+	"github.com/FerretDB/wire"
+)
+
+// compressors maps compressor names used in URIs and handshakes to IDs.
+var compressors = map[string]wire.CompressorID{
+	"snappy": wire.CompressorSnappy,
+	"zlib":   wire.CompressorZlib,
+	"zstd":   wire.CompressorZstd,
+}
+
+// uncompressedCommands contains commands that must never be compressed.
+var uncompressedCommands = []string{
+	"hello",
+	"isMaster",
+	"ismaster",
+	"saslStart",
+	"saslContinue",
+	"getnonce",
+	"authenticate",
+	"createUser",
+	"updateUser",
+	"copydbSaslStart",
+	"copydbgetnonce",
+	"copydb",
+}
+
+// CompressionStats represents compression counters of the connection.
+// Only compressed messages are counted.
+type CompressionStats struct {
+	SentUncompressed     int64 // total size of sent messages before compression
+	SentCompressed       int64 // total size of sent messages after compression
+	ReceivedUncompressed int64 // total size of received messages after decompression
+	ReceivedCompressed   int64 // total size of received messages before decompression
+}
+
+// Saved returns the number of bytes saved by compression in both directions.
+// It may be negative if messages are small.
+func (s CompressionStats) Saved() int64 {
+	return s.SentUncompressed - s.SentCompressed + s.ReceivedUncompressed - s.ReceivedCompressed
+}
+
+// compression represents the compression state of the connection.
+type compression struct {
+	// selected is set by the handshake; nil if compression is not used
+	selected *wire.CompressorID
+
+	// compressors are advertised during the handshake if not set by [HandshakeOpts]
+	compressors []string
+
+	sentUncompressed     atomic.Int64
+	sentCompressed       atomic.Int64
+	receivedUncompressed atomic.Int64
+	receivedCompressed   atomic.Int64
+
+	// zlibLevel is used for zlib compressor
+	zlibLevel int
+}
+
+// countingWriter counts bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements [io.Writer].
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
+
+// selectCompressor selects the first compressor returned by the server that was also advertised by the client.
+// Compression is disabled if there is no such compressor.
+func (c *Conn) selectCompressor(advertised, supported []string) {
+	c.comp.selected = nil
+
+	for _, name := range supported {
+		id, ok := compressors[name]
+		if ok && slices.Contains(advertised, name) {
+			c.comp.selected = &id
+			return
+		}
+	}
+}
+
+// Compressor returns the name of the compressor selected during [Conn.Handshake].
+// It returns empty string if compression is not used.
+func (c *Conn) Compressor() string {
+	if c.comp.selected == nil {
+		return ""
+	}
+
+	return c.comp.selected.String()
+}
+
+// CompressionStats returns compression counters.
+//
+// It is safe to call it concurrently with other methods.
+func (c *Conn) CompressionStats() CompressionStats {
+	return CompressionStats{
+		SentUncompressed:     c.comp.sentUncompressed.Load(),
+		SentCompressed:       c.comp.sentCompressed.Load(),
+		ReceivedUncompressed: c.comp.receivedUncompressed.Load(),
+		ReceivedCompressed:   c.comp.receivedCompressed.Load(),
+	}
+}
+
+// compressor returns the compressor and level that should be used for the given message,
+// or false if the message should not be compressed.
+func (c *Conn) compressor(body wire.MsgBody) (wire.CompressorID, int, bool) {
+	if c.comp.selected == nil {
+		return 0, 0, false
+	}
+
+	var command string
+
+	switch body := body.(type) {
+	case *wire.OpMsg:
+		doc, err := body.Section0()
+		if err != nil {
+			return 0, 0, false
+		}
+
+		command = doc.Command()
+
+	case *wire.OpQuery:
+		doc, err := body.Query()
+		if err != nil {
+			return 0, 0, false
+		}
+
+		command = doc.Command()
+
+	default:
+		return 0, 0, false
+	}
+
+	if slices.Contains(uncompressedCommands, command) {
+		return 0, 0, false
+	}
+
+	id := *c.comp.selected
+
+	level := wire.DefaultCompressionLevel
+	if id == wire.CompressorZlib {
+		level = c.comp.zlibLevel
+	}
+
+	return id, level, true
+}
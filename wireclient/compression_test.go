@@ -0,0 +1,183 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireserver"
+)
+
+func TestConnCompression(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+		require.NoError(t, server.Close())
+	})
+
+	conn := New(client, logger(t))
+
+	// compressible string
+	s := strings.Repeat("compression ", 1000)
+
+	go func() {
+		r := bufio.NewReader(server)
+		w := bufio.NewWriter(server)
+
+		// expected commands and whether they should be compressed
+		for _, expected := range []struct {
+			command    string
+			compressed bool
+		}{
+			{"hello", false},
+			{"insert", true},
+			{"saslStart", false},
+		} {
+			b, err := r.Peek(wire.MsgHeaderLen)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			opCode := wire.OpCode(binary.LittleEndian.Uint32(b[12:16]))
+			assert.Equal(t, expected.compressed, opCode == wire.OpCodeCompressed, expected.command)
+
+			header, body, err := wire.ReadMessage(r)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			doc, err := body.(*wire.OpMsg).DocumentDeep()
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, expected.command, doc.Command())
+
+			var res *wire.OpMsg
+
+			switch expected.command {
+			case "hello":
+				res = wire.MustOpMsg("compression", wirebson.MustArray("zlib"), "ok", float64(1))
+			case "insert":
+				assert.Equal(t, s, doc.Get("s"))
+				res = wire.MustOpMsg("s", s, "ok", float64(1))
+			default:
+				res = wire.MustOpMsg("ok", float64(1))
+			}
+
+			resHeader := &wire.MsgHeader{
+				MessageLength: int32(res.Size() + wire.MsgHeaderLen),
+				RequestID:     header.RequestID + 1000,
+				ResponseTo:    header.RequestID,
+				OpCode:        wire.OpCodeMsg,
+			}
+
+			if expected.compressed {
+				err = wire.WriteMessageCompressed(w, resHeader, res, wire.CompressorZlib, wire.DefaultCompressionLevel)
+			} else {
+				err = wire.WriteMessage(w, resHeader, res)
+			}
+
+			if !assert.NoError(t, err) || !assert.NoError(t, w.Flush()) {
+				return
+			}
+		}
+	}()
+
+	assert.Empty(t, conn.Compressor())
+
+	_, err := conn.Handshake(t.Context(), &HandshakeOpts{Compressors: []string{"zstd", "zlib"}})
+	require.NoError(t, err)
+	assert.Equal(t, "zlib", conn.Compressor())
+	assert.Equal(t, CompressionStats{}, conn.CompressionStats())
+
+	res, err := conn.RequestCommand(t.Context(), wire.MustOpMsg("insert", "test", "s", s, "$db", "test"))
+	require.NoError(t, err)
+	assert.Equal(t, s, res.Get("s"))
+
+	stats := conn.CompressionStats()
+	assert.Greater(t, stats.SentUncompressed, stats.SentCompressed)
+	assert.Greater(t, stats.ReceivedUncompressed, stats.ReceivedCompressed)
+	assert.Greater(t, stats.Saved(), int64(len(s)))
+
+	_, err = conn.RequestCommand(t.Context(), wire.MustOpMsg("saslStart", int32(1), "$db", "admin"))
+	require.NoError(t, err)
+	assert.Equal(t, stats, conn.CompressionStats())
+}
+
+func TestConnectCompressors(t *testing.T) {
+	t.Parallel()
+
+	advertised := make(chan *wirebson.Array, 1)
+
+	mux := wireserver.NewMux()
+
+	mux.RegisterFunc("hello", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		doc, err := req.DocumentDeep()
+		require.NoError(t, err)
+
+		advertised <- doc.Get("compression").(*wirebson.Array)
+
+		return wire.MustOpMsg("compression", wirebson.MustArray("snappy", "zstd"), "ok", float64(1)), nil
+	})
+
+	mux.RegisterFunc("ping", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serve(t, l, mux)
+
+	uri := "mongodb://" + l.Addr().String() + "/?compressors=zstd,zlib&zlibCompressionLevel=9"
+
+	conn, err := Connect(t.Context(), uri, logger(t))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+	})
+
+	assert.Equal(t, 9, conn.comp.zlibLevel)
+
+	_, err = conn.Handshake(t.Context(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, wirebson.MustArray("zstd", "zlib"), <-advertised)
+
+	// the first server's compressor that was advertised by the client
+	assert.Equal(t, "zstd", conn.Compressor())
+
+	require.NoError(t, conn.Ping(t.Context()))
+	assert.Positive(t, conn.CompressionStats().SentCompressed)
+
+	_, err = Connect(t.Context(), "mongodb://"+l.Addr().String()+"/?compressors=lz4", logger(t))
+	require.ErrorContains(t, err, `unsupported compressor "lz4"`)
+
+	_, err = Connect(t.Context(), "mongodb://"+l.Addr().String()+"/?zlibCompressionLevel=10", logger(t))
+	require.ErrorContains(t, err, `invalid value "10" of option "zlibCompressionLevel"`)
+}
@@ -17,21 +17,27 @@ package wireclient
 import (
 	"bufio"
 	"context"
+	"crypto/md5"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
+	"iter"
 	"log/slog"
 	"net"
 	"net/url"
 	"os"
 	"slices"
-	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/xdg-go/scram"
 
 	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/must"
 	"github.com/FerretDB/wire/wirebson"
 )
 
@@ -46,120 +52,205 @@ type Conn struct {
 	r *bufio.Reader
 	w *bufio.Writer
 	l *slog.Logger // debug-level only
+
+	cw *countingWriter // under w
+
+	desc *ServerDescription // set by Handshake
+
+	comp compression
+
+	checksum bool
 }
 
 // New wraps the given connection.
 //
 // The passed logger will be used only for debug-level messages.
 func New(c net.Conn, l *slog.Logger) *Conn {
+	cw := &countingWriter{w: c}
+
 	return &Conn{
-		c: c,
-		r: bufio.NewReader(c),
-		w: bufio.NewWriter(c),
-		l: l,
+		c:  c,
+		r:  bufio.NewReader(c),
+		w:  bufio.NewWriter(cw),
+		cw: cw,
+		l:  l,
+		comp: compression{
+			zlibLevel: wire.DefaultCompressionLevel,
+		},
 	}
 }
 
-// Connect creates a new connection for the given MongoDB URI. See [Credentials].
+// SetChecksum enables or disables adding CRC-32C checksums to OP_MSG requests sent by [Conn.Request].
+func (c *Conn) SetChecksum(enabled bool) {
+	c.checksum = enabled
+}
+
+// Connect creates a new connection for the given MongoDB URI. See [ResolveURI] and [Credentials].
+//
+// Credentials must be absent; database, authentication, and other options are not used by Connect.
+// Hosts of the seed list are tried in order until one accepts the connection.
+// `compressors` and `zlibCompressionLevel` options are used by [Conn.Handshake].
+// TLS options have effect only if `tls` is true.
+// Unknown options are ignored.
+//
+// For `mongodb+srv` scheme, `tls` defaults to true, and seedlist discovery is performed by [ResolveURI]:
+// SRV targets are tried in order, and TXT record options are merged and validated.
 //
 // Context can be used to cancel the connection attempt.
 // Canceling the context after the connection is established has no effect.
 //
 // The passed logger will be used only for debug-level messages.
 func Connect(ctx context.Context, uri string, l *slog.Logger) (*Conn, error) {
-	u, err := url.Parse(uri)
+	u, err := ResolveURI(ctx, uri, nil)
 	if err != nil {
 		return nil, fmt.Errorf("wireclient.Connect: %w", err)
 	}
 
-	if u.Scheme == "mongodb+srv" {
-		if err = lookupSrvURI(ctx, u); err != nil {
-			return nil, fmt.Errorf("wireclient.Connect: %w", err)
-		}
+	if u.Credentials != nil {
+		return nil, fmt.Errorf("wireclient.Connect: credentials must be absent")
 	}
 
-	if u.Scheme != "mongodb" {
-		return nil, fmt.Errorf("wireclient.Connect: invalid scheme %q", u.Scheme)
+	if len(u.UnknownOptions) > 0 {
+		l.DebugContext(ctx, "Unknown options are ignored", slog.Any("options", u.UnknownOptions))
 	}
 
-	if u.Opaque != "" {
-		return nil, fmt.Errorf("wireclient.Connect: invalid URI %q", uri)
-	}
+	for _, f := range []string{u.TLSCAFile, u.TLSCertificateKeyFile} {
+		if f == "" {
+			continue
+		}
 
-	if u.User != nil {
-		return nil, fmt.Errorf("wireclient.Connect: credentials must be absent")
+		if _, err = os.Stat(f); err != nil {
+			return nil, fmt.Errorf("wireclient.Connect: %w", err)
+		}
 	}
 
-	if u.Path != "/" {
-		return nil, fmt.Errorf("wireclient.Connect: unsupported path %q", u.Path)
+	for _, name := range u.Compressors {
+		if _, ok := compressors[name]; !ok {
+			return nil, fmt.Errorf("wireclient.Connect: unsupported compressor %q", name)
+		}
 	}
 
-	if _, _, err = net.SplitHostPort(u.Host); err != nil {
-		return nil, fmt.Errorf("wireclient.Connect: %w", err)
-	}
+	l.DebugContext(ctx, "Connecting", slog.String("uri", uri))
 
-	var tlsParam bool
-	var tlsCaFileParam string
+	dial := (&net.Dialer{}).DialContext
 
-	for k, vs := range u.Query() {
-		switch k {
-		case "replicaSet":
-			// safe to ignore
+	if u.TLS {
+		var config tls.Config
 
-		case "tls":
-			if len(vs) != 1 {
-				return nil, fmt.Errorf("wireclient.Connect: query parameter %q must have exactly one value", k)
+		if u.TLSCAFile != "" {
+			var b []byte
+			if b, err = os.ReadFile(u.TLSCAFile); err != nil {
+				return nil, fmt.Errorf("wireclient.Connect: %w", err)
 			}
 
-			if tlsParam, err = strconv.ParseBool(vs[0]); err != nil {
-				return nil, fmt.Errorf("wireclient.Connect: query parameter %q has invalid value %q", k, vs[0])
+			ca := x509.NewCertPool()
+			if ok := ca.AppendCertsFromPEM(b); !ok {
+				return nil, fmt.Errorf("wireclient.Connect: failed to parse tlsCaFile")
 			}
 
-		case "tlsCaFile":
-			if len(vs) != 1 {
-				return nil, fmt.Errorf("wireclient.Connect: query parameter %q must have exactly one value", k)
+			config.RootCAs = ca
+		}
+
+		if u.TLSCertificateKeyFile != "" {
+			var cert tls.Certificate
+			if cert, err = loadCertificateKeyFile(u.TLSCertificateKeyFile, u.TLSCertificateKeyFilePassword); err != nil {
+				return nil, fmt.Errorf("wireclient.Connect: %w", err)
 			}
 
-			tlsCaFileParam = vs[0]
-			if _, err = os.Stat(tlsCaFileParam); err != nil {
-				return nil, fmt.Errorf("wireclient.Connect: query parameter %q error %w", k, err)
+			config.Certificates = []tls.Certificate{cert}
+		}
+
+		switch {
+		case u.TLSInsecure, u.TLSAllowInvalidCertificates:
+			config.InsecureSkipVerify = true
+
+		case u.TLSAllowInvalidHostnames:
+			// verify the certificate chain, but not the hostname
+			config.InsecureSkipVerify = true
+			config.VerifyConnection = func(cs tls.ConnectionState) error {
+				opts := x509.VerifyOptions{
+					Roots:         config.RootCAs,
+					Intermediates: x509.NewCertPool(),
+				}
+
+				for _, cert := range cs.PeerCertificates[1:] {
+					opts.Intermediates.AddCert(cert)
+				}
+
+				_, verr := cs.PeerCertificates[0].Verify(opts)
+				return verr
 			}
+		}
+
+		dial = (&tls.Dialer{Config: &config}).DialContext
+	}
+
+	var c net.Conn
 
-		default:
-			return nil, fmt.Errorf("wireclient.Connect: query parameter %q is not supported", k)
+	for _, host := range u.Hosts {
+		network := "tcp"
+		if strings.HasSuffix(host, ".sock") {
+			network = "unix"
 		}
+
+		if c, err = dial(ctx, network, host); err == nil {
+			conn := New(c, l)
+			conn.comp.compressors = u.Compressors
+			conn.comp.zlibLevel = u.ZlibCompressionLevel
+
+			return conn, nil
+		}
+
+		l.DebugContext(ctx, "Connection failed", slog.String("host", host), slog.String("error", err.Error()))
 	}
 
-	l.DebugContext(ctx, "Connecting", slog.String("uri", uri))
+	return nil, fmt.Errorf("wireclient.Connect: %w", err)
+}
 
-	dial := (&net.Dialer{}).DialContext
+// loadCertificateKeyFile loads the client certificate and private key from the single PEM file.
+// If the password is not empty, it is used to decrypt the private key.
+func loadCertificateKeyFile(file, password string) (tls.Certificate, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("wireclient.loadCertificateKeyFile: %w", err)
+	}
 
-	if tlsParam {
-		var config tls.Config
+	var certPEM, keyPEM []byte
 
-		if tlsCaFileParam != "" {
-			var b []byte
-			if b, err = os.ReadFile(tlsCaFileParam); err != nil {
-				return nil, fmt.Errorf("wireclient.Connect: %w", err)
-			}
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
 
-			ca := x509.NewCertPool()
-			if ok := ca.AppendCertsFromPEM(b); !ok {
-				return nil, fmt.Errorf("wireclient.Connect: failed to parse tlsCaFile")
+		if block.Type == "CERTIFICATE" {
+			certPEM = append(certPEM, pem.EncodeToMemory(block)...)
+			continue
+		}
+
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+
+		//nolint:staticcheck // legacy PEM encryption is what MongoDB tools produce and accept
+		if password != "" && x509.IsEncryptedPEMBlock(block) {
+			var der []byte
+			if der, err = x509.DecryptPEMBlock(block, []byte(password)); err != nil {
+				return tls.Certificate{}, fmt.Errorf("wireclient.loadCertificateKeyFile: %w", err)
 			}
 
-			config.RootCAs = ca
+			block = &pem.Block{Type: block.Type, Bytes: der}
 		}
 
-		dial = (&tls.Dialer{Config: &config}).DialContext
+		keyPEM = pem.EncodeToMemory(block)
 	}
 
-	c, err := dial(ctx, "tcp", u.Host)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
 	if err != nil {
-		return nil, fmt.Errorf("wireclient.Connect: %w", err)
+		return tls.Certificate{}, fmt.Errorf("wireclient.loadCertificateKeyFile: %w", err)
 	}
 
-	return New(c, l), nil
+	return cert, nil
 }
 
 // ConnectPing uses a combination of [Connect] and [Conn.Ping] to establish a working connection.
@@ -211,11 +302,24 @@ func (c *Conn) Read(ctx context.Context) (*wire.MsgHeader, wire.MsgBody, error)
 	d, _ := ctx.Deadline()
 	c.c.SetReadDeadline(d)
 
+	// peek at the header to count compressed messages; errors are returned by ReadMessage below
+	var compressedLength int32
+	if b, _ := c.r.Peek(wire.MsgHeaderLen); len(b) == wire.MsgHeaderLen {
+		if wire.OpCode(binary.LittleEndian.Uint32(b[12:16])) == wire.OpCodeCompressed {
+			compressedLength = int32(binary.LittleEndian.Uint32(b[0:4]))
+		}
+	}
+
 	header, body, err := wire.ReadMessage(c.r)
 	if err != nil {
 		return nil, nil, fmt.Errorf("wireclient.Conn.Read: %w", err)
 	}
 
+	if compressedLength > 0 {
+		c.comp.receivedCompressed.Add(int64(compressedLength))
+		c.comp.receivedUncompressed.Add(int64(header.MessageLength))
+	}
+
 	c.l.DebugContext(
 		ctx,
 		fmt.Sprintf("<<<\n%s", body.StringIndent()),
@@ -245,7 +349,22 @@ func (c *Conn) Write(ctx context.Context, header *wire.MsgHeader, body wire.MsgB
 		c.c.SetWriteDeadline(d)
 	}
 
-	if err := wire.WriteMessage(c.w, header, body); err != nil {
+	id, level, compress := c.compressor(body)
+	if !compress {
+		if err := wire.WriteMessage(c.w, header, body); err != nil {
+			return fmt.Errorf("wireclient.Conn.Write: %w", err)
+		}
+
+		if err := c.w.Flush(); err != nil {
+			return fmt.Errorf("wireclient.Conn.Write: %w", err)
+		}
+
+		return nil
+	}
+
+	written := c.cw.n
+
+	if err := wire.WriteMessageCompressed(c.w, header, body, id, level); err != nil {
 		return fmt.Errorf("wireclient.Conn.Write: %w", err)
 	}
 
@@ -253,6 +372,9 @@ func (c *Conn) Write(ctx context.Context, header *wire.MsgHeader, body wire.MsgB
 		return fmt.Errorf("wireclient.Conn.Write: %w", err)
 	}
 
+	c.comp.sentUncompressed.Add(int64(header.MessageLength))
+	c.comp.sentCompressed.Add(c.cw.n - written)
+
 	return nil
 }
 
@@ -281,32 +403,26 @@ func (c *Conn) WriteRaw(ctx context.Context, b []byte) error {
 //
 // Passed context's deadline is honored if set.
 //
+// If the request is OP_MSG with moreToCome flag set, Request returns nil header and body
+// right after the request is written, because the server does not reply to it.
+// For requests with exhaustAllowed flag set, use [Conn.Stream] instead.
+//
 // It returns errors only for request/response parsing or connection issues.
 // All protocol-level errors are stored inside response.
 func (c *Conn) Request(ctx context.Context, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
-	b, err := body.MarshalBinary()
+	header, body, err := c.prepare(body)
 	if err != nil {
 		return nil, nil, fmt.Errorf("wireclient.Conn.Request: %w", err)
 	}
 
-	header := &wire.MsgHeader{
-		MessageLength: int32(len(b) + wire.MsgHeaderLen),
-		RequestID:     nextRequestID.Add(1),
-	}
-
-	switch body.(type) {
-	case *wire.OpMsg:
-		header.OpCode = wire.OpCodeMsg
-	case *wire.OpQuery:
-		header.OpCode = wire.OpCodeQuery
-	default:
-		return nil, nil, fmt.Errorf("wireclient.Conn.Request:unsupported body type %T", body)
-	}
-
 	if err = c.Write(ctx, header, body); err != nil {
 		return nil, nil, fmt.Errorf("wireclient.Conn.Request: %w", err)
 	}
 
+	if msg, ok := body.(*wire.OpMsg); ok && msg.Flags.FlagSet(wire.OpMsgMoreToCome) {
+		return nil, nil, nil
+	}
+
 	resHeader, resBody, err := c.Read(ctx)
 	if err != nil {
 		return nil, nil, fmt.Errorf("wireclient.Conn.Request: %w", err)
@@ -323,23 +439,140 @@ func (c *Conn) Request(ctx context.Context, body wire.MsgBody) (*wire.MsgHeader,
 	return resHeader, resBody, err
 }
 
-// Ping sends a ping command.
-// It returns error for unexpected server response or any other error.
-func (c *Conn) Ping(ctx context.Context) error {
-	cmd := wire.MustOpMsg("ping", int32(1), "$db", "test")
-
+// RequestCommand sends the given command to the connection
+// and returns the deeply decoded response document.
+//
+// Unlike [Conn.Request], it returns [*CommandError] or [*WriteException]
+// if the response contains them; see [ReplyError].
+func (c *Conn) RequestCommand(ctx context.Context, cmd *wire.OpMsg) (*wirebson.Document, error) {
 	_, resBody, err := c.Request(ctx, cmd)
 	if err != nil {
-		return fmt.Errorf("wireclient.Conn.Ping: %w", err)
+		return nil, fmt.Errorf("wireclient.Conn.RequestCommand: %w", err)
 	}
 
-	res, err := resBody.(*wire.OpMsg).DocumentDeep()
+	resMsg, ok := resBody.(*wire.OpMsg)
+	if !ok {
+		return nil, fmt.Errorf("wireclient.Conn.RequestCommand: unexpected response type %T", resBody)
+	}
+
+	res, err := resMsg.DocumentDeep()
 	if err != nil {
-		return fmt.Errorf("wireclient.Conn.Ping: %w", err)
+		return nil, fmt.Errorf("wireclient.Conn.RequestCommand: %w", err)
+	}
+
+	if err = ReplyError(res); err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.RequestCommand: %w", err)
+	}
+
+	return res, nil
+}
+
+// Stream sends the given request with exhaustAllowed flag set and returns an iterator over replies.
+// The header is generated automatically.
+//
+// The server may send several replies with moreToCome flag set to a single request;
+// that is used by exhaust cursors (`getMore`) and awaitable `hello`.
+// Iteration stops after the reply without moreToCome flag or on the first error,
+// which is yielded with nil reply.
+//
+// Passed context's deadline is honored if set.
+//
+// If the caller stops iteration early while the server is still sending replies,
+// the connection is left in an undefined state and should be closed.
+func (c *Conn) Stream(ctx context.Context, msg *wire.OpMsg) iter.Seq2[*wire.OpMsg, error] {
+	return func(yield func(*wire.OpMsg, error) bool) {
+		// do not modify the caller's message
+		m := *msg
+		m.Flags |= wire.OpMsgFlags(wire.OpMsgExhaustAllowed)
+
+		header, body, err := c.prepare(&m)
+		if err != nil {
+			yield(nil, fmt.Errorf("wireclient.Conn.Stream: %w", err))
+			return
+		}
+
+		if err = c.Write(ctx, header, body); err != nil {
+			yield(nil, fmt.Errorf("wireclient.Conn.Stream: %w", err))
+			return
+		}
+
+		// subsequent replies are sent in response to the previous reply
+		responseTo := header.RequestID
+
+		for {
+			var resHeader *wire.MsgHeader
+			var resBody wire.MsgBody
+
+			if resHeader, resBody, err = c.Read(ctx); err != nil {
+				yield(nil, fmt.Errorf("wireclient.Conn.Stream: %w", err))
+				return
+			}
+
+			if resHeader.ResponseTo != responseTo {
+				yield(nil, fmt.Errorf(
+					"wireclient.Conn.Stream: response's response_to=%d is not equal to expected %d",
+					resHeader.ResponseTo,
+					responseTo,
+				))
+
+				return
+			}
+
+			res, ok := resBody.(*wire.OpMsg)
+			if !ok {
+				yield(nil, fmt.Errorf("wireclient.Conn.Stream: unexpected response type %T", resBody))
+				return
+			}
+
+			if !yield(res, nil) || !res.Flags.FlagSet(wire.OpMsgMoreToCome) {
+				return
+			}
+
+			responseTo = resHeader.RequestID
+		}
+	}
+}
+
+// prepare generates the header for the given request body.
+// It also sets the checksum flag if checksums are enabled;
+// in that case, the returned body is a copy.
+func (c *Conn) prepare(body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+	if msg, ok := body.(*wire.OpMsg); ok && c.checksum && !msg.Flags.FlagSet(wire.OpMsgChecksumPresent) {
+		// do not modify the caller's message
+		m := *msg
+		m.Flags |= wire.OpMsgFlags(wire.OpMsgChecksumPresent)
+		body = &m
+	}
+
+	b, err := body.MarshalBinary()
+	if err != nil {
+		return nil, nil, fmt.Errorf("wireclient.Conn.prepare: %w", err)
+	}
+
+	header := &wire.MsgHeader{
+		MessageLength: int32(len(b) + wire.MsgHeaderLen),
+		RequestID:     nextRequestID.Add(1),
 	}
 
-	if ok := res.Get("ok"); ok != 1.0 {
-		return fmt.Errorf("wireclient.Conn.Ping: failed (ok was %v)", ok)
+	switch body.(type) {
+	case *wire.OpMsg:
+		header.OpCode = wire.OpCodeMsg
+	case *wire.OpQuery:
+		header.OpCode = wire.OpCodeQuery
+	default:
+		return nil, nil, fmt.Errorf("wireclient.Conn.prepare: unsupported body type %T", body)
+	}
+
+	return header, body, nil
+}
+
+// Ping sends a ping command.
+// It returns error for unexpected server response or any other error.
+func (c *Conn) Ping(ctx context.Context) error {
+	cmd := wire.MustOpMsg("ping", int32(1), "$db", "test")
+
+	if _, err := c.RequestCommand(ctx, cmd); err != nil {
+		return fmt.Errorf("wireclient.Conn.Ping: %w", err)
 	}
 
 	return nil
@@ -351,7 +584,11 @@ func (c *Conn) Ping(ctx context.Context) error {
 // It should not be used to test various authentication scenarios.
 //
 // The authMechanism is used to enforce a specific authentication mechanism.
-// If empty, the negotiation is performed instead using `hello` command.
+// If empty, the negotiation is performed instead using `hello` command;
+// SCRAM-SHA-256, SCRAM-SHA-1, and PLAIN mechanisms are tried in that order of preference.
+// MONGODB-X509 mechanism is never negotiated and should be set explicitly;
+// it uses the client certificate set by `tlsCertificateKeyFile` query parameter of [Connect],
+// the optional username, and ignores authSource.
 // Note that in practice it often fails due to incorrect handling of the `loadBalanced` parameter.
 func (c *Conn) Login(ctx context.Context, userinfo *url.Userinfo, authSource, authMechanism string) error {
 	username := userinfo.Username()
@@ -366,8 +603,12 @@ func (c *Conn) Login(ctx context.Context, userinfo *url.Userinfo, authSource, au
 	}
 
 	switch {
+	case slices.Contains(mechs, "MONGODB-X509"):
+		return c.loginX509(ctx, username)
 	case slices.Contains(mechs, "SCRAM-SHA-256"):
 		return c.loginScramSHA256(ctx, username, password, authSource)
+	case slices.Contains(mechs, "SCRAM-SHA-1"):
+		return c.loginScramSHA1(ctx, username, password, authSource)
 	case slices.Contains(mechs, "PLAIN"):
 		return c.loginPlain(ctx, username, password, authSource)
 	default:
@@ -386,12 +627,7 @@ func (c *Conn) hello(ctx context.Context, username, authDB string) ([]string, er
 		"$db", authDB,
 	)
 
-	_, resBody, err := c.Request(ctx, body)
-	if err != nil {
-		return nil, fmt.Errorf("wireclient.Conn.hello: %w", err)
-	}
-
-	res, err := resBody.(*wire.OpMsg).DocumentDeep()
+	res, err := c.RequestCommand(ctx, body)
 	if err != nil {
 		return nil, fmt.Errorf("wireclient.Conn.hello: %w", err)
 	}
@@ -426,18 +662,36 @@ func (c *Conn) loginPlain(ctx context.Context, username, password, authDB string
 		"$db", authDB,
 	)
 
-	_, resBody, err := c.Request(ctx, body)
-	if err != nil {
+	if _, err := c.RequestCommand(ctx, body); err != nil {
 		return fmt.Errorf("wireclient.Conn.loginPlain: %w", err)
 	}
 
-	res, err := resBody.(*wire.OpMsg).DocumentDeep()
+	return c.checkAuth(ctx)
+}
+
+// loginX509 authenticates the connection using the MONGODB-X509 mechanism
+// and the client certificate presented during the TLS handshake.
+//
+// The username is optional; if empty, the server derives it from the certificate subject.
+func (c *Conn) loginX509(ctx context.Context, username string) error {
+	cmd := wirebson.MustDocument(
+		"authenticate", int32(1),
+		"mechanism", "MONGODB-X509",
+	)
+
+	if username != "" {
+		must.NoError(cmd.Add("user", username))
+	}
+
+	must.NoError(cmd.Add("$db", "$external"))
+
+	body, err := wire.NewOpMsg(cmd)
 	if err != nil {
-		return fmt.Errorf("wireclient.Conn.loginPlain: %w", err)
+		return fmt.Errorf("wireclient.Conn.loginX509: %w", err)
 	}
 
-	if ok := res.Get("ok"); ok != 1.0 {
-		return fmt.Errorf("wireclient.Conn.loginPlain: authentication failed (ok was %v)", ok)
+	if _, err = c.RequestCommand(ctx, body); err != nil {
+		return fmt.Errorf("wireclient.Conn.loginX509: %w", err)
 	}
 
 	return c.checkAuth(ctx)
@@ -450,16 +704,44 @@ func (c *Conn) loginScramSHA256(ctx context.Context, username, password, authDB
 		return fmt.Errorf("wireclient.Conn.loginScramSHA256: %w", err)
 	}
 
+	if err = c.loginScram(ctx, "SCRAM-SHA-256", s, authDB); err != nil {
+		return fmt.Errorf("wireclient.Conn.loginScramSHA256: %w", err)
+	}
+
+	return nil
+}
+
+// loginScramSHA1 authenticates the connection using the SCRAM-SHA-1 mechanism.
+//
+// Unlike SCRAM-SHA-256, MongoDB uses the hex-encoded MD5 digest of username and password
+// instead of the SASLprep'ed password.
+func (c *Conn) loginScramSHA1(ctx context.Context, username, password, authDB string) error {
+	digest := md5.Sum([]byte(username + ":mongo:" + password))
+
+	s, err := scram.SHA1.NewClientUnprepped(username, hex.EncodeToString(digest[:]), "")
+	if err != nil {
+		return fmt.Errorf("wireclient.Conn.loginScramSHA1: %w", err)
+	}
+
+	if err = c.loginScram(ctx, "SCRAM-SHA-1", s, authDB); err != nil {
+		return fmt.Errorf("wireclient.Conn.loginScramSHA1: %w", err)
+	}
+
+	return nil
+}
+
+// loginScram authenticates the connection using the given SCRAM mechanism and client.
+func (c *Conn) loginScram(ctx context.Context, mechanism string, s *scram.Client, authDB string) error {
 	conv := s.NewConversation()
 
 	payload, err := conv.Step("")
 	if err != nil {
-		return fmt.Errorf("wireclient.Conn.loginScramSHA256: %w", err)
+		return fmt.Errorf("wireclient.Conn.loginScram: %w", err)
 	}
 
 	cmd := wirebson.MustDocument(
 		"saslStart", int32(1),
-		"mechanism", "SCRAM-SHA-256",
+		"mechanism", mechanism,
 		"payload", wirebson.Binary{B: []byte(payload)},
 		"options", wirebson.MustDocument(
 			"skipEmptyExchange", true,
@@ -471,41 +753,32 @@ func (c *Conn) loginScramSHA256(ctx context.Context, username, password, authDB
 	// one and one for those who do.
 	for step := 1; step <= 3; step++ {
 		c.l.DebugContext(
-			ctx, "wireclient.Conn.loginScramSHA256: client",
-			slog.Int("step", step), slog.String("payload", payload),
+			ctx, "wireclient.Conn.loginScram: client",
+			slog.String("mechanism", mechanism), slog.Int("step", step), slog.String("payload", payload),
 			slog.Bool("done", conv.Done()), slog.Bool("valid", conv.Valid()),
 		)
 
 		var body *wire.OpMsg
 		if body, err = wire.NewOpMsg(cmd); err != nil {
-			return fmt.Errorf("wireclient.Conn.loginScramSHA256: %w", err)
-		}
-
-		var resBody wire.MsgBody
-		if _, resBody, err = c.Request(ctx, body); err != nil {
-			return fmt.Errorf("wireclient.Conn.loginScramSHA256: %w", err)
+			return fmt.Errorf("wireclient.Conn.loginScram: %w", err)
 		}
 
 		var res *wirebson.Document
-		if res, err = resBody.(*wire.OpMsg).DocumentDeep(); err != nil {
-			return fmt.Errorf("wireclient.Conn.loginScramSHA256: %w", err)
-		}
-
-		if ok := res.Get("ok"); ok != 1.0 {
-			return fmt.Errorf("wireclient.Conn.loginScramSHA256: %s failed (ok was %v)", cmd.Command(), ok)
+		if res, err = c.RequestCommand(ctx, body); err != nil {
+			return fmt.Errorf("wireclient.Conn.loginScram: %s failed: %w", cmd.Command(), err)
 		}
 
 		payload = string(res.Get("payload").(wirebson.Binary).B)
 
 		c.l.DebugContext(
-			ctx, "wireclient.Conn.loginScramSHA256: server",
+			ctx, "wireclient.Conn.loginScram: server",
 			slog.Int("step", step), slog.String("payload", payload),
 		)
 
 		if done := res.Get("done").(bool); !done {
 			payload, err = conv.Step(payload)
 			if err != nil {
-				return fmt.Errorf("wireclient.Conn.loginScramSHA256: %w", err)
+				return fmt.Errorf("wireclient.Conn.loginScram: %w", err)
 			}
 
 			cmd = wirebson.MustDocument(
@@ -520,46 +793,36 @@ func (c *Conn) loginScramSHA256(ctx context.Context, username, password, authDB
 
 		if step == 2 {
 			c.l.DebugContext(
-				ctx, "wireclient.Conn.loginScramSHA256: conversation done at the first saslContinue, "+
+				ctx, "wireclient.Conn.loginScram: conversation done at the first saslContinue, "+
 					"assuming that server supports skipEmptyExchange",
 				slog.Int("step", step), slog.String("payload", payload),
 				slog.Bool("done", conv.Done()), slog.Bool("valid", conv.Valid()),
 			)
 
 			if _, err = conv.Step(payload); err != nil {
-				return fmt.Errorf("wireclient.Conn.loginScramSHA256: %w", err)
+				return fmt.Errorf("wireclient.Conn.loginScram: %w", err)
 			}
 		}
 
 		if !conv.Done() {
-			return fmt.Errorf("wireclient.Conn.loginScramSHA256: conversation is not done")
+			return fmt.Errorf("wireclient.Conn.loginScram: conversation is not done")
 		}
 
 		if !conv.Valid() {
-			return fmt.Errorf("wireclient.Conn.loginScramSHA256: conversation is done, but not valid")
+			return fmt.Errorf("wireclient.Conn.loginScram: conversation is done, but not valid")
 		}
 
 		return c.checkAuth(ctx)
 	}
 
-	return fmt.Errorf("wireclient.Conn.loginScramSHA256: too many steps")
+	return fmt.Errorf("wireclient.Conn.loginScram: too many steps")
 }
 
 // checkAuth checks if the connection is authenticated.
 func (c *Conn) checkAuth(ctx context.Context) error {
-	_, resBody, err := c.Request(ctx, wire.MustOpMsg("listDatabases", int32(1), "$db", "admin"))
-	if err != nil {
+	if _, err := c.RequestCommand(ctx, wire.MustOpMsg("listDatabases", int32(1), "$db", "admin")); err != nil {
 		return fmt.Errorf("wireclient.Conn.checkAuth: %w", err)
 	}
 
-	res, err := resBody.(*wire.OpMsg).DocumentDeep()
-	if err != nil {
-		return fmt.Errorf("wireclient.Conn.checkAuth: %w", err)
-	}
-
-	if ok := res.Get("ok"); ok != 1.0 {
-		return fmt.Errorf("wireclient.Conn.checkAuth: failed (ok was %v)", ok)
-	}
-
 	return nil
 }
@@ -15,16 +15,32 @@
 package wireclient
 
 import (
+	"bufio"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
 	"log/slog"
+	"math/big"
+	"net"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/xdg-go/scram"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -32,6 +48,7 @@ import (
 	"github.com/FerretDB/wire"
 	"github.com/FerretDB/wire/internal/util/testutil"
 	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireserver"
 	"github.com/FerretDB/wire/wiretest"
 )
 
@@ -275,3 +292,606 @@ func TestConnTypes(t *testing.T) {
 		assert.Equal(t, mExpected, res)
 	})
 }
+
+func TestConnChecksum(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+		require.NoError(t, server.Close())
+	})
+
+	conn := New(client, logger(t))
+	conn.SetChecksum(true)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		r := bufio.NewReader(server)
+		w := bufio.NewWriter(server)
+
+		header, body, err := wire.ReadMessage(r)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.True(t, body.(*wire.OpMsg).ChecksumVerified())
+
+		resBody := wire.MustOpMsg("ok", float64(1))
+		resHeader := &wire.MsgHeader{
+			MessageLength: int32(resBody.Size() + wire.MsgHeaderLen),
+			RequestID:     header.RequestID + 1,
+			ResponseTo:    header.RequestID,
+			OpCode:        wire.OpCodeMsg,
+		}
+
+		assert.NoError(t, wire.WriteMessage(w, resHeader, resBody))
+		assert.NoError(t, w.Flush())
+	}()
+
+	msg := wire.MustOpMsg("ping", int32(1), "$db", "admin")
+
+	_, resBody, err := conn.Request(t.Context(), msg)
+	require.NoError(t, err)
+	assert.False(t, msg.Flags.FlagSet(wire.OpMsgChecksumPresent), "request message should not be modified")
+
+	<-done
+
+	doc, err := resBody.(*wire.OpMsg).DocumentDeep()
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), doc.Get("ok"))
+}
+
+func TestConnStream(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+		require.NoError(t, server.Close())
+	})
+
+	conn := New(client, logger(t))
+
+	go func() {
+		r := bufio.NewReader(server)
+		w := bufio.NewWriter(server)
+
+		// fire-and-forget request
+		_, body, err := wire.ReadMessage(r)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.True(t, body.(*wire.OpMsg).Flags.FlagSet(wire.OpMsgMoreToCome))
+
+		header, body, err := wire.ReadMessage(r)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.True(t, body.(*wire.OpMsg).Flags.FlagSet(wire.OpMsgExhaustAllowed))
+
+		responseTo := header.RequestID
+
+		for i := range int32(3) {
+			res := wire.MustOpMsg("n", i, "ok", float64(1))
+			if i < 2 {
+				res.Flags |= wire.OpMsgFlags(wire.OpMsgMoreToCome)
+			}
+
+			resHeader := &wire.MsgHeader{
+				MessageLength: int32(res.Size() + wire.MsgHeaderLen),
+				RequestID:     1000 + i,
+				ResponseTo:    responseTo,
+				OpCode:        wire.OpCodeMsg,
+			}
+
+			if !assert.NoError(t, wire.WriteMessage(w, resHeader, res)) || !assert.NoError(t, w.Flush()) {
+				return
+			}
+
+			responseTo = resHeader.RequestID
+		}
+	}()
+
+	msg := wire.MustOpMsg("insert", "test", "$db", "test")
+	msg.Flags |= wire.OpMsgFlags(wire.OpMsgMoreToCome)
+
+	header, body, err := conn.Request(t.Context(), msg)
+	require.NoError(t, err)
+	assert.Nil(t, header)
+	assert.Nil(t, body)
+
+	msg = wire.MustOpMsg("getMore", int64(42), "collection", "test", "$db", "test")
+
+	var actual []any
+
+	for res, err := range conn.Stream(t.Context(), msg) {
+		require.NoError(t, err)
+
+		var doc *wirebson.Document
+		doc, err = res.Document()
+		require.NoError(t, err)
+
+		actual = append(actual, doc.Get("n"))
+	}
+
+	assert.Equal(t, []any{int32(0), int32(1), int32(2)}, actual)
+	assert.False(t, msg.Flags.FlagSet(wire.OpMsgExhaustAllowed), "request message should not be modified")
+}
+
+// setupScramSHA1 starts a server that supports SCRAM-SHA-1 authentication
+// of the given user with the given password, and returns its URI.
+func setupScramSHA1(t *testing.T, username, password string) string {
+	t.Helper()
+
+	digest := md5.Sum([]byte(username + ":mongo:" + password))
+
+	client, err := scram.SHA1.NewClientUnprepped(username, hex.EncodeToString(digest[:]), "")
+	require.NoError(t, err)
+
+	stored := client.GetStoredCredentials(scram.KeyFactors{Salt: "0123456789abcdef", Iters: 4096})
+
+	s, err := scram.SHA1.NewServer(func(u string) (scram.StoredCredentials, error) {
+		if u != username {
+			return scram.StoredCredentials{}, fmt.Errorf("unknown user %q", u)
+		}
+
+		return stored, nil
+	})
+	require.NoError(t, err)
+
+	var m sync.Mutex
+	convs := map[int64]*scram.ServerConversation{}
+
+	// step performs the next step of the connection's conversation
+	step := func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		// handlers run in server goroutines, so assert is used instead of require
+		doc, derr := req.DocumentDeep()
+		if !assert.NoError(t, derr) {
+			return nil, &wireserver.Error{Message: derr.Error(), Name: "BadValue", Code: 2}
+		}
+
+		m.Lock()
+		defer m.Unlock()
+
+		id := wireserver.ConnInfoFromContext(ctx).ID
+
+		conv := convs[id]
+		if doc.Command() == "saslStart" {
+			if !assert.Equal(t, "SCRAM-SHA-1", doc.Get("mechanism")) {
+				return nil, &wireserver.Error{Message: "Unsupported mechanism.", Name: "MechanismUnavailable", Code: 334}
+			}
+
+			conv = s.NewConversation()
+			convs[id] = conv
+		}
+
+		if !assert.NotNil(t, conv, "saslContinue without saslStart") {
+			return nil, &wireserver.Error{Message: "No SASL session state found.", Name: "ProtocolError", Code: 17}
+		}
+
+		payload, serr := conv.Step(string(doc.Get("payload").(wirebson.Binary).B))
+		if serr != nil {
+			return nil, &wireserver.Error{Message: "Authentication failed.", Name: "AuthenticationFailed", Code: 18}
+		}
+
+		return wire.MustOpMsg(
+			"conversationId", int32(1),
+			"done", conv.Done(),
+			"payload", wirebson.Binary{B: []byte(payload)},
+			"ok", float64(1),
+		), nil
+	}
+
+	mux := wireserver.NewMux()
+
+	mux.RegisterFunc("hello", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("saslSupportedMechs", wirebson.MustArray("SCRAM-SHA-1"), "ok", float64(1)), nil
+	})
+
+	mux.RegisterFunc("saslStart", step)
+	mux.RegisterFunc("saslContinue", step)
+
+	mux.RegisterFunc("listDatabases", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		m.Lock()
+		defer m.Unlock()
+
+		if conv := convs[wireserver.ConnInfoFromContext(ctx).ID]; conv == nil || !conv.Valid() {
+			return nil, &wireserver.Error{Message: "command listDatabases requires authentication", Name: "Unauthorized", Code: 13}
+		}
+
+		return wire.MustOpMsg("databases", wirebson.MakeArray(0), "ok", float64(1)), nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serve(t, l, mux)
+
+	return "mongodb://" + l.Addr().String() + "/"
+}
+
+func TestConnLoginScramSHA1(t *testing.T) {
+	t.Parallel()
+
+	uri := setupScramSHA1(t, "user", "pass")
+
+	for name, tc := range map[string]struct {
+		userinfo      *url.Userinfo
+		authMechanism string
+		err           string
+	}{
+		"Negotiated": {
+			userinfo: url.UserPassword("user", "pass"),
+		},
+		"Explicit": {
+			userinfo:      url.UserPassword("user", "pass"),
+			authMechanism: "SCRAM-SHA-1",
+		},
+		"InvalidPassword": {
+			userinfo: url.UserPassword("user", "invalid"),
+			err:      "AuthenticationFailed (18)",
+		},
+		"InvalidUser": {
+			userinfo: url.UserPassword("invalid", "pass"),
+			err:      "AuthenticationFailed (18)",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			conn, err := Connect(t.Context(), uri, logger(t))
+			require.NoError(t, err)
+
+			t.Cleanup(func() {
+				require.NoError(t, conn.Close())
+			})
+
+			err = conn.Login(t.Context(), tc.userinfo, "admin", tc.authMechanism)
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+// generateCert creates a certificate from the template signed by the parent certificate and key.
+// If parent is nil, the certificate is self-signed.
+func generateCert(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert, key
+}
+
+// writePEM writes PEM blocks to a new file in the given directory and returns its path.
+func writePEM(t *testing.T, dir, name string, blocks ...*pem.Block) string {
+	t.Helper()
+
+	var b []byte
+	for _, block := range blocks {
+		b = append(b, pem.EncodeToMemory(block)...)
+	}
+
+	file := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(file, b, 0o600))
+
+	return file
+}
+
+// tlsServer represents a TLS server started by [setupTLS].
+type tlsServer struct {
+	subjects      sync.Map // client certificate subjects by client address
+	addr          string
+	caFile        string
+	clientFile    string // with plain key
+	encryptedFile string // with key encrypted with "secret" password
+}
+
+// setupTLS starts a TLS server with a certificate for the given host name or IP address,
+// and writes CA certificate and client certificates to files.
+func setupTLS(t *testing.T, serverName string) *tlsServer {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	ca, caKey := generateCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "wireclient test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	serverTemplate := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: serverName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if ip := net.ParseIP(serverName); ip != nil {
+		serverTemplate.IPAddresses = []net.IP{ip}
+	} else {
+		serverTemplate.DNSNames = []string{serverName}
+	}
+
+	server, serverKey := generateCert(t, serverTemplate, ca, caKey)
+
+	client, clientKey := generateCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client", Organization: []string{"FerretDB"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	require.NoError(t, err)
+
+	certBlock := &pem.Block{Type: "CERTIFICATE", Bytes: client.Raw}
+	keyBlock := &pem.Block{Type: "EC PRIVATE KEY", Bytes: clientKeyDER}
+
+	//nolint:staticcheck // legacy PEM encryption is what Connect supports
+	encryptedBlock, err := x509.EncryptPEMBlock(rand.Reader, keyBlock.Type, keyBlock.Bytes, []byte("secret"), x509.PEMCipherAES256)
+	require.NoError(t, err)
+
+	s := &tlsServer{
+		caFile:        writePEM(t, dir, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}),
+		clientFile:    writePEM(t, dir, "client.pem", certBlock, keyBlock),
+		encryptedFile: writePEM(t, dir, "encrypted.pem", certBlock, encryptedBlock),
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{server.Raw},
+			PrivateKey:  serverKey,
+		}},
+		ClientCAs:  roots,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}
+
+	// record the client certificate subject of each connection
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		addr := hello.Conn.RemoteAddr().String()
+
+		c := config.Clone()
+		c.GetConfigForClient = nil
+		c.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) > 0 {
+				s.subjects.Store(addr, cs.PeerCertificates[0].Subject.String())
+			}
+
+			return nil
+		}
+
+		return c, nil
+	}
+
+	mux := wireserver.NewMux()
+
+	mux.RegisterFunc("ping", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	mux.RegisterFunc("authenticate", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		doc, derr := req.DocumentDeep()
+		if !assert.NoError(t, derr) {
+			return nil, &wireserver.Error{Message: derr.Error(), Name: "BadValue", Code: 2}
+		}
+
+		assert.Equal(t, "MONGODB-X509", doc.Get("mechanism"))
+		assert.Equal(t, "$external", doc.Get("$db"))
+
+		subject := s.subject(ctx)
+
+		if user := doc.Get("user"); subject == "" || (user != nil && user != subject) {
+			return nil, &wireserver.Error{Message: "Authentication failed.", Name: "AuthenticationFailed", Code: 18}
+		}
+
+		return wire.MustOpMsg("dbname", "$external", "user", subject, "ok", float64(1)), nil
+	})
+
+	mux.RegisterFunc("listDatabases", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("databases", wirebson.MakeArray(0), "ok", float64(1)), nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serve(t, tls.NewListener(l, config), mux)
+
+	s.addr = l.Addr().String()
+
+	return s
+}
+
+// subject returns the client certificate subject of the handler's connection,
+// or empty string if the client did not send a certificate.
+func (s *tlsServer) subject(ctx context.Context) string {
+	v, _ := s.subjects.Load(wireserver.ConnInfoFromContext(ctx).RemoteAddr.String())
+	subject, _ := v.(string)
+
+	return subject
+}
+
+// uri returns server's URI with the given query parameters and tls=true.
+func (s *tlsServer) uri(params ...string) string {
+	q := url.Values{"tls": []string{"true"}}
+
+	for i := 0; i < len(params); i += 2 {
+		q.Set(params[i], params[i+1])
+	}
+
+	return "mongodb://" + s.addr + "/?" + q.Encode()
+}
+
+func TestConnectTLS(t *testing.T) {
+	t.Parallel()
+
+	valid := setupTLS(t, "127.0.0.1")
+	invalid := setupTLS(t, "example.com")
+
+	for name, tc := range map[string]struct {
+		uri     string
+		subject string // of the client certificate received by the server
+		err     string
+	}{
+		"CaFile": {
+			uri: valid.uri("tlsCaFile", valid.caFile),
+		},
+		"NoCaFile": {
+			uri: valid.uri(),
+			err: "certificate signed by unknown authority",
+		},
+		"Insecure": {
+			uri: valid.uri("tlsInsecure", "true"),
+		},
+		"ClientCertificate": {
+			uri:     valid.uri("tlsCaFile", valid.caFile, "tlsCertificateKeyFile", valid.clientFile),
+			subject: "CN=client,O=FerretDB",
+		},
+		"EncryptedKey": {
+			uri: valid.uri(
+				"tlsCaFile", valid.caFile,
+				"tlsCertificateKeyFile", valid.encryptedFile,
+				"tlsCertificateKeyFilePassword", "secret",
+			),
+			subject: "CN=client,O=FerretDB",
+		},
+		"EncryptedKeyInvalidPassword": {
+			uri: valid.uri(
+				"tlsCaFile", valid.caFile,
+				"tlsCertificateKeyFile", valid.encryptedFile,
+				"tlsCertificateKeyFilePassword", "invalid",
+			),
+			err: "decryption password incorrect",
+		},
+		"EncryptedKeyNoPassword": {
+			uri: valid.uri("tlsCaFile", valid.caFile, "tlsCertificateKeyFile", valid.encryptedFile),
+			err: "wireclient.loadCertificateKeyFile",
+		},
+		"InvalidHostname": {
+			uri: invalid.uri("tlsCaFile", invalid.caFile),
+			err: "cannot validate certificate for 127.0.0.1",
+		},
+		"AllowInvalidHostnames": {
+			uri: invalid.uri("tlsCaFile", invalid.caFile, "tlsAllowInvalidHostnames", "true"),
+		},
+		"AllowInvalidHostnamesNoCaFile": {
+			uri: invalid.uri("tlsAllowInvalidHostnames", "true"),
+			err: "certificate signed by unknown authority",
+		},
+		"InvalidInsecure": {
+			uri: valid.uri("tlsInsecure", "invalid"),
+			err: `invalid value "invalid" of option "tlsInsecure"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			conn, err := Connect(t.Context(), tc.uri, logger(t))
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			t.Cleanup(func() {
+				require.NoError(t, conn.Close())
+			})
+
+			require.NoError(t, conn.Ping(t.Context()))
+
+			// the server replies with the subject of this connection's client certificate
+			res, err := conn.RequestCommand(t.Context(), wire.MustOpMsg(
+				"authenticate", int32(1),
+				"mechanism", "MONGODB-X509",
+				"$db", "$external",
+			))
+
+			if tc.subject == "" {
+				require.ErrorContains(t, err, "AuthenticationFailed (18)")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.subject, res.Get("user"))
+		})
+	}
+}
+
+func TestConnectSeedList(t *testing.T) {
+	t.Parallel()
+
+	mux := wireserver.NewMux()
+
+	mux.RegisterFunc("ping", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serve(t, l, mux)
+
+	// nothing listens on that address after the listener is closed
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+
+	uri := "mongodb://" + closed.Addr().String() + "," + l.Addr().String() + "/db?appName=test&unknownOption=1"
+
+	conn, err := Connect(t.Context(), uri, logger(t))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+	})
+
+	require.NoError(t, conn.Ping(t.Context()))
+
+	_, err = Connect(t.Context(), "mongodb://user:pass@"+l.Addr().String()+"/", logger(t))
+	require.ErrorContains(t, err, "credentials must be absent")
+}
+
+func TestConnLoginX509(t *testing.T) {
+	t.Parallel()
+
+	s := setupTLS(t, "127.0.0.1")
+
+	conn, err := Connect(t.Context(), s.uri("tlsCaFile", s.caFile, "tlsCertificateKeyFile", s.clientFile), logger(t))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+	})
+
+	require.NoError(t, conn.Login(t.Context(), nil, "", "MONGODB-X509"))
+	require.NoError(t, conn.Login(t.Context(), url.User("CN=client,O=FerretDB"), "admin", "MONGODB-X509"))
+
+	err = conn.Login(t.Context(), url.User("CN=other"), "", "MONGODB-X509")
+	require.ErrorContains(t, err, "AuthenticationFailed (18)")
+}
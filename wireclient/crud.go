@@ -0,0 +1,608 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// codeNamespaceNotFound is the code of `NamespaceNotFound` error.
+const codeNamespaceNotFound = int32(26) // NamespaceNotFound
+
+// WriteOpts represents [Conn.Insert], [Conn.Update], and [Conn.Delete] options.
+type WriteOpts struct {
+	// WriteConcern is sent with every batch, if set.
+	WriteConcern *wirebson.Document
+
+	// Unordered makes the server continue processing after write errors,
+	// and makes the client send remaining batches after a batch with write errors.
+	Unordered bool
+
+	// BypassDocumentValidation is sent for `insert` and `update` commands, if set.
+	BypassDocumentValidation bool
+}
+
+// InsertResult represents the result of [Conn.Insert].
+type InsertResult struct {
+	N int32 // number of inserted documents
+}
+
+// Upserted represents a single element of `upserted` field of `update` reply.
+type Upserted struct {
+	ID    any   // _id of the upserted document
+	Index int32 // index of the update statement
+}
+
+// UpdateResult represents the result of [Conn.Update].
+type UpdateResult struct {
+	Upserted  []Upserted
+	N         int32 // number of matched and upserted documents
+	NModified int32 // number of modified documents
+}
+
+// DeleteResult represents the result of [Conn.Delete].
+type DeleteResult struct {
+	N int32 // number of deleted documents
+}
+
+// FindOpts represents [Conn.Find] options.
+type FindOpts struct {
+	Sort       *wirebson.Document
+	Projection *wirebson.Document
+	Skip       int64
+	Limit      int64
+	BatchSize  int32 // also used for the returned cursor
+}
+
+// AggregateOpts represents [Conn.Aggregate] options.
+type AggregateOpts struct {
+	BatchSize    int32 // also used for the returned cursor
+	AllowDiskUse bool
+}
+
+// CreateIndexesResult represents the result of [Conn.CreateIndexes].
+type CreateIndexesResult struct {
+	Note                           string // set if all indexes already exist
+	NumIndexesBefore               int32
+	NumIndexesAfter                int32
+	CreatedCollectionAutomatically bool
+}
+
+// Insert inserts the given documents into the collection with `insert` command.
+//
+// Documents are sent in sections of kind 1 and split into several commands
+// according to [ServerDescription] limits (or default limits if [Conn.Handshake] was not performed);
+// a document larger than `maxBsonObjectSize` is rejected without sending anything.
+//
+// If some documents were not inserted, the returned error is [*WriteException]
+// with [WriteError.Index] relative to the whole docs slice,
+// and the result contains the number of documents that were inserted.
+// If a batch fails with other error (for example, a network error) after previous batches were acknowledged,
+// the result is also returned, and the error wraps [*WriteException] of previous batches, if any.
+func (c *Conn) Insert(ctx context.Context, db, collection string, docs []*wirebson.Document, opts *WriteOpts) (*InsertResult, error) {
+	if opts == nil {
+		opts = new(WriteOpts)
+	}
+
+	cmd := writeCommand("insert", collection, db, opts, true)
+
+	var res InsertResult
+
+	replied, err := c.write(ctx, cmd, "documents", docs, opts.Unordered, func(reply *wirebson.Document, _ int) {
+		res.N += toInt32(reply.Get("n"))
+	})
+
+	if err != nil {
+		return writeResult(&res, replied, fmt.Errorf("wireclient.Conn.Insert: %w", err))
+	}
+
+	return &res, nil
+}
+
+// Update updates documents in the collection with `update` command.
+//
+// Each update statement is a document like `{q: filter, u: update, upsert: bool, multi: bool}`.
+// Statements are sent and split into batches as described in [Conn.Insert],
+// and errors are reported the same way.
+func (c *Conn) Update(ctx context.Context, db, collection string, updates []*wirebson.Document, opts *WriteOpts) (*UpdateResult, error) {
+	if opts == nil {
+		opts = new(WriteOpts)
+	}
+
+	cmd := writeCommand("update", collection, db, opts, true)
+
+	var res UpdateResult
+
+	replied, err := c.write(ctx, cmd, "updates", updates, opts.Unordered, func(reply *wirebson.Document, offset int) {
+		res.N += toInt32(reply.Get("n"))
+		res.NModified += toInt32(reply.Get("nModified"))
+
+		upserted, _ := reply.Get("upserted").(*wirebson.Array)
+		if upserted == nil {
+			return
+		}
+
+		for v := range upserted.Values() {
+			doc, _ := v.(*wirebson.Document)
+			if doc == nil {
+				continue
+			}
+
+			res.Upserted = append(res.Upserted, Upserted{
+				ID:    doc.Get("_id"),
+				Index: toInt32(doc.Get("index")) + int32(offset),
+			})
+		}
+	})
+
+	if err != nil {
+		return writeResult(&res, replied, fmt.Errorf("wireclient.Conn.Update: %w", err))
+	}
+
+	return &res, nil
+}
+
+// Delete deletes documents from the collection with `delete` command.
+//
+// Each delete statement is a document like `{q: filter, limit: 0 or 1}`.
+// Statements are sent and split into batches as described in [Conn.Insert],
+// and errors are reported the same way.
+func (c *Conn) Delete(ctx context.Context, db, collection string, deletes []*wirebson.Document, opts *WriteOpts) (*DeleteResult, error) {
+	if opts == nil {
+		opts = new(WriteOpts)
+	}
+
+	cmd := writeCommand("delete", collection, db, opts, false)
+
+	var res DeleteResult
+
+	replied, err := c.write(ctx, cmd, "deletes", deletes, opts.Unordered, func(reply *wirebson.Document, _ int) {
+		res.N += toInt32(reply.Get("n"))
+	})
+
+	if err != nil {
+		return writeResult(&res, replied, fmt.Errorf("wireclient.Conn.Delete: %w", err))
+	}
+
+	return &res, nil
+}
+
+// Find sends `find` command and returns a cursor over matching documents.
+// Filter may be nil.
+func (c *Conn) Find(ctx context.Context, db, collection string, filter *wirebson.Document, opts *FindOpts) (*Cursor, error) {
+	if opts == nil {
+		opts = new(FindOpts)
+	}
+
+	cmd := wirebson.MustDocument("find", collection)
+
+	if filter != nil {
+		must.NoError(cmd.Add("filter", filter))
+	}
+
+	if opts.Sort != nil {
+		must.NoError(cmd.Add("sort", opts.Sort))
+	}
+
+	if opts.Projection != nil {
+		must.NoError(cmd.Add("projection", opts.Projection))
+	}
+
+	if opts.Skip > 0 {
+		must.NoError(cmd.Add("skip", opts.Skip))
+	}
+
+	if opts.Limit > 0 {
+		must.NoError(cmd.Add("limit", opts.Limit))
+	}
+
+	if opts.BatchSize > 0 {
+		must.NoError(cmd.Add("batchSize", opts.BatchSize))
+	}
+
+	must.NoError(cmd.Add("$db", db))
+
+	cursor, err := c.cursor(ctx, cmd, opts.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.Find: %w", err)
+	}
+
+	return cursor, nil
+}
+
+// Aggregate sends `aggregate` command and returns a cursor over resulting documents.
+// If collection is empty, the database-level aggregation is performed.
+func (c *Conn) Aggregate(ctx context.Context, db, collection string, pipeline *wirebson.Array, opts *AggregateOpts) (*Cursor, error) {
+	if opts == nil {
+		opts = new(AggregateOpts)
+	}
+
+	var aggregate any = collection
+	if collection == "" {
+		aggregate = int32(1)
+	}
+
+	if pipeline == nil {
+		pipeline = wirebson.MakeArray(0)
+	}
+
+	cursor := wirebson.MakeDocument(1)
+	if opts.BatchSize > 0 {
+		must.NoError(cursor.Add("batchSize", opts.BatchSize))
+	}
+
+	cmd := wirebson.MustDocument(
+		"aggregate", aggregate,
+		"pipeline", pipeline,
+		"cursor", cursor,
+	)
+
+	if opts.AllowDiskUse {
+		must.NoError(cmd.Add("allowDiskUse", true))
+	}
+
+	must.NoError(cmd.Add("$db", db))
+
+	res, err := c.cursor(ctx, cmd, opts.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.Aggregate: %w", err)
+	}
+
+	return res, nil
+}
+
+// Count returns the number of documents matching the query with `count` command.
+// Query may be nil.
+func (c *Conn) Count(ctx context.Context, db, collection string, query *wirebson.Document) (int64, error) {
+	cmd := wirebson.MustDocument("count", collection)
+
+	if query != nil {
+		must.NoError(cmd.Add("query", query))
+	}
+
+	must.NoError(cmd.Add("$db", db))
+
+	res, err := c.command(ctx, cmd)
+	if err != nil {
+		return 0, fmt.Errorf("wireclient.Conn.Count: %w", err)
+	}
+
+	switch n := res.Get("n").(type) {
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case float64:
+		return int64(n), nil
+	default:
+		return 0, fmt.Errorf("wireclient.Conn.Count: invalid n: %v", n)
+	}
+}
+
+// Distinct returns distinct values of the given field in documents matching the query
+// with `distinct` command.
+// Query may be nil.
+func (c *Conn) Distinct(ctx context.Context, db, collection, key string, query *wirebson.Document) (*wirebson.Array, error) {
+	cmd := wirebson.MustDocument(
+		"distinct", collection,
+		"key", key,
+	)
+
+	if query != nil {
+		must.NoError(cmd.Add("query", query))
+	}
+
+	must.NoError(cmd.Add("$db", db))
+
+	res, err := c.command(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.Distinct: %w", err)
+	}
+
+	values, ok := res.Get("values").(*wirebson.Array)
+	if !ok {
+		return nil, fmt.Errorf("wireclient.Conn.Distinct: invalid values: %v", res.Get("values"))
+	}
+
+	return values, nil
+}
+
+// CreateIndexes creates indexes with `createIndexes` command.
+//
+// Each index is a document like `{key: {field: 1}, name: "field_1", unique: true}`.
+// If name is absent, it is generated from the key the same way as the server and other drivers do.
+func (c *Conn) CreateIndexes(ctx context.Context, db, collection string, indexes []*wirebson.Document) (*CreateIndexesResult, error) {
+	specs := wirebson.MakeArray(len(indexes))
+
+	for _, index := range indexes {
+		if index.Get("name") == nil {
+			key, ok := index.Get("key").(*wirebson.Document)
+			if !ok {
+				return nil, fmt.Errorf("wireclient.Conn.CreateIndexes: invalid index key: %v", index.Get("key"))
+			}
+
+			index = index.Copy()
+			must.NoError(index.Add("name", indexName(key)))
+		}
+
+		must.NoError(specs.Add(index))
+	}
+
+	cmd := wirebson.MustDocument(
+		"createIndexes", collection,
+		"indexes", specs,
+		"$db", db,
+	)
+
+	res, err := c.command(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.CreateIndexes: %w", err)
+	}
+
+	note, _ := res.Get("note").(string)
+	created, _ := res.Get("createdCollectionAutomatically").(bool)
+
+	return &CreateIndexesResult{
+		Note:                           note,
+		NumIndexesBefore:               toInt32(res.Get("numIndexesBefore")),
+		NumIndexesAfter:                toInt32(res.Get("numIndexesAfter")),
+		CreatedCollectionAutomatically: created,
+	}, nil
+}
+
+// Drop drops the collection with `drop` command.
+// It does not return an error if the collection does not exist.
+func (c *Conn) Drop(ctx context.Context, db, collection string) error {
+	cmd := wirebson.MustDocument(
+		"drop", collection,
+		"$db", db,
+	)
+
+	_, err := c.command(ctx, cmd)
+
+	var ce *CommandError
+	if errors.As(err, &ce) && ce.Code == codeNamespaceNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("wireclient.Conn.Drop: %w", err)
+	}
+
+	return nil
+}
+
+// command sends the given command document and returns the response document.
+// It returns error if the command failed; see [Conn.RequestCommand].
+func (c *Conn) command(ctx context.Context, cmd *wirebson.Document) (*wirebson.Document, error) {
+	body, err := wire.NewOpMsg(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.command: %w", err)
+	}
+
+	res, err := c.RequestCommand(ctx, body)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.command: %w", err)
+	}
+
+	return res, nil
+}
+
+// cursor sends the given command and returns a cursor for its response.
+func (c *Conn) cursor(ctx context.Context, cmd *wirebson.Document, batchSize int32) (*Cursor, error) {
+	res, err := c.command(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.cursor: %w", err)
+	}
+
+	cursor, err := NewCursor(c, res)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.cursor: %w", err)
+	}
+
+	cursor.BatchSize = batchSize
+
+	return cursor, nil
+}
+
+// writeCommand returns the section 0 document for `insert`, `update`, or `delete` command.
+func writeCommand(command, collection, db string, opts *WriteOpts, bypass bool) *wirebson.Document {
+	cmd := wirebson.MustDocument(
+		command, collection,
+		"ordered", !opts.Unordered,
+	)
+
+	if opts.WriteConcern != nil {
+		must.NoError(cmd.Add("writeConcern", opts.WriteConcern))
+	}
+
+	if bypass && opts.BypassDocumentValidation {
+		must.NoError(cmd.Add("bypassDocumentValidation", true))
+	}
+
+	must.NoError(cmd.Add("$db", db))
+
+	return cmd
+}
+
+// write sends the given write command with documents in sections of kind 1 with the given identifier,
+// split into batches according to server limits.
+//
+// For each acknowledged batch, it calls f with the reply and the index of the first batch document,
+// and returns true if f was called at least once.
+// Write errors of all batches are combined into a single [*WriteException].
+// Unless unordered is true, batches after one with write errors are not sent.
+// If a later batch fails with other error, that error is returned wrapping both itself
+// and [*WriteException] of previous batches, if any.
+func (c *Conn) write(
+	ctx context.Context, cmd *wirebson.Document, identifier string, docs []*wirebson.Document,
+	unordered bool, f func(reply *wirebson.Document, offset int),
+) (bool, error) {
+	section0, err := cmd.Encode()
+	if err != nil {
+		return false, fmt.Errorf("wireclient.Conn.write: %w", err)
+	}
+
+	batches, err := c.batches(len(section0), identifier, docs)
+	if err != nil {
+		return false, fmt.Errorf("wireclient.Conn.write: %w", err)
+	}
+
+	var we *WriteException
+	var offset int
+	var replied bool
+
+	for _, batch := range batches {
+		var body *wire.OpMsg
+		if body, err = wire.NewOpMsg(section0); err != nil {
+			return replied, fmt.Errorf("wireclient.Conn.write: %w", err)
+		}
+
+		if err = body.AddSequence(identifier, batch); err != nil {
+			return replied, fmt.Errorf("wireclient.Conn.write: %w", err)
+		}
+
+		var reply *wirebson.Document
+		reply, err = c.RequestCommand(ctx, body)
+
+		var e *WriteException
+		switch {
+		case errors.As(err, &e):
+			reply = e.Reply
+			we = mergeWriteException(we, e, offset)
+
+		case err != nil && we != nil:
+			return replied, fmt.Errorf("wireclient.Conn.write: %w (after %w)", err, we)
+
+		case err != nil:
+			return replied, fmt.Errorf("wireclient.Conn.write: %w", err)
+		}
+
+		f(reply, offset)
+		replied = true
+
+		if !unordered && e != nil && len(e.WriteErrors) > 0 {
+			break
+		}
+
+		offset += len(batch)
+	}
+
+	if we != nil {
+		return replied, fmt.Errorf("wireclient.Conn.write: %w", we)
+	}
+
+	return replied, nil
+}
+
+// batches encodes and splits the given documents into batches
+// that do not exceed `maxWriteBatchSize` documents and `maxMessageSizeBytes` message size,
+// given the size of section 0 document and the sequence identifier.
+//
+// It returns an error if any document exceeds `maxBsonObjectSize`.
+func (c *Conn) batches(section0Size int, identifier string, docs []*wirebson.Document) ([][]wirebson.AnyDocument, error) {
+	maxBatch, maxObject, maxMessage := int(DefaultMaxWriteBatchSize), int(DefaultMaxBsonObjectSize), int(DefaultMaxMessageSizeBytes)
+	if c.desc != nil {
+		maxBatch, maxObject, maxMessage = int(c.desc.MaxWriteBatchSize), int(c.desc.MaxBsonObjectSize), int(c.desc.MaxMessageSizeBytes)
+	}
+
+	// header, flags, section 0 kind and document, section 1 kind, size, and identifier, optional checksum
+	overhead := wire.MsgHeaderLen + 4 + 1 + section0Size + 1 + 4 + len(identifier) + 1 + 4
+
+	var res [][]wirebson.AnyDocument
+	var batch []wirebson.AnyDocument
+	var size int
+
+	for i, doc := range docs {
+		raw, err := doc.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("batches: %w", err)
+		}
+
+		if len(raw) > maxObject {
+			return nil, fmt.Errorf("batches: document %d is too large: %d > %d bytes", i, len(raw), maxObject)
+		}
+
+		if len(batch) > 0 && (len(batch) >= maxBatch || overhead+size+len(raw) > maxMessage) {
+			res = append(res, batch)
+			batch, size = nil, 0
+		}
+
+		batch = append(batch, raw)
+		size += len(raw)
+	}
+
+	if len(batch) > 0 {
+		res = append(res, batch)
+	}
+
+	return res, nil
+}
+
+// mergeWriteException adds write errors of e to we (that may be nil) with indexes shifted by offset,
+// and returns we.
+func mergeWriteException(we, e *WriteException, offset int) *WriteException {
+	if we == nil {
+		we = new(WriteException)
+	}
+
+	we.Reply = e.Reply
+
+	for _, w := range e.WriteErrors {
+		w.Index += int32(offset)
+		we.WriteErrors = append(we.WriteErrors, w)
+	}
+
+	if e.WriteConcernError != nil {
+		we.WriteConcernError = e.WriteConcernError
+	}
+
+	for _, label := range e.Labels {
+		if !slices.Contains(we.Labels, label) {
+			we.Labels = append(we.Labels, label)
+		}
+	}
+
+	return we
+}
+
+// writeResult returns the result with the given error if at least one batch reply was applied to it,
+// or nil result otherwise.
+func writeResult[T any](res *T, replied bool, err error) (*T, error) {
+	if replied {
+		return res, err
+	}
+
+	return nil, err
+}
+
+// indexName returns the default index name for the given key like `a_1_b_-1`.
+func indexName(key *wirebson.Document) string {
+	parts := make([]string, 0, key.Len()*2)
+
+	for k, v := range key.All() {
+		parts = append(parts, k, fmt.Sprint(v))
+	}
+
+	return strings.Join(parts, "_")
+}
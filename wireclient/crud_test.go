@@ -0,0 +1,573 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireserver"
+)
+
+// crudHandler is a fake server handler for CRUD commands.
+//
+// Write commands report statements with `_id: "dup"` or `q: {_id: "dup"}` as write errors
+// and stop processing ordered batches on them.
+// Statements with `_id: "fail"` make the whole command fail.
+// Other commands return fixed replies.
+func crudHandler(t *testing.T, reqs chan<- *wire.OpMsg) wireserver.HandlerFunc {
+	return func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		reqs <- req
+
+		doc, err := req.Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+
+		command := doc.Command()
+
+		switch command {
+		case "hello":
+			return wire.NewOpMsg(wirebson.MustDocument(
+				"maxWriteBatchSize", int32(2),
+				"maxMessageSizeBytes", int32(512),
+				"maxBsonObjectSize", int32(256),
+				"ok", float64(1),
+			))
+
+		case "insert", "update", "delete":
+			identifier := map[string]string{"insert": "documents", "update": "updates", "delete": "deletes"}[command]
+
+			var n int32
+			writeErrors := wirebson.MakeArray(0)
+			upserted := wirebson.MakeArray(0)
+
+			for i, raw := range req.Sequence(identifier) {
+				var stmt *wirebson.Document
+				stmt, err = raw.DecodeDeep()
+				require.NoError(t, err)
+
+				id := stmt.Get("_id")
+				if q, ok := stmt.Get("q").(*wirebson.Document); ok {
+					id = q.Get("_id")
+				}
+
+				if id == "fail" {
+					return nil, &wireserver.Error{Message: "not primary", Name: "NotWritablePrimary", Code: 10107}
+				}
+
+				if id == "dup" {
+					must.NoError(writeErrors.Add(wirebson.MustDocument(
+						"index", int32(i),
+						"code", int32(11000),
+						"errmsg", "duplicate key",
+					)))
+
+					if doc.Get("ordered") == true {
+						break
+					}
+
+					continue
+				}
+
+				if stmt.Get("upsert") == true {
+					must.NoError(upserted.Add(wirebson.MustDocument("index", int32(i), "_id", id)))
+				}
+
+				n++
+			}
+
+			res := wirebson.MustDocument("n", n)
+
+			if command == "update" {
+				must.NoError(res.Add("nModified", n-int32(upserted.Len())))
+
+				if upserted.Len() > 0 {
+					must.NoError(res.Add("upserted", upserted))
+				}
+			}
+
+			if writeErrors.Len() > 0 {
+				must.NoError(res.Add("writeErrors", writeErrors))
+			}
+
+			must.NoError(res.Add("ok", float64(1)))
+
+			return wire.NewOpMsg(res)
+
+		case "find", "aggregate":
+			return wire.MustOpMsg(
+				"cursor", wirebson.MustDocument(
+					"firstBatch", wirebson.MustArray(wirebson.MustDocument("v", int32(1))),
+					"id", int64(0),
+					"ns", "test.values",
+				),
+				"ok", float64(1),
+			), nil
+
+		case "count":
+			return wire.MustOpMsg("n", int32(3), "ok", float64(1)), nil
+
+		case "distinct":
+			return wire.MustOpMsg("values", wirebson.MustArray(int32(1), "a"), "ok", float64(1)), nil
+
+		case "createIndexes":
+			return wire.MustOpMsg(
+				"createdCollectionAutomatically", true,
+				"numIndexesBefore", int32(1),
+				"numIndexesAfter", int32(3),
+				"ok", float64(1),
+			), nil
+
+		case "drop":
+			if doc.Get("drop") == "missing" {
+				return nil, &wireserver.Error{Message: "ns not found", Name: "NamespaceNotFound", Code: 26}
+			}
+
+			if doc.Get("drop") == "unauthorized" {
+				return nil, &wireserver.Error{Message: "not authorized", Name: "Unauthorized", Code: 13}
+			}
+
+			return wire.MustOpMsg("ok", float64(1)), nil
+
+		default:
+			return nil, &wireserver.Error{Message: "no such command", Name: "CommandNotFound", Code: 59}
+		}
+	}
+}
+
+// setupCRUD starts a fake server with [crudHandler] and returns a connection to it
+// and a channel with received messages.
+// If handshake is true, the connection uses small limits returned by the server.
+func setupCRUD(t *testing.T, handshake bool) (*Conn, <-chan *wire.OpMsg) {
+	t.Helper()
+
+	reqs := make(chan *wire.OpMsg, 100)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serve(t, l, crudHandler(t, reqs))
+
+	conn, err := Connect(t.Context(), "mongodb://"+l.Addr().String()+"/", logger(t))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+	})
+
+	if handshake {
+		_, err = conn.Handshake(t.Context(), nil)
+		require.NoError(t, err)
+		<-reqs
+	}
+
+	return conn, reqs
+}
+
+// sequenceIDs returns `_id` values of the sequence documents.
+func sequenceIDs(t *testing.T, msg *wire.OpMsg, identifier string) []any {
+	t.Helper()
+
+	var res []any
+
+	for _, raw := range msg.Sequence(identifier) {
+		doc, err := raw.Decode()
+		require.NoError(t, err)
+
+		res = append(res, doc.Get("_id"))
+	}
+
+	return res
+}
+
+func TestConnCRUD(t *testing.T) {
+	t.Parallel()
+
+	docs := func(ids ...any) []*wirebson.Document {
+		res := make([]*wirebson.Document, len(ids))
+		for i, id := range ids {
+			res[i] = wirebson.MustDocument("_id", id)
+		}
+
+		return res
+	}
+
+	t.Run("Insert", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, false)
+
+		res, err := conn.Insert(t.Context(), "test", "values", docs(int32(1), int32(2), int32(3)), &WriteOpts{
+			WriteConcern:             wirebson.MustDocument("w", int32(1)),
+			BypassDocumentValidation: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, &InsertResult{N: 3}, res)
+
+		msg := <-reqs
+		assert.Equal(t, []any{int32(1), int32(2), int32(3)}, sequenceIDs(t, msg, "documents"))
+
+		cmd, err := msg.Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+
+		expected := wirebson.MustDocument(
+			"insert", "values",
+			"ordered", true,
+			"writeConcern", wirebson.MustDocument("w", int32(1)),
+			"bypassDocumentValidation", true,
+			"$db", "test",
+		)
+		assert.Equal(t, expected, cmd)
+	})
+
+	t.Run("InsertBatches", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, true)
+
+		res, err := conn.Insert(t.Context(), "test", "values", docs(int32(1), int32(2), int32(3), int32(4), int32(5)), nil)
+		require.NoError(t, err)
+		assert.Equal(t, &InsertResult{N: 5}, res)
+
+		assert.Equal(t, []any{int32(1), int32(2)}, sequenceIDs(t, <-reqs, "documents"))
+		assert.Equal(t, []any{int32(3), int32(4)}, sequenceIDs(t, <-reqs, "documents"))
+		assert.Equal(t, []any{int32(5)}, sequenceIDs(t, <-reqs, "documents"))
+		assert.Empty(t, reqs)
+	})
+
+	t.Run("InsertMessageSize", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, true)
+
+		// each document is about 240 bytes, so only one fits into 512 bytes message
+		big := strings.Repeat("x", 220)
+
+		res, err := conn.Insert(t.Context(), "test", "values", docs(big+"1", big+"2", big+"3"), nil)
+		require.NoError(t, err)
+		assert.Equal(t, &InsertResult{N: 3}, res)
+
+		assert.Equal(t, []any{big + "1"}, sequenceIDs(t, <-reqs, "documents"))
+		assert.Equal(t, []any{big + "2"}, sequenceIDs(t, <-reqs, "documents"))
+		assert.Equal(t, []any{big + "3"}, sequenceIDs(t, <-reqs, "documents"))
+		assert.Empty(t, reqs)
+	})
+
+	t.Run("InsertTooLarge", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, true)
+
+		res, err := conn.Insert(t.Context(), "test", "values", docs(int32(1), strings.Repeat("x", 300)), nil)
+		require.ErrorContains(t, err, "document 1 is too large")
+		assert.Nil(t, res)
+		assert.Empty(t, reqs)
+	})
+
+	t.Run("InsertOrderedWriteErrors", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, true)
+
+		res, err := conn.Insert(t.Context(), "test", "values", docs(int32(1), int32(2), "dup", int32(4), int32(5)), nil)
+		assert.Equal(t, &InsertResult{N: 2}, res)
+
+		var we *WriteException
+		require.ErrorAs(t, err, &we)
+		require.Len(t, we.WriteErrors, 1)
+		assert.Equal(t, int32(2), we.WriteErrors[0].Index)
+		assert.Equal(t, int32(11000), we.WriteErrors[0].Code)
+
+		<-reqs
+		<-reqs
+		assert.Empty(t, reqs, "remaining batches should not be sent")
+	})
+
+	t.Run("InsertUnorderedWriteErrors", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, true)
+
+		res, err := conn.Insert(t.Context(), "test", "values", docs("dup", int32(2), int32(3), "dup", int32(5)), &WriteOpts{
+			Unordered: true,
+		})
+		assert.Equal(t, &InsertResult{N: 3}, res)
+
+		var we *WriteException
+		require.ErrorAs(t, err, &we)
+		require.Len(t, we.WriteErrors, 2)
+		assert.Equal(t, int32(0), we.WriteErrors[0].Index)
+		assert.Equal(t, int32(3), we.WriteErrors[1].Index)
+
+		cmd, err := (<-reqs).Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+		assert.Equal(t, false, cmd.Get("ordered"))
+
+		<-reqs
+		<-reqs
+		assert.Empty(t, reqs)
+	})
+
+	t.Run("InsertLaterBatchError", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, true)
+
+		res, err := conn.Insert(t.Context(), "test", "values", docs(int32(1), int32(2), "fail"), nil)
+		assert.Equal(t, &InsertResult{N: 2}, res, "result of the first batch should be kept")
+
+		var ce *CommandError
+		require.ErrorAs(t, err, &ce)
+		assert.Equal(t, int32(10107), ce.Code)
+
+		var we *WriteException
+		assert.False(t, errors.As(err, &we))
+
+		res, err = conn.Insert(t.Context(), "test", "values", docs("dup", int32(2), int32(3), "fail"), &WriteOpts{
+			Unordered: true,
+		})
+		assert.Equal(t, &InsertResult{N: 1}, res, "result of the first batch should be kept")
+
+		require.ErrorAs(t, err, &ce)
+		assert.Equal(t, int32(10107), ce.Code)
+
+		require.ErrorAs(t, err, &we, "write errors of the first batch should be kept")
+		require.Len(t, we.WriteErrors, 1)
+		assert.Equal(t, int32(0), we.WriteErrors[0].Index)
+
+		res, err = conn.Insert(t.Context(), "test", "values", docs("fail"), nil)
+		require.ErrorAs(t, err, &ce)
+		assert.Nil(t, res)
+
+		for range 5 {
+			<-reqs
+		}
+
+		assert.Empty(t, reqs)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, true)
+
+		updates := []*wirebson.Document{
+			wirebson.MustDocument("q", wirebson.MustDocument("_id", int32(1)), "u", wirebson.MustDocument("v", int32(1))),
+			wirebson.MustDocument("q", wirebson.MustDocument("_id", int32(2)), "u", wirebson.MustDocument("v", int32(2))),
+			wirebson.MustDocument(
+				"q", wirebson.MustDocument("_id", int32(3)),
+				"u", wirebson.MustDocument("v", int32(3)),
+				"upsert", true,
+			),
+		}
+
+		res, err := conn.Update(t.Context(), "test", "values", updates, nil)
+		require.NoError(t, err)
+
+		expected := &UpdateResult{
+			Upserted:  []Upserted{{ID: int32(3), Index: 2}},
+			N:         3,
+			NModified: 2,
+		}
+		assert.Equal(t, expected, res)
+
+		msg := <-reqs
+		assert.Len(t, msg.Sequence("updates"), 2)
+		assert.Len(t, (<-reqs).Sequence("updates"), 1)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, false)
+
+		deletes := []*wirebson.Document{
+			wirebson.MustDocument("q", wirebson.MustDocument("_id", int32(1)), "limit", int32(1)),
+			wirebson.MustDocument("q", wirebson.MustDocument("_id", "dup"), "limit", int32(1)),
+		}
+
+		res, err := conn.Delete(t.Context(), "test", "values", deletes, &WriteOpts{BypassDocumentValidation: true})
+		assert.Equal(t, &DeleteResult{N: 1}, res)
+
+		var we *WriteException
+		require.ErrorAs(t, err, &we)
+		assert.Equal(t, int32(1), we.WriteErrors[0].Index)
+
+		cmd, err := (<-reqs).Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+		assert.Equal(t, wirebson.MustDocument("delete", "values", "ordered", true, "$db", "test"), cmd)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, false)
+
+		c, err := conn.Find(t.Context(), "test", "values", wirebson.MustDocument("v", int32(1)), &FindOpts{
+			Sort:      wirebson.MustDocument("_id", int32(-1)),
+			Limit:     10,
+			BatchSize: 5,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int32(5), c.BatchSize)
+
+		var actual []*wirebson.Document
+		for doc, derr := range c.All(t.Context()) {
+			require.NoError(t, derr)
+			actual = append(actual, doc)
+		}
+
+		assert.Equal(t, []*wirebson.Document{wirebson.MustDocument("v", int32(1))}, actual)
+
+		cmd, err := (<-reqs).Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+
+		expected := wirebson.MustDocument(
+			"find", "values",
+			"filter", wirebson.MustDocument("v", int32(1)),
+			"sort", wirebson.MustDocument("_id", int32(-1)),
+			"limit", int64(10),
+			"batchSize", int32(5),
+			"$db", "test",
+		)
+		assert.Equal(t, expected, cmd)
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, false)
+
+		pipeline := wirebson.MustArray(wirebson.MustDocument("$match", wirebson.MustDocument("v", int32(1))))
+
+		c, err := conn.Aggregate(t.Context(), "test", "values", pipeline, &AggregateOpts{AllowDiskUse: true})
+		require.NoError(t, err)
+		require.NoError(t, c.Close(t.Context()))
+
+		cmd, err := (<-reqs).Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+
+		expected := wirebson.MustDocument(
+			"aggregate", "values",
+			"pipeline", pipeline,
+			"cursor", wirebson.MakeDocument(0),
+			"allowDiskUse", true,
+			"$db", "test",
+		)
+		assert.Equal(t, expected, cmd)
+
+		_, err = conn.Aggregate(t.Context(), "admin", "", nil, &AggregateOpts{BatchSize: 1})
+		require.NoError(t, err)
+
+		cmd, err = (<-reqs).Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+
+		expected = wirebson.MustDocument(
+			"aggregate", int32(1),
+			"pipeline", wirebson.MakeArray(0),
+			"cursor", wirebson.MustDocument("batchSize", int32(1)),
+			"$db", "admin",
+		)
+		assert.Equal(t, expected, cmd)
+	})
+
+	t.Run("CountDistinct", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, false)
+
+		n, err := conn.Count(t.Context(), "test", "values", nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+
+		cmd, err := (<-reqs).Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+		assert.Equal(t, wirebson.MustDocument("count", "values", "$db", "test"), cmd)
+
+		values, err := conn.Distinct(t.Context(), "test", "values", "v", wirebson.MustDocument("v", int32(1)))
+		require.NoError(t, err)
+		assert.Equal(t, wirebson.MustArray(int32(1), "a"), values)
+
+		cmd, err = (<-reqs).Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+
+		expected := wirebson.MustDocument(
+			"distinct", "values",
+			"key", "v",
+			"query", wirebson.MustDocument("v", int32(1)),
+			"$db", "test",
+		)
+		assert.Equal(t, expected, cmd)
+	})
+
+	t.Run("CreateIndexes", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupCRUD(t, false)
+
+		indexes := []*wirebson.Document{
+			wirebson.MustDocument("key", wirebson.MustDocument("a", int32(1), "b", int32(-1)), "unique", true),
+			wirebson.MustDocument("key", wirebson.MustDocument("c", "text"), "name", "custom"),
+		}
+
+		res, err := conn.CreateIndexes(t.Context(), "test", "values", indexes)
+		require.NoError(t, err)
+
+		expected := &CreateIndexesResult{
+			NumIndexesBefore:               1,
+			NumIndexesAfter:                3,
+			CreatedCollectionAutomatically: true,
+		}
+		assert.Equal(t, expected, res)
+
+		cmd, err := (<-reqs).Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+
+		specs := wirebson.MustArray(
+			wirebson.MustDocument(
+				"key", wirebson.MustDocument("a", int32(1), "b", int32(-1)),
+				"unique", true,
+				"name", "a_1_b_-1",
+			),
+			wirebson.MustDocument("key", wirebson.MustDocument("c", "text"), "name", "custom"),
+		)
+		assert.Equal(t, specs, cmd.Get("indexes"))
+		assert.Nil(t, indexes[0].Get("name"), "passed document should not be modified")
+
+		_, err = conn.CreateIndexes(t.Context(), "test", "values", []*wirebson.Document{wirebson.MustDocument("unique", true)})
+		require.ErrorContains(t, err, "invalid index key")
+	})
+
+	t.Run("Drop", func(t *testing.T) {
+		t.Parallel()
+
+		conn, _ := setupCRUD(t, false)
+
+		require.NoError(t, conn.Drop(t.Context(), "test", "values"))
+		require.NoError(t, conn.Drop(t.Context(), "test", "missing"))
+
+		var ce *CommandError
+		require.ErrorAs(t, conn.Drop(t.Context(), "test", "unauthorized"), &ce)
+		assert.Equal(t, int32(13), ce.Code)
+	})
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// Cursor iterates over documents returned by `find`, `aggregate`, and other commands that return cursors.
+//
+// It is not safe for concurrent use.
+type Cursor struct {
+	conn       *Conn
+	db         string
+	collection string
+	batch      []*wirebson.Document
+	id         int64
+
+	// BatchSize is sent with `getMore` commands, if set.
+	BatchSize int32
+}
+
+// NewCursor creates a new cursor from the given command response
+// like `{cursor: {firstBatch: [...], id: 123, ns: "db.collection"}, ok: 1}`.
+//
+// The cursor uses the given connection for `getMore` and `killCursors` commands.
+func NewCursor(conn *Conn, res *wirebson.Document) (*Cursor, error) {
+	if err := ReplyError(res); err != nil {
+		return nil, fmt.Errorf("wireclient.NewCursor: %w", err)
+	}
+
+	c := &Cursor{
+		conn: conn,
+	}
+
+	if err := c.update(res, "firstBatch"); err != nil {
+		return nil, fmt.Errorf("wireclient.NewCursor: %w", err)
+	}
+
+	return c, nil
+}
+
+// ID returns the server cursor ID.
+// It is 0 if the cursor was exhausted or closed.
+func (c *Cursor) ID() int64 {
+	return c.id
+}
+
+// All returns an iterator over all cursor's documents.
+// It sends `getMore` commands when the current batch is consumed.
+//
+// If an error occurs, it is yielded with nil document, and iteration stops.
+// If iteration is stopped early, `killCursors` command is sent.
+// Context is used for those commands.
+func (c *Cursor) All(ctx context.Context) iter.Seq2[*wirebson.Document, error] {
+	return func(yield func(*wirebson.Document, error) bool) {
+		for {
+			for len(c.batch) > 0 {
+				doc := c.batch[0]
+				c.batch = c.batch[1:]
+
+				if !yield(doc, nil) {
+					// there is nobody to report the error to; the cursor will time out on the server anyway
+					_ = c.Close(ctx)
+					return
+				}
+			}
+
+			if c.id == 0 {
+				return
+			}
+
+			if err := c.getMore(ctx); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// Close drops remaining documents and sends `killCursors` command if the cursor is not exhausted.
+func (c *Cursor) Close(ctx context.Context) error {
+	c.batch = nil
+
+	if c.id == 0 {
+		return nil
+	}
+
+	id := c.id
+	c.id = 0
+
+	cmd := wirebson.MustDocument(
+		"killCursors", c.collection,
+		"cursors", wirebson.MustArray(id),
+		"$db", c.db,
+	)
+
+	if _, err := c.request(ctx, cmd); err != nil {
+		return fmt.Errorf("wireclient.Cursor.Close: %w", err)
+	}
+
+	return nil
+}
+
+// getMore fetches the next batch.
+func (c *Cursor) getMore(ctx context.Context) error {
+	cmd := wirebson.MustDocument(
+		"getMore", c.id,
+		"collection", c.collection,
+	)
+
+	if c.BatchSize > 0 {
+		must.NoError(cmd.Add("batchSize", c.BatchSize))
+	}
+
+	must.NoError(cmd.Add("$db", c.db))
+
+	res, err := c.request(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("wireclient.Cursor.getMore: %w", err)
+	}
+
+	if err = c.update(res, "nextBatch"); err != nil {
+		return fmt.Errorf("wireclient.Cursor.getMore: %w", err)
+	}
+
+	return nil
+}
+
+// request sends the command and returns the response document.
+// It returns error if the command failed; see [Conn.RequestCommand].
+func (c *Cursor) request(ctx context.Context, cmd *wirebson.Document) (*wirebson.Document, error) {
+	body, err := wire.NewOpMsg(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Cursor.request: %w", err)
+	}
+
+	res, err := c.conn.RequestCommand(ctx, body)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Cursor.request: %w", err)
+	}
+
+	return res, nil
+}
+
+// update sets cursor ID, namespace, and current batch from the given response.
+func (c *Cursor) update(res *wirebson.Document, batchField string) error {
+	cursor, ok := res.Get("cursor").(*wirebson.Document)
+	if !ok {
+		return fmt.Errorf("wireclient.Cursor.update: invalid cursor in response: %v", res.Get("cursor"))
+	}
+
+	if c.id, ok = cursor.Get("id").(int64); !ok {
+		return fmt.Errorf("wireclient.Cursor.update: invalid cursor ID: %v", cursor.Get("id"))
+	}
+
+	ns, ok := cursor.Get("ns").(string)
+	if !ok {
+		return fmt.Errorf("wireclient.Cursor.update: invalid cursor namespace: %v", cursor.Get("ns"))
+	}
+
+	var found bool
+	if c.db, c.collection, found = strings.Cut(ns, "."); !found {
+		return fmt.Errorf("wireclient.Cursor.update: invalid cursor namespace: %q", ns)
+	}
+
+	batch, ok := cursor.Get(batchField).(*wirebson.Array)
+	if !ok {
+		return fmt.Errorf("wireclient.Cursor.update: invalid %s: %v", batchField, cursor.Get(batchField))
+	}
+
+	c.batch = make([]*wirebson.Document, 0, batch.Len())
+
+	for v := range batch.Values() {
+		var doc *wirebson.Document
+		if doc, ok = v.(*wirebson.Document); !ok {
+			return fmt.Errorf("wireclient.Cursor.update: invalid %s element: %v", batchField, v)
+		}
+
+		c.batch = append(c.batch, doc)
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireserver"
+)
+
+// cursorServer is a fake server that returns documents {v: 0} ... {v: n-1} in batches of 2.
+type cursorServer struct {
+	killed     []int64
+	batchSizes []any // of getMore commands
+	m          sync.Mutex
+	n          int32
+	next       int32
+}
+
+// state returns killed cursor IDs and batch sizes of getMore commands.
+func (s *cursorServer) state() ([]int64, []any) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.killed, s.batchSizes
+}
+
+// batch returns the next batch and the cursor ID.
+func (s *cursorServer) batch() (*wirebson.Array, int64) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	batch := wirebson.MakeArray(2)
+
+	for ; s.next < s.n && batch.Len() < 2; s.next++ {
+		must.NoError(batch.Add(wirebson.MustDocument("v", s.next)))
+	}
+
+	var id int64
+	if s.next < s.n {
+		id = 42
+	}
+
+	return batch, id
+}
+
+// setupCursor starts a fake server and returns a connection to it.
+func setupCursor(t *testing.T, s *cursorServer) *Conn {
+	t.Helper()
+
+	mux := wireserver.NewMux()
+
+	mux.RegisterFunc("ping", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	mux.RegisterFunc("find", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		batch, id := s.batch()
+
+		return wire.MustOpMsg(
+			"cursor", wirebson.MustDocument("firstBatch", batch, "id", id, "ns", "test.values"),
+			"ok", float64(1),
+		), nil
+	})
+
+	mux.RegisterFunc("getMore", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		doc, err := req.DocumentDeep()
+		require.NoError(t, err)
+
+		if doc.Get("getMore") != int64(42) || doc.Get("collection") != "values" || doc.Get("$db") != "test" {
+			return nil, &wireserver.Error{Message: "cursor not found", Name: "CursorNotFound", Code: 43}
+		}
+
+		s.m.Lock()
+		s.batchSizes = append(s.batchSizes, doc.Get("batchSize"))
+		s.m.Unlock()
+
+		batch, id := s.batch()
+
+		return wire.MustOpMsg(
+			"cursor", wirebson.MustDocument("nextBatch", batch, "id", id, "ns", "test.values"),
+			"ok", float64(1),
+		), nil
+	})
+
+	mux.RegisterFunc("killCursors", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		doc, err := req.DocumentDeep()
+		require.NoError(t, err)
+
+		assert.Equal(t, "values", doc.Get("killCursors"))
+
+		s.m.Lock()
+		for v := range doc.Get("cursors").(*wirebson.Array).Values() {
+			s.killed = append(s.killed, v.(int64))
+		}
+		s.m.Unlock()
+
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serve(t, l, mux)
+
+	conn, err := Connect(t.Context(), "mongodb://"+l.Addr().String()+"/", logger(t))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+	})
+
+	return conn
+}
+
+// find sends `find` command and returns a cursor.
+func find(t *testing.T, conn *Conn) *Cursor {
+	t.Helper()
+
+	_, body, err := conn.Request(t.Context(), wire.MustOpMsg("find", "values", "$db", "test"))
+	require.NoError(t, err)
+
+	res, err := body.(*wire.OpMsg).DocumentDeep()
+	require.NoError(t, err)
+
+	c, err := NewCursor(conn, res)
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestCursor(t *testing.T) {
+	t.Parallel()
+
+	t.Run("All", func(t *testing.T) {
+		t.Parallel()
+
+		s := &cursorServer{n: 5}
+		conn := setupCursor(t, s)
+
+		c := find(t, conn)
+		c.BatchSize = 2
+		assert.Equal(t, int64(42), c.ID())
+
+		var actual []any
+
+		for doc, err := range c.All(t.Context()) {
+			require.NoError(t, err)
+			actual = append(actual, doc.Get("v"))
+		}
+
+		assert.Equal(t, []any{int32(0), int32(1), int32(2), int32(3), int32(4)}, actual)
+		assert.Equal(t, int64(0), c.ID())
+
+		killed, batchSizes := s.state()
+		assert.Equal(t, []any{int32(2), int32(2)}, batchSizes)
+		assert.Empty(t, killed)
+
+		require.NoError(t, c.Close(t.Context()))
+
+		killed, _ = s.state()
+		assert.Empty(t, killed)
+	})
+
+	t.Run("EarlyStop", func(t *testing.T) {
+		t.Parallel()
+
+		s := &cursorServer{n: 5}
+		conn := setupCursor(t, s)
+
+		c := find(t, conn)
+
+		var actual []any
+
+		for doc, err := range c.All(t.Context()) {
+			require.NoError(t, err)
+			actual = append(actual, doc.Get("v"))
+
+			if len(actual) == 3 {
+				break
+			}
+		}
+
+		assert.Equal(t, []any{int32(0), int32(1), int32(2)}, actual)
+		assert.Equal(t, int64(0), c.ID())
+
+		killed, _ := s.state()
+		assert.Equal(t, []int64{42}, killed)
+
+		// the connection is still usable
+		require.NoError(t, conn.Ping(t.Context()))
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		t.Parallel()
+
+		s := &cursorServer{n: 5}
+		conn := setupCursor(t, s)
+
+		c := find(t, conn)
+		require.NoError(t, c.Close(t.Context()))
+
+		killed, _ := s.state()
+		assert.Equal(t, []int64{42}, killed)
+
+		for range c.All(t.Context()) {
+			t.Fatal("unexpected document")
+		}
+	})
+
+	t.Run("GetMoreError", func(t *testing.T) {
+		t.Parallel()
+
+		s := &cursorServer{n: 5}
+		conn := setupCursor(t, s)
+
+		c := find(t, conn)
+		c.collection = "other"
+
+		var errs int
+
+		for doc, err := range c.All(t.Context()) {
+			if err != nil {
+				assert.Nil(t, doc)
+				assert.ErrorContains(t, err, "cursor not found")
+				errs++
+			}
+		}
+
+		assert.Equal(t, 1, errs)
+	})
+
+	t.Run("CommandError", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewCursor(nil, wirebson.MustDocument("ok", float64(0), "errmsg", "failed"))
+		require.ErrorContains(t, err, "failed")
+	})
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// CommandError represents a command error returned by the server
+// as `{ok: 0, errmsg, code, codeName, errorLabels}` reply.
+type CommandError struct {
+	Reply   *wirebson.Document // the whole reply document
+	Message string             // errmsg
+	Name    string             // codeName
+	Labels  []string           // errorLabels
+	Code    int32
+}
+
+// Error implements error interface.
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Name, e.Code, e.Message)
+}
+
+// HasErrorLabel returns true if the error has the given label,
+// such as `TransientTransactionError` or `RetryableWriteError`.
+func (e *CommandError) HasErrorLabel(label string) bool {
+	return slices.Contains(e.Labels, label)
+}
+
+// WriteError represents a single element of `writeErrors` reply field.
+type WriteError struct {
+	Message string // errmsg
+	Name    string // codeName; older servers do not send it
+	Index   int32  // index of the failed document in the request
+	Code    int32
+}
+
+// Error implements error interface.
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("write error at index %d: %s (%d): %s", e.Index, e.Name, e.Code, e.Message)
+}
+
+// WriteConcernError represents `writeConcernError` reply field.
+type WriteConcernError struct {
+	Message string // errmsg
+	Name    string // codeName
+	Code    int32
+}
+
+// Error implements error interface.
+func (e *WriteConcernError) Error() string {
+	return fmt.Sprintf("write concern error: %s (%d): %s", e.Name, e.Code, e.Message)
+}
+
+// WriteException represents write errors returned by the server in `{ok: 1}` reply
+// to `insert`, `update`, `delete`, and similar commands.
+type WriteException struct {
+	Reply             *wirebson.Document // the whole reply document
+	WriteConcernError *WriteConcernError // nil if absent
+	Labels            []string           // errorLabels
+	WriteErrors       []WriteError
+}
+
+// Error implements error interface.
+func (e *WriteException) Error() string {
+	msgs := make([]string, 0, len(e.WriteErrors)+1)
+
+	for _, we := range e.WriteErrors {
+		msgs = append(msgs, we.Error())
+	}
+
+	if e.WriteConcernError != nil {
+		msgs = append(msgs, e.WriteConcernError.Error())
+	}
+
+	return "write exception: " + strings.Join(msgs, "; ")
+}
+
+// HasErrorLabel returns true if the exception has the given label.
+func (e *WriteException) HasErrorLabel(label string) bool {
+	return slices.Contains(e.Labels, label)
+}
+
+// ReplyError returns an error for the given command reply document:
+//   - [*CommandError] if `ok` field is not 1;
+//   - [*WriteException] if `writeErrors` or `writeConcernError` fields are present;
+//   - nil otherwise.
+//
+// The document should be decoded deeply.
+func ReplyError(res *wirebson.Document) error {
+	if !isOK(res.Get("ok")) {
+		code := toInt32(res.Get("code"))
+		msg, _ := res.Get("errmsg").(string)
+		name, _ := res.Get("codeName").(string)
+
+		if msg == "" {
+			msg = fmt.Sprintf("command failed (ok was %v)", res.Get("ok"))
+		}
+
+		return &CommandError{
+			Reply:   res,
+			Message: msg,
+			Name:    name,
+			Labels:  errorLabels(res),
+			Code:    code,
+		}
+	}
+
+	var e *WriteException
+
+	if wes, ok := res.Get("writeErrors").(*wirebson.Array); ok && wes.Len() > 0 {
+		e = &WriteException{
+			WriteErrors: make([]WriteError, 0, wes.Len()),
+		}
+
+		for v := range wes.Values() {
+			doc, _ := v.(*wirebson.Document)
+			if doc == nil {
+				doc = wirebson.MakeDocument(0)
+			}
+
+			index := toInt32(doc.Get("index"))
+			code := toInt32(doc.Get("code"))
+			msg, _ := doc.Get("errmsg").(string)
+			name, _ := doc.Get("codeName").(string)
+
+			e.WriteErrors = append(e.WriteErrors, WriteError{
+				Message: msg,
+				Name:    name,
+				Index:   index,
+				Code:    code,
+			})
+		}
+	}
+
+	if doc, ok := res.Get("writeConcernError").(*wirebson.Document); ok {
+		if e == nil {
+			e = new(WriteException)
+		}
+
+		code := toInt32(doc.Get("code"))
+		msg, _ := doc.Get("errmsg").(string)
+		name, _ := doc.Get("codeName").(string)
+
+		e.WriteConcernError = &WriteConcernError{
+			Message: msg,
+			Name:    name,
+			Code:    code,
+		}
+	}
+
+	if e == nil {
+		return nil
+	}
+
+	e.Reply = res
+	e.Labels = errorLabels(res)
+
+	return e
+}
+
+// errorLabels returns `errorLabels` reply field values.
+func errorLabels(res *wirebson.Document) []string {
+	arr, ok := res.Get("errorLabels").(*wirebson.Array)
+	if !ok {
+		return nil
+	}
+
+	labels := make([]string, 0, arr.Len())
+
+	for v := range arr.Values() {
+		if label, isString := v.(string); isString {
+			labels = append(labels, label)
+		}
+	}
+
+	return labels
+}
+
+// isOK returns true if the given `ok` field value is exactly 1.
+func isOK(v any) bool {
+	switch v := v.(type) {
+	case float64:
+		return v == 1
+	case int32:
+		return v == 1
+	case int64:
+		return v == 1
+	default:
+		return false
+	}
+}
+
+// toInt32 converts numeric BSON value to int32.
+// It returns 0 if the value is not a number.
+func toInt32(v any) int32 {
+	switch v := v.(type) {
+	case float64:
+		return int32(v)
+	case int32:
+		return v
+	case int64:
+		return int32(v)
+	default:
+		return 0
+	}
+}
+
+// check interfaces
+var (
+	_ error = (*CommandError)(nil)
+	_ error = (*WriteError)(nil)
+	_ error = (*WriteConcernError)(nil)
+	_ error = (*WriteException)(nil)
+)
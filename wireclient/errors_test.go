@@ -0,0 +1,207 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireserver"
+)
+
+func TestReplyError(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		res      *wirebson.Document
+		expected error // with nil Reply
+	}{
+		"OK": {
+			res: wirebson.MustDocument("n", int32(1), "ok", float64(1)),
+		},
+		"OKInt32": {
+			res: wirebson.MustDocument("ok", int32(1)),
+		},
+		"CommandError": {
+			res: wirebson.MustDocument(
+				"ok", float64(0),
+				"errmsg", "WriteConflict error",
+				"code", int32(112),
+				"codeName", "WriteConflict",
+				"errorLabels", wirebson.MustArray("TransientTransactionError"),
+			),
+			expected: &CommandError{
+				Message: "WriteConflict error",
+				Name:    "WriteConflict",
+				Labels:  []string{"TransientTransactionError"},
+				Code:    112,
+			},
+		},
+		"CommandErrorNoMessage": {
+			res: wirebson.MustDocument("ok", float64(0)),
+			expected: &CommandError{
+				Message: "command failed (ok was 0)",
+			},
+		},
+		"CommandErrorFraction": {
+			res: wirebson.MustDocument("ok", float64(0.5)),
+			expected: &CommandError{
+				Message: "command failed (ok was 0.5)",
+			},
+		},
+		"CommandErrorAboveOne": {
+			res: wirebson.MustDocument("ok", float64(1.9)),
+			expected: &CommandError{
+				Message: "command failed (ok was 1.9)",
+			},
+		},
+		"WriteErrors": {
+			res: wirebson.MustDocument(
+				"n", int32(1),
+				"writeErrors", wirebson.MustArray(
+					wirebson.MustDocument(
+						"index", int32(1),
+						"code", int32(11000),
+						"errmsg", "E11000 duplicate key error",
+					),
+				),
+				"ok", float64(1),
+			),
+			expected: &WriteException{
+				WriteErrors: []WriteError{{
+					Message: "E11000 duplicate key error",
+					Index:   1,
+					Code:    11000,
+				}},
+			},
+		},
+		"WriteConcernError": {
+			res: wirebson.MustDocument(
+				"n", int32(1),
+				"writeConcernError", wirebson.MustDocument(
+					"code", int32(64),
+					"codeName", "WriteConcernFailed",
+					"errmsg", "waiting for replication timed out",
+				),
+				"errorLabels", wirebson.MustArray("RetryableWriteError"),
+				"ok", float64(1),
+			),
+			expected: &WriteException{
+				WriteConcernError: &WriteConcernError{
+					Message: "waiting for replication timed out",
+					Name:    "WriteConcernFailed",
+					Code:    64,
+				},
+				Labels: []string{"RetryableWriteError"},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ReplyError(tc.res)
+			if tc.expected == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+
+			switch e := err.(type) {
+			case *CommandError:
+				assert.Same(t, tc.res, e.Reply)
+				e.Reply = nil
+			case *WriteException:
+				assert.Same(t, tc.res, e.Reply)
+				e.Reply = nil
+			}
+
+			assert.Equal(t, tc.expected, err)
+		})
+	}
+}
+
+func TestErrorLabels(t *testing.T) {
+	t.Parallel()
+
+	err := ReplyError(wirebson.MustDocument(
+		"ok", float64(0),
+		"errorLabels", wirebson.MustArray("TransientTransactionError"),
+	))
+
+	var ce *CommandError
+	require.ErrorAs(t, err, &ce)
+	assert.True(t, ce.HasErrorLabel("TransientTransactionError"))
+	assert.False(t, ce.HasErrorLabel("RetryableWriteError"))
+
+	err = ReplyError(wirebson.MustDocument(
+		"writeErrors", wirebson.MustArray(wirebson.MustDocument(
+			"index", int32(0),
+			"code", int32(11000),
+			"codeName", "DuplicateKey",
+			"errmsg", "E11000 duplicate key error",
+		)),
+		"errorLabels", wirebson.MustArray("RetryableWriteError"),
+		"ok", float64(1),
+	))
+
+	var we *WriteException
+	require.ErrorAs(t, err, &we)
+	assert.True(t, we.HasErrorLabel("RetryableWriteError"))
+	assert.False(t, we.HasErrorLabel("TransientTransactionError"))
+	assert.Equal(t, "write exception: write error at index 0: DuplicateKey (11000): E11000 duplicate key error", we.Error())
+}
+
+func TestConnRequestCommand(t *testing.T) {
+	t.Parallel()
+
+	mux := wireserver.NewMux()
+
+	mux.RegisterFunc("ping", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serve(t, l, mux)
+
+	conn, err := Connect(t.Context(), "mongodb://"+l.Addr().String()+"/", logger(t))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+	})
+
+	res, err := conn.RequestCommand(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	require.NoError(t, err)
+	assert.Equal(t, wirebson.MustDocument("ok", float64(1)), res)
+
+	res, err = conn.RequestCommand(t.Context(), wire.MustOpMsg("unknown", int32(1), "$db", "admin"))
+	assert.Nil(t, res)
+
+	var ce *CommandError
+	require.True(t, errors.As(err, &ce), "%T", err)
+	assert.Equal(t, wireserver.CodeCommandNotFound, ce.Code)
+	assert.Equal(t, "CommandNotFound", ce.Name)
+	assert.Equal(t, "no such command: 'unknown'", ce.Message)
+}
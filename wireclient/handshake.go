@@ -0,0 +1,267 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// DriverName is sent in the client metadata during the handshake.
+const DriverName = "FerretDB/wire"
+
+// Default values of [ServerDescription] fields for servers that do not return them.
+const (
+	DefaultMaxBsonObjectSize   = 16 * 1024 * 1024
+	DefaultMaxMessageSizeBytes = 48_000_000
+	DefaultMaxWriteBatchSize   = 100_000
+)
+
+// HandshakeOpts represents [Conn.Handshake] options.
+type HandshakeOpts struct {
+	// AppName is sent in the client metadata, if set.
+	AppName string
+
+	// Compressors are advertised to the server in the order of preference.
+	// If nil, `compressors` query parameter of [Connect] is used.
+	Compressors []string
+
+	// LegacyHello makes the handshake use OP_QUERY `isMaster` command instead of OP_MSG `hello`
+	// for servers that do not support OP_MSG.
+	LegacyHello bool
+}
+
+// ServerDescription represents server parameters returned by the handshake.
+type ServerDescription struct {
+	// Reply is the whole handshake reply document.
+	Reply *wirebson.Document
+
+	// Compression contains compressors advertised by the client that the server also supports,
+	// in the order of preference.
+	Compression []string
+
+	// LogicalSessionTimeout is zero if the server does not support sessions.
+	LogicalSessionTimeout time.Duration
+
+	MinWireVersion      int32
+	MaxWireVersion      int32
+	MaxBsonObjectSize   int32
+	MaxMessageSizeBytes int32
+	MaxWriteBatchSize   int32
+}
+
+// driverVersion returns the version of this module, if known.
+var driverVersion = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	if info.Main.Path == "github.com/FerretDB/wire" {
+		return info.Main.Version
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/FerretDB/wire" {
+			return dep.Version
+		}
+	}
+
+	return "unknown"
+})
+
+// clientMetadata returns the client metadata document sent during the handshake.
+func clientMetadata(appName string) *wirebson.Document {
+	doc := wirebson.MakeDocument(4)
+
+	if appName != "" {
+		must.NoError(doc.Add("application", wirebson.MustDocument("name", appName)))
+	}
+
+	must.NoError(doc.Add("driver", wirebson.MustDocument("name", DriverName, "version", driverVersion())))
+	must.NoError(doc.Add("os", wirebson.MustDocument("type", runtime.GOOS, "architecture", runtime.GOARCH)))
+	must.NoError(doc.Add("platform", runtime.Version()))
+
+	return doc
+}
+
+// Handshake performs the initial handshake with the server
+// by sending `hello` command with the client metadata and supported compressors.
+// The returned server description is also available via [Conn.ServerDescription].
+//
+// If the server supports one of the advertised compressors, it is used for all subsequent requests
+// except authentication-related commands; see [Conn.Compressor] and [Conn.CompressionStats].
+//
+// It should be called once, before any other command, including [Conn.Login].
+func (c *Conn) Handshake(ctx context.Context, opts *HandshakeOpts) (*ServerDescription, error) {
+	if opts == nil {
+		opts = new(HandshakeOpts)
+	}
+
+	command := "hello"
+	if opts.LegacyHello {
+		command = "isMaster"
+	}
+
+	compressors := opts.Compressors
+	if compressors == nil {
+		compressors = c.comp.compressors
+	}
+
+	compression := wirebson.MakeArray(len(compressors))
+	for _, compressor := range compressors {
+		must.NoError(compression.Add(compressor))
+	}
+
+	cmd := wirebson.MustDocument(
+		command, int32(1),
+		"helloOk", true,
+		"client", clientMetadata(opts.AppName),
+		"compression", compression,
+	)
+
+	var res *wirebson.Document
+	var err error
+
+	if opts.LegacyHello {
+		res, err = c.handshakeQuery(ctx, cmd)
+	} else {
+		res, err = c.handshakeMsg(ctx, cmd)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.Handshake: %w", err)
+	}
+
+	desc, err := newServerDescription(res)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.Handshake: %w", err)
+	}
+
+	c.desc = desc
+	c.selectCompressor(compressors, desc.Compression)
+
+	return desc, nil
+}
+
+// ServerDescription returns the server description received by [Conn.Handshake].
+// It returns nil if the handshake was not performed.
+func (c *Conn) ServerDescription() *ServerDescription {
+	return c.desc
+}
+
+// handshakeMsg sends the given command as OP_MSG to `admin` database and returns the reply document.
+func (c *Conn) handshakeMsg(ctx context.Context, cmd *wirebson.Document) (*wirebson.Document, error) {
+	cmd = cmd.Copy()
+	must.NoError(cmd.Add("$db", "admin"))
+
+	body, err := wire.NewOpMsg(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.handshakeMsg: %w", err)
+	}
+
+	res, err := c.RequestCommand(ctx, body)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.handshakeMsg: %w", err)
+	}
+
+	return res, nil
+}
+
+// handshakeQuery sends the given command as OP_QUERY to `admin.$cmd` and returns the reply document.
+func (c *Conn) handshakeQuery(ctx context.Context, cmd *wirebson.Document) (*wirebson.Document, error) {
+	query, err := wire.NewOpQuery(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.handshakeQuery: %w", err)
+	}
+
+	query.FullCollectionName = "admin.$cmd"
+	query.NumberToReturn = -1
+
+	_, resBody, err := c.Request(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.handshakeQuery: %w", err)
+	}
+
+	reply, ok := resBody.(*wire.OpReply)
+	if !ok {
+		return nil, fmt.Errorf("wireclient.Conn.handshakeQuery: unexpected response type %T", resBody)
+	}
+
+	res, err := reply.DocumentDeep()
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.handshakeQuery: %w", err)
+	}
+
+	if err = ReplyError(res); err != nil {
+		return nil, fmt.Errorf("wireclient.Conn.handshakeQuery: %w", err)
+	}
+
+	return res, nil
+}
+
+// newServerDescription creates a new server description from the handshake reply.
+func newServerDescription(res *wirebson.Document) (*ServerDescription, error) {
+	desc := &ServerDescription{
+		Reply:               res,
+		MinWireVersion:      toInt32(res.Get("minWireVersion")),
+		MaxWireVersion:      toInt32(res.Get("maxWireVersion")),
+		MaxBsonObjectSize:   DefaultMaxBsonObjectSize,
+		MaxMessageSizeBytes: DefaultMaxMessageSizeBytes,
+		MaxWriteBatchSize:   DefaultMaxWriteBatchSize,
+	}
+
+	if v := toInt32(res.Get("maxBsonObjectSize")); v > 0 {
+		desc.MaxBsonObjectSize = v
+	}
+
+	if v := toInt32(res.Get("maxMessageSizeBytes")); v > 0 {
+		desc.MaxMessageSizeBytes = v
+	}
+
+	if v := toInt32(res.Get("maxWriteBatchSize")); v > 0 {
+		desc.MaxWriteBatchSize = v
+	}
+
+	if v := toInt32(res.Get("logicalSessionTimeoutMinutes")); v > 0 {
+		desc.LogicalSessionTimeout = time.Duration(v) * time.Minute
+	}
+
+	if v := res.Get("compression"); v != nil {
+		arr, ok := v.(*wirebson.Array)
+		if !ok {
+			return nil, fmt.Errorf("newServerDescription: invalid compression %v", v)
+		}
+
+		for c := range arr.Values() {
+			var s string
+			if s, ok = c.(string); !ok {
+				return nil, fmt.Errorf("newServerDescription: invalid compression value %v", c)
+			}
+
+			desc.Compression = append(desc.Compression, s)
+		}
+	}
+
+	return desc, nil
+}
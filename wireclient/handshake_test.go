@@ -0,0 +1,169 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireserver"
+)
+
+// setupHandshake starts a server that replies to `hello` and `isMaster` with the given document
+// and sends received commands to the returned channel.
+func setupHandshake(t *testing.T, reply *wirebson.Document) (*Conn, <-chan *wirebson.Document) {
+	t.Helper()
+
+	reqs := make(chan *wirebson.Document, 1)
+
+	h := func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		doc, err := req.DocumentDeep()
+		require.NoError(t, err)
+
+		reqs <- doc
+
+		return wire.NewOpMsg(reply)
+	}
+
+	mux := wireserver.NewMux()
+	mux.RegisterFunc("hello", h)
+	mux.RegisterFunc("isMaster", h)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serve(t, l, mux)
+
+	conn, err := Connect(t.Context(), "mongodb://"+l.Addr().String()+"/", logger(t))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+	})
+
+	return conn, reqs
+}
+
+func TestConnHandshake(t *testing.T) {
+	t.Parallel()
+
+	reply := wirebson.MustDocument(
+		"isWritablePrimary", true,
+		"maxBsonObjectSize", int32(1024),
+		"maxMessageSizeBytes", int32(2048),
+		"maxWriteBatchSize", int32(10),
+		"logicalSessionTimeoutMinutes", int32(30),
+		"minWireVersion", int32(0),
+		"maxWireVersion", int32(25),
+		"compression", wirebson.MustArray("zstd"),
+		"ok", float64(1),
+	)
+
+	t.Run("Hello", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupHandshake(t, reply)
+		assert.Nil(t, conn.ServerDescription())
+
+		desc, err := conn.Handshake(t.Context(), &HandshakeOpts{
+			AppName:     "test",
+			Compressors: []string{"zstd", "snappy"},
+		})
+		require.NoError(t, err)
+
+		expected := &ServerDescription{
+			Reply:                 reply,
+			Compression:           []string{"zstd"},
+			LogicalSessionTimeout: 30 * time.Minute,
+			MinWireVersion:        0,
+			MaxWireVersion:        25,
+			MaxBsonObjectSize:     1024,
+			MaxMessageSizeBytes:   2048,
+			MaxWriteBatchSize:     10,
+		}
+		assert.Equal(t, expected, desc)
+		assert.Same(t, desc, conn.ServerDescription())
+
+		req := <-reqs
+		assert.Equal(t, "hello", req.Command())
+		assert.Equal(t, true, req.Get("helloOk"))
+		assert.Equal(t, wirebson.MustArray("zstd", "snappy"), req.Get("compression"))
+		assert.Equal(t, "admin", req.Get("$db"))
+
+		client := req.Get("client").(*wirebson.Document)
+		assert.Equal(t, wirebson.MustDocument("name", "test"), client.Get("application"))
+		assert.Equal(t, DriverName, client.Get("driver").(*wirebson.Document).Get("name"))
+		assert.NotEmpty(t, client.Get("driver").(*wirebson.Document).Get("version"))
+		assert.Equal(t, runtime.GOOS, client.Get("os").(*wirebson.Document).Get("type"))
+		assert.Equal(t, runtime.Version(), client.Get("platform"))
+	})
+
+	t.Run("LegacyHello", func(t *testing.T) {
+		t.Parallel()
+
+		conn, reqs := setupHandshake(t, reply)
+
+		desc, err := conn.Handshake(t.Context(), &HandshakeOpts{LegacyHello: true})
+		require.NoError(t, err)
+		assert.Equal(t, int32(25), desc.MaxWireVersion)
+
+		req := <-reqs
+		assert.Equal(t, "isMaster", req.Command())
+		assert.Equal(t, wirebson.MakeArray(0), req.Get("compression"))
+		assert.Equal(t, "admin", req.Get("$db"))
+		assert.Nil(t, req.Get("client").(*wirebson.Document).Get("application"))
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		t.Parallel()
+
+		conn, _ := setupHandshake(t, wirebson.MustDocument("ismaster", true, "ok", float64(1)))
+
+		desc, err := conn.Handshake(t.Context(), nil)
+		require.NoError(t, err)
+
+		assert.Nil(t, desc.Compression)
+		assert.Zero(t, desc.LogicalSessionTimeout)
+		assert.Equal(t, int32(DefaultMaxBsonObjectSize), desc.MaxBsonObjectSize)
+		assert.Equal(t, int32(DefaultMaxMessageSizeBytes), desc.MaxMessageSizeBytes)
+		assert.Equal(t, int32(DefaultMaxWriteBatchSize), desc.MaxWriteBatchSize)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+
+		conn, _ := setupHandshake(t, wirebson.MustDocument(
+			"ok", float64(0),
+			"errmsg", "The client metadata document may only be sent in the first hello",
+			"code", int32(186),
+			"codeName", "ClientMetadataCannotBeMutated",
+		))
+
+		_, err := conn.Handshake(t.Context(), nil)
+
+		var ce *CommandError
+		require.ErrorAs(t, err, &ce)
+		assert.Equal(t, int32(186), ce.Code)
+		assert.Nil(t, conn.ServerDescription())
+	})
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/FerretDB/wire"
+)
+
+// muxResponse represents a response dispatched to the waiting [MuxConn.Request] call.
+type muxResponse struct {
+	header *wire.MsgHeader
+	body   wire.MsgBody
+}
+
+// MuxConn represents a single client connection in multiplexed mode.
+//
+// Unlike [Conn], it is safe for concurrent use:
+// many goroutines could send requests over the same connection without waiting for each other's responses.
+// A background goroutine reads responses and dispatches them to callers by ResponseTo header field.
+type MuxConn struct {
+	conn *Conn
+
+	pending map[int32]chan muxResponse // protected by m
+	done    chan struct{}              // closed when the background goroutine exits
+	err     error                      // background goroutine's error, set before done is closed
+
+	m  sync.Mutex
+	wm sync.Mutex // serializes writes
+}
+
+// NewMuxConn switches the given connection to multiplexed mode.
+//
+// The connection should be already connected and authenticated (if needed);
+// it must not be used directly after this call.
+func NewMuxConn(conn *Conn) *MuxConn {
+	mc := &MuxConn{
+		conn:    conn,
+		pending: map[int32]chan muxResponse{},
+		done:    make(chan struct{}),
+	}
+
+	go mc.run()
+
+	return mc
+}
+
+// Close closes the connection.
+//
+// Pending [MuxConn.Request] calls return errors.
+func (mc *MuxConn) Close() error {
+	err := mc.conn.Close()
+
+	<-mc.done
+
+	if err != nil {
+		return fmt.Errorf("wireclient.MuxConn.Close: %w", err)
+	}
+
+	return nil
+}
+
+// Request sends the given request to the connection and waits for the response.
+// The header is generated automatically.
+//
+// If the request is OP_MSG with moreToCome flag set, Request returns nil header and body
+// right after the request is written, without waiting for anything.
+//
+// Passed context's deadline is honored for writing.
+// Context cancellation stops waiting for the response; if it arrives later, it is ignored.
+//
+// It returns errors only for request/response parsing or connection issues.
+// All protocol-level errors are stored inside response.
+func (mc *MuxConn) Request(ctx context.Context, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+	header, body, err := mc.conn.prepare(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wireclient.MuxConn.Request: %w", err)
+	}
+
+	var ch chan muxResponse
+
+	if msg, ok := body.(*wire.OpMsg); !ok || !msg.Flags.FlagSet(wire.OpMsgMoreToCome) {
+		ch = make(chan muxResponse, 1)
+
+		mc.m.Lock()
+
+		select {
+		case <-mc.done:
+			mc.m.Unlock()
+			return nil, nil, fmt.Errorf("wireclient.MuxConn.Request: %w", mc.err)
+		default:
+		}
+
+		mc.pending[header.RequestID] = ch
+		mc.m.Unlock()
+	}
+
+	if err = mc.write(ctx, header, body); err != nil {
+		mc.forget(header.RequestID)
+		return nil, nil, fmt.Errorf("wireclient.MuxConn.Request: %w", err)
+	}
+
+	if ch == nil {
+		return nil, nil, nil
+	}
+
+	select {
+	case res := <-ch:
+		return res.header, res.body, nil
+
+	case <-ctx.Done():
+		mc.forget(header.RequestID)
+		return nil, nil, fmt.Errorf("wireclient.MuxConn.Request: %w", context.Cause(ctx))
+
+	case <-mc.done:
+		// the response could be dispatched right before the background goroutine exited
+		select {
+		case res := <-ch:
+			return res.header, res.body, nil
+		default:
+		}
+
+		return nil, nil, fmt.Errorf("wireclient.MuxConn.Request: %w", mc.err)
+	}
+}
+
+// write writes the given message to the connection.
+func (mc *MuxConn) write(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) error {
+	mc.wm.Lock()
+	defer mc.wm.Unlock()
+
+	// reset the deadline set by the previous call, if any
+	var d time.Time
+	if dl, ok := ctx.Deadline(); ok {
+		d = dl
+	}
+
+	if err := mc.conn.c.SetWriteDeadline(d); err != nil {
+		return fmt.Errorf("wireclient.MuxConn.write: %w", err)
+	}
+
+	return mc.conn.Write(ctx, header, body)
+}
+
+// forget removes the pending request.
+func (mc *MuxConn) forget(requestID int32) {
+	mc.m.Lock()
+	defer mc.m.Unlock()
+
+	delete(mc.pending, requestID)
+}
+
+// run reads responses and dispatches them to waiting callers until the connection is closed or fails.
+func (mc *MuxConn) run() {
+	ctx := context.Background()
+
+	for {
+		header, body, err := mc.conn.Read(ctx)
+		if err != nil {
+			mc.err = err
+			close(mc.done)
+
+			return
+		}
+
+		mc.m.Lock()
+		ch := mc.pending[header.ResponseTo]
+		delete(mc.pending, header.ResponseTo)
+		mc.m.Unlock()
+
+		if ch == nil {
+			mc.conn.l.DebugContext(
+				ctx, "wireclient.MuxConn.run: ignoring unexpected response",
+				slog.Int("id", int(header.RequestID)), slog.Int("response_to", int(header.ResponseTo)),
+			)
+
+			continue
+		}
+
+		ch <- muxResponse{header: header, body: body}
+	}
+}
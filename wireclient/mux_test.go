@@ -0,0 +1,217 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+)
+
+// setupMux returns multiplexed connection and the server side of the pipe.
+func setupMux(t *testing.T) (*MuxConn, *bufio.Reader, *bufio.Writer) {
+	t.Helper()
+
+	client, server := net.Pipe()
+
+	mc := NewMuxConn(New(client, logger(t)))
+
+	t.Cleanup(func() {
+		_ = mc.Close()
+		_ = server.Close()
+	})
+
+	return mc, bufio.NewReader(server), bufio.NewWriter(server)
+}
+
+// reply writes the response to the given request that echoes the request's command.
+func reply(tb testing.TB, w *bufio.Writer, header *wire.MsgHeader, body wire.MsgBody) {
+	tb.Helper()
+
+	doc, err := body.(*wire.OpMsg).Document()
+	require.NoError(tb, err)
+
+	res := wire.MustOpMsg("echo", doc.Command(), "ok", float64(1))
+	resHeader := &wire.MsgHeader{
+		MessageLength: int32(res.Size() + wire.MsgHeaderLen),
+		RequestID:     header.RequestID + 1000,
+		ResponseTo:    header.RequestID,
+		OpCode:        wire.OpCodeMsg,
+	}
+
+	require.NoError(tb, wire.WriteMessage(w, resHeader, res))
+	require.NoError(tb, w.Flush())
+}
+
+func TestMuxConn(t *testing.T) {
+	t.Parallel()
+
+	t.Run("OutOfOrder", func(t *testing.T) {
+		t.Parallel()
+
+		mc, r, w := setupMux(t)
+
+		cmds := []string{"a", "b", "c", "d", "e"}
+
+		go func() {
+			type request struct {
+				header *wire.MsgHeader
+				body   wire.MsgBody
+			}
+
+			var reqs []request
+
+			for range cmds {
+				header, body, err := wire.ReadMessage(r)
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				reqs = append(reqs, request{header: header, body: body})
+			}
+
+			// reply in reverse order after reading all requests
+			for _, req := range slices.Backward(reqs) {
+				reply(t, w, req.header, req.body)
+			}
+		}()
+
+		var wg sync.WaitGroup
+
+		for _, cmd := range cmds {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, body, err := mc.Request(t.Context(), wire.MustOpMsg(cmd, int32(1), "$db", "admin"))
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				doc, err := body.(*wire.OpMsg).Document()
+				require.NoError(t, err)
+				assert.Equal(t, cmd, doc.Get("echo"))
+			}()
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("MoreToCome", func(t *testing.T) {
+		t.Parallel()
+
+		mc, r, w := setupMux(t)
+
+		go func() {
+			_, body, err := wire.ReadMessage(r)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.True(t, body.(*wire.OpMsg).Flags.FlagSet(wire.OpMsgMoreToCome))
+
+			header, body, err := wire.ReadMessage(r)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			reply(t, w, header, body)
+		}()
+
+		msg := wire.MustOpMsg("insert", "test", "$db", "test")
+		msg.Flags |= wire.OpMsgFlags(wire.OpMsgMoreToCome)
+
+		header, body, err := mc.Request(t.Context(), msg)
+		require.NoError(t, err)
+		assert.Nil(t, header)
+		assert.Nil(t, body)
+
+		_, body, err = mc.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+		require.NoError(t, err)
+
+		doc, err := body.(*wire.OpMsg).Document()
+		require.NoError(t, err)
+		assert.Equal(t, "ping", doc.Get("echo"))
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		t.Parallel()
+
+		mc, r, w := setupMux(t)
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			slow, slowBody, err := wire.ReadMessage(r)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			header, body, err := wire.ReadMessage(r)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// late response is ignored
+			reply(t, w, slow, slowBody)
+			reply(t, w, header, body)
+		}()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+
+		_, _, err := mc.Request(ctx, wire.MustOpMsg("slow", int32(1), "$db", "admin"))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		_, body, err := mc.Request(t.Context(), wire.MustOpMsg("fast", int32(1), "$db", "admin"))
+		require.NoError(t, err)
+
+		doc, err := body.(*wire.OpMsg).Document()
+		require.NoError(t, err)
+		assert.Equal(t, "fast", doc.Get("echo"))
+
+		<-done
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		t.Parallel()
+
+		mc, r, _ := setupMux(t)
+
+		go func() {
+			_, _, err := wire.ReadMessage(r)
+			assert.NoError(t, err)
+			assert.NoError(t, mc.Close())
+		}()
+
+		_, _, err := mc.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+		require.Error(t, err)
+
+		_, _, err = mc.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+		require.Error(t, err)
+	})
+}
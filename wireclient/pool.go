@@ -0,0 +1,385 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultPoolMaxSize is the default maximum number of connections in the [Pool].
+const DefaultPoolMaxSize = 100
+
+// ErrPoolClosed is returned by [Pool.Acquire] after the pool is closed.
+var ErrPoolClosed = errors.New("wireclient: pool is closed")
+
+// PoolOpts represents [Pool] options.
+type PoolOpts struct {
+	// Logger is used for debug-level messages of the pool and all connections; if nil, nothing is logged.
+	Logger *slog.Logger
+
+	// URI is MongoDB URI, possibly with credentials; see [Credentials].
+	// If credentials or authMechanism are present, each new connection is authenticated with [Conn.Login].
+	URI string
+
+	// MinSize is the number of connections that the pool tries to keep open, idle or not.
+	MinSize int
+
+	// MaxSize is the maximum number of open connections.
+	// If zero, [DefaultPoolMaxSize] is used.
+	MaxSize int
+
+	// IdleTimeout is the duration after which idle connections above MinSize are closed.
+	// If zero, idle connections are not closed.
+	IdleTimeout time.Duration
+
+	// HealthCheckInterval is the duration after which idle connections are checked with [Conn.Ping]
+	// before being returned by [Pool.Acquire]; connections that fail the check are replaced.
+	// If zero, health checks are disabled.
+	HealthCheckInterval time.Duration
+}
+
+// idleConn represents an idle connection in the [Pool].
+type idleConn struct {
+	since time.Time
+	conn  *Conn
+}
+
+// Pool is a pool of authenticated connections.
+//
+// Unlike [Conn], it is safe for concurrent use.
+// Connections returned by [Pool.Acquire] are still not; they should be used by a single goroutine
+// and then returned by [Pool.Release] or [Pool.Discard].
+type Pool struct {
+	// tokens limits the number of connections that are in use or being dialed
+	tokens chan struct{}
+
+	l           *slog.Logger
+	credentials *url.Userinfo
+	opts        *PoolOpts
+	done        chan struct{}
+
+	uri           string
+	authSource    string
+	authMechanism string
+
+	idle []idleConn // LIFO, protected by m
+	wg   sync.WaitGroup
+	open int // idle, in use, and being dialed; protected by m
+	m    sync.Mutex
+
+	closed bool // protected by m
+}
+
+// NewPool creates a new pool and opens MinSize connections.
+//
+// Context is used only for opening initial connections.
+// If any of them fails, the error is returned.
+func NewPool(ctx context.Context, opts *PoolOpts) (*Pool, error) {
+	o := *opts
+
+	if o.MaxSize == 0 {
+		o.MaxSize = DefaultPoolMaxSize
+	}
+
+	if o.MinSize < 0 || o.MaxSize < 0 || o.MinSize > o.MaxSize {
+		return nil, fmt.Errorf("wireclient.NewPool: invalid sizes min=%d max=%d", o.MinSize, o.MaxSize)
+	}
+
+	l := o.Logger
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+
+	uri, credentials, authSource, authMechanism, err := Credentials(o.URI)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.NewPool: %w", err)
+	}
+
+	if credentials != nil && authSource == "" {
+		authSource = "admin"
+	}
+
+	p := &Pool{
+		opts:          &o,
+		l:             l,
+		uri:           uri,
+		credentials:   credentials,
+		authSource:    authSource,
+		authMechanism: authMechanism,
+		tokens:        make(chan struct{}, o.MaxSize),
+		done:          make(chan struct{}),
+	}
+
+	if err = p.fill(ctx); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("wireclient.NewPool: %w", err)
+	}
+
+	p.wg.Add(1)
+
+	go func() {
+		defer p.wg.Done()
+
+		p.maintain()
+	}()
+
+	return p, nil
+}
+
+// Acquire returns an idle connection or opens a new one.
+// If MaxSize connections are already in use, it waits until one is released or ctx is canceled.
+//
+// The connection should be returned with [Pool.Release] or [Pool.Discard].
+func (p *Pool) Acquire(ctx context.Context) (*Conn, error) {
+	p.m.Lock()
+	closed := p.closed
+	p.m.Unlock()
+
+	if closed {
+		return nil, fmt.Errorf("wireclient.Pool.Acquire: %w", ErrPoolClosed)
+	}
+
+	select {
+	case p.tokens <- struct{}{}:
+	case <-p.done:
+		return nil, fmt.Errorf("wireclient.Pool.Acquire: %w", ErrPoolClosed)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wireclient.Pool.Acquire: %w", context.Cause(ctx))
+	}
+
+	for {
+		ic, ok := p.popIdle()
+		if !ok {
+			break
+		}
+
+		if p.opts.HealthCheckInterval == 0 || time.Since(ic.since) < p.opts.HealthCheckInterval {
+			return ic.conn, nil
+		}
+
+		err := ic.conn.Ping(ctx)
+		if err == nil {
+			return ic.conn, nil
+		}
+
+		p.l.DebugContext(ctx, "Health check failed", slog.String("error", err.Error()))
+		p.closeConn(ic.conn)
+
+		if ctx.Err() != nil {
+			<-p.tokens
+			return nil, fmt.Errorf("wireclient.Pool.Acquire: %w", err)
+		}
+	}
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		<-p.tokens
+		return nil, fmt.Errorf("wireclient.Pool.Acquire: %w", err)
+	}
+
+	return conn, nil
+}
+
+// Release returns the connection acquired by [Pool.Acquire] to the pool.
+//
+// Connections with unread responses or in an unknown state should be passed to [Pool.Discard] instead.
+func (p *Pool) Release(conn *Conn) {
+	p.m.Lock()
+
+	if p.closed {
+		p.m.Unlock()
+		p.closeConn(conn)
+	} else {
+		p.idle = append(p.idle, idleConn{since: time.Now(), conn: conn})
+		p.m.Unlock()
+	}
+
+	<-p.tokens
+}
+
+// Discard closes the connection acquired by [Pool.Acquire]
+// and lets the pool open a new one when needed.
+func (p *Pool) Discard(conn *Conn) {
+	p.closeConn(conn)
+
+	<-p.tokens
+}
+
+// Close closes all idle connections and stops the background maintenance.
+// Connections that are in use are closed when they are released.
+//
+// Close must not be called more than once.
+func (p *Pool) Close() {
+	p.m.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.m.Unlock()
+
+	close(p.done)
+
+	for _, ic := range idle {
+		p.closeConn(ic.conn)
+	}
+
+	p.wg.Wait()
+}
+
+// popIdle removes the most recently used idle connection from the pool.
+func (p *Pool) popIdle() (idleConn, bool) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	n := len(p.idle)
+	if n == 0 {
+		return idleConn{}, false
+	}
+
+	ic := p.idle[n-1]
+	p.idle[n-1] = idleConn{}
+	p.idle = p.idle[:n-1]
+
+	return ic, true
+}
+
+// dial opens a new connection and authenticates it, if needed.
+//
+// The caller should hold a token.
+func (p *Pool) dial(ctx context.Context) (*Conn, error) {
+	p.m.Lock()
+	p.open++
+	p.m.Unlock()
+
+	conn, err := Connect(ctx, p.uri, p.l)
+	if err == nil && (p.credentials != nil || p.authMechanism != "") {
+		if err = conn.Login(ctx, p.credentials, p.authSource, p.authMechanism); err != nil {
+			_ = conn.Close()
+		}
+	}
+
+	if err != nil {
+		p.m.Lock()
+		p.open--
+		p.m.Unlock()
+
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// closeConn closes the connection that was opened by the pool.
+func (p *Pool) closeConn(conn *Conn) {
+	_ = conn.Close()
+
+	p.m.Lock()
+	p.open--
+	p.m.Unlock()
+}
+
+// fill opens idle connections until there are at least MinSize open connections.
+func (p *Pool) fill(ctx context.Context) error {
+	for {
+		p.m.Lock()
+		enough := p.closed || p.open >= p.opts.MinSize
+		p.m.Unlock()
+
+		if enough {
+			return nil
+		}
+
+		select {
+		case p.tokens <- struct{}{}:
+		default:
+			// all tokens are used, so there are at least MaxSize connections
+			return nil
+		}
+
+		conn, err := p.dial(ctx)
+		if err != nil {
+			<-p.tokens
+			return err
+		}
+
+		p.Release(conn)
+	}
+}
+
+// reap closes connections that were idle for longer than IdleTimeout, keeping at least MinSize open connections.
+func (p *Pool) reap() {
+	var expired []*Conn
+
+	p.m.Lock()
+
+	// the oldest idle connections are at the beginning
+	for len(p.idle) > 0 && p.open-len(expired) > p.opts.MinSize {
+		if time.Since(p.idle[0].since) < p.opts.IdleTimeout {
+			break
+		}
+
+		expired = append(expired, p.idle[0].conn)
+		p.idle[0] = idleConn{}
+		p.idle = p.idle[1:]
+	}
+
+	p.m.Unlock()
+
+	for _, conn := range expired {
+		p.closeConn(conn)
+	}
+}
+
+// maintain periodically closes expired idle connections and opens new ones to keep MinSize connections
+// until the pool is closed.
+func (p *Pool) maintain() {
+	interval := time.Minute
+	if p.opts.IdleTimeout > 0 {
+		interval = p.opts.IdleTimeout / 2
+	}
+
+	// cancel dialing when the pool is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-p.done
+		cancel()
+	}()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+		}
+
+		if p.opts.IdleTimeout > 0 {
+			p.reap()
+		}
+
+		if err := p.fill(ctx); err != nil {
+			p.l.DebugContext(ctx, "Failed to open connection", slog.String("error", err.Error()))
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireserver"
+)
+
+// countingListener counts accepted connections.
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int32
+}
+
+// Accept implements [net.Listener].
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+
+	return c, err
+}
+
+// setupPoolServer starts a server that supports PLAIN authentication
+// and returns its listener and the number of successful logins.
+func setupPoolServer(t *testing.T) (*countingListener, *atomic.Int32) {
+	t.Helper()
+
+	var logins atomic.Int32
+
+	mux := wireserver.NewMux()
+
+	mux.RegisterFunc("ping", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	mux.RegisterFunc("saslStart", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		doc, err := req.DocumentDeep()
+		require.NoError(t, err)
+
+		if doc.Get("payload").(wirebson.Binary).B == nil {
+			return wire.MustOpMsg("ok", float64(0)), nil
+		}
+
+		logins.Add(1)
+
+		return wire.MustOpMsg("done", true, "ok", float64(1)), nil
+	})
+
+	mux.RegisterFunc("listDatabases", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("databases", wirebson.MakeArray(0), "ok", float64(1)), nil
+	})
+
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	l := &countingListener{Listener: nl}
+	serve(t, l, mux)
+
+	return l, &logins
+}
+
+// serve runs wireserver with the given handler on the listener until the test ends.
+func serve(t *testing.T, l net.Listener, h wireserver.Handler) {
+	t.Helper()
+
+	s := wireserver.New(&wireserver.ServerOpts{Handler: h})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- s.Serve(ctx, l)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+}
+
+// poolOpen returns the number of open connections in the pool.
+func poolOpen(p *Pool) int {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return p.open
+}
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+
+	t.Run("MinSize", func(t *testing.T) {
+		t.Parallel()
+
+		l, _ := setupPoolServer(t)
+
+		p, err := NewPool(t.Context(), &PoolOpts{
+			Logger:  logger(t),
+			URI:     "mongodb://" + l.Addr().String() + "/",
+			MinSize: 2,
+		})
+		require.NoError(t, err)
+
+		t.Cleanup(p.Close)
+
+		assert.Equal(t, 2, poolOpen(p))
+
+		conn, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+		require.NoError(t, conn.Ping(t.Context()))
+		p.Release(conn)
+
+		assert.Equal(t, int32(2), l.accepted.Load())
+	})
+
+	t.Run("MaxSize", func(t *testing.T) {
+		t.Parallel()
+
+		l, _ := setupPoolServer(t)
+
+		p, err := NewPool(t.Context(), &PoolOpts{
+			Logger:  logger(t),
+			URI:     "mongodb://" + l.Addr().String() + "/",
+			MaxSize: 1,
+		})
+		require.NoError(t, err)
+
+		t.Cleanup(p.Close)
+
+		conn1, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err = p.Acquire(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		acquired := make(chan *Conn)
+
+		go func() {
+			conn, aerr := p.Acquire(t.Context())
+			assert.NoError(t, aerr)
+			acquired <- conn
+		}()
+
+		p.Release(conn1)
+
+		conn2 := <-acquired
+		assert.Same(t, conn1, conn2)
+		p.Release(conn2)
+
+		assert.Equal(t, 1, poolOpen(p))
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		t.Parallel()
+
+		l, logins := setupPoolServer(t)
+
+		p, err := NewPool(t.Context(), &PoolOpts{
+			Logger:  logger(t),
+			URI:     "mongodb://user:pass@" + l.Addr().String() + "/?authMechanism=PLAIN",
+			MinSize: 1,
+		})
+		require.NoError(t, err)
+
+		t.Cleanup(p.Close)
+
+		assert.Equal(t, int32(1), logins.Load())
+
+		conn1, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+
+		conn2, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(2), logins.Load())
+
+		// new connection replacing the discarded one is authenticated too
+		p.Discard(conn1)
+
+		conn3, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(3), logins.Load())
+
+		p.Release(conn2)
+		p.Release(conn3)
+	})
+
+	t.Run("HealthCheck", func(t *testing.T) {
+		t.Parallel()
+
+		l, _ := setupPoolServer(t)
+
+		p, err := NewPool(t.Context(), &PoolOpts{
+			Logger:              logger(t),
+			URI:                 "mongodb://" + l.Addr().String() + "/",
+			HealthCheckInterval: time.Nanosecond,
+		})
+		require.NoError(t, err)
+
+		t.Cleanup(p.Close)
+
+		conn1, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+
+		// break the connection
+		require.NoError(t, conn1.Close())
+		p.Release(conn1)
+
+		conn2, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+		assert.NotSame(t, conn1, conn2)
+		require.NoError(t, conn2.Ping(t.Context()))
+		p.Release(conn2)
+
+		assert.Equal(t, 1, poolOpen(p))
+		assert.Equal(t, int32(2), l.accepted.Load())
+	})
+
+	t.Run("IdleTimeout", func(t *testing.T) {
+		t.Parallel()
+
+		l, _ := setupPoolServer(t)
+
+		p, err := NewPool(t.Context(), &PoolOpts{
+			Logger:      logger(t),
+			URI:         "mongodb://" + l.Addr().String() + "/",
+			MinSize:     1,
+			IdleTimeout: 20 * time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		t.Cleanup(p.Close)
+
+		conn1, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+
+		conn2, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+
+		p.Release(conn1)
+		p.Release(conn2)
+
+		assert.Equal(t, 2, poolOpen(p))
+
+		assert.Eventually(t, func() bool { return poolOpen(p) == 1 }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		t.Parallel()
+
+		l, _ := setupPoolServer(t)
+
+		p, err := NewPool(t.Context(), &PoolOpts{
+			Logger:  logger(t),
+			URI:     "mongodb://" + l.Addr().String() + "/",
+			MinSize: 1,
+		})
+		require.NoError(t, err)
+
+		conn, err := p.Acquire(t.Context())
+		require.NoError(t, err)
+
+		p.Close()
+
+		_, err = p.Acquire(t.Context())
+		require.ErrorIs(t, err, ErrPoolClosed)
+
+		p.Release(conn)
+		assert.Equal(t, 0, poolOpen(p))
+	})
+
+	t.Run("InvalidSizes", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewPool(t.Context(), &PoolOpts{URI: "mongodb://127.0.0.1:27017/", MinSize: 2, MaxSize: 1})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,355 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// txnState represents the state of the session's transaction.
+type txnState int
+
+const (
+	txnNone           txnState = iota // no transaction was started
+	txnStarting                       // StartTransaction was called, but no commands were sent
+	txnInProgress                     // at least one command was sent in the transaction
+	txnCommitted                      // Commit was called
+	txnCommittedEmpty                 // Commit was called, but no commands were sent
+	txnAborted                        // Abort was called
+)
+
+// TransactionOpts represents [Session.StartTransaction] options.
+type TransactionOpts struct {
+	// ReadConcern is added to the first command of the transaction, if set.
+	ReadConcern *wirebson.Document
+
+	// WriteConcern is added to `commitTransaction` and `abortTransaction` commands, if set.
+	WriteConcern *wirebson.Document
+}
+
+// Session represents a logical session with optional multi-document transactions.
+//
+// It adds `lsid` and gossiped `$clusterTime` fields to all commands sent with [Session.RequestCommand],
+// and `txnNumber`, `autocommit`, and `startTransaction` fields to commands sent inside a transaction.
+//
+// It is not safe for concurrent use.
+type Session struct {
+	conn        *Conn
+	lsid        *wirebson.Document
+	clusterTime *wirebson.Document // the greatest seen; nil if none
+	opts        *TransactionOpts   // of the current transaction
+
+	txnNumber     int64
+	operationTime wirebson.Timestamp // the greatest seen; 0 if none
+
+	state txnState
+}
+
+// NewSession creates a new session with a random UUID session ID
+// that uses the given connection for all commands.
+//
+// The server creates the session implicitly on the first command;
+// [Session.EndSession] should be called when the session is no longer needed.
+func NewSession(conn *Conn) *Session {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	must.NoError(err)
+
+	// UUID version 4, variant 1
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return &Session{
+		conn: conn,
+		lsid: wirebson.MustDocument("id", wirebson.Binary{B: id, Subtype: wirebson.BinaryUUID}),
+	}
+}
+
+// LSID returns the session ID document `{id: UUID}` sent as `lsid` field.
+func (s *Session) LSID() *wirebson.Document {
+	return s.lsid
+}
+
+// TxnNumber returns the number of the current or last transaction.
+// It is 0 if no transaction was started.
+func (s *Session) TxnNumber() int64 {
+	return s.txnNumber
+}
+
+// InTransaction returns true if the transaction was started and not yet committed or aborted.
+func (s *Session) InTransaction() bool {
+	return s.state == txnStarting || s.state == txnInProgress
+}
+
+// ClusterTime returns the greatest `$clusterTime` document received from the server,
+// or nil if none was received.
+func (s *Session) ClusterTime() *wirebson.Document {
+	return s.clusterTime
+}
+
+// OperationTime returns the greatest `operationTime` received from the server,
+// or 0 if none was received.
+func (s *Session) OperationTime() wirebson.Timestamp {
+	return s.operationTime
+}
+
+// RequestCommand sends the given command with session fields added
+// and returns the deeply decoded response document; see [Conn.RequestCommand].
+//
+// The passed message is not modified; sections of kind 1 and flags are preserved.
+// It returns an error if the command already contains session fields that would be added.
+// `$clusterTime` and `operationTime` are updated from the response even if the command failed.
+func (s *Session) RequestCommand(ctx context.Context, cmd *wire.OpMsg) (*wirebson.Document, error) {
+	doc, err := cmd.Section0()
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Session.RequestCommand: %w", err)
+	}
+
+	fields := []string{"lsid"}
+	if s.InTransaction() {
+		fields = append(fields, "txnNumber", "startTransaction", "autocommit")
+	}
+
+	for _, f := range fields {
+		if doc.Get(f) != nil {
+			return nil, fmt.Errorf("wireclient.Session.RequestCommand: command already contains %q field", f)
+		}
+	}
+
+	doc = doc.Copy()
+	must.NoError(doc.Add("lsid", s.lsid))
+
+	if s.InTransaction() {
+		must.NoError(doc.Add("txnNumber", s.txnNumber))
+
+		if s.state == txnStarting {
+			must.NoError(doc.Add("startTransaction", true))
+
+			if s.opts.ReadConcern != nil && doc.Get("readConcern") == nil {
+				must.NoError(doc.Add("readConcern", s.opts.ReadConcern))
+			}
+
+			s.state = txnInProgress
+		}
+
+		must.NoError(doc.Add("autocommit", false))
+	}
+
+	res, err := s.request(ctx, doc, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Session.RequestCommand: %w", err)
+	}
+
+	return res, nil
+}
+
+// StartTransaction starts a new transaction.
+// No commands are sent until the first [Session.RequestCommand] call.
+func (s *Session) StartTransaction(opts *TransactionOpts) error {
+	if s.InTransaction() {
+		return errors.New("wireclient.Session.StartTransaction: transaction already in progress")
+	}
+
+	if opts == nil {
+		opts = new(TransactionOpts)
+	}
+
+	s.txnNumber++
+	s.opts = opts
+	s.state = txnStarting
+
+	return nil
+}
+
+// Commit commits the current transaction by sending `commitTransaction` command.
+//
+// It could be called again after a successful or failed commit to retry it,
+// for example, if the error has `UnknownTransactionCommitResult` label.
+// If no commands were sent in the transaction, no command is sent to the server, including on retries.
+func (s *Session) Commit(ctx context.Context) error {
+	switch s.state {
+	case txnNone:
+		return errors.New("wireclient.Session.Commit: no transaction started")
+	case txnAborted:
+		return errors.New("wireclient.Session.Commit: transaction was aborted")
+	case txnStarting, txnCommittedEmpty:
+		// the server never saw the transaction, so retries are no-ops too
+		s.state = txnCommittedEmpty
+		return nil
+	case txnInProgress, txnCommitted:
+	}
+
+	s.state = txnCommitted
+
+	if err := s.endTransaction(ctx, "commitTransaction"); err != nil {
+		return fmt.Errorf("wireclient.Session.Commit: %w", err)
+	}
+
+	return nil
+}
+
+// Abort aborts the current transaction by sending `abortTransaction` command.
+//
+// If no commands were sent in the transaction, no command is sent to the server.
+// The transaction is considered aborted even if an error is returned.
+func (s *Session) Abort(ctx context.Context) error {
+	switch s.state {
+	case txnNone:
+		return errors.New("wireclient.Session.Abort: no transaction started")
+	case txnCommitted, txnCommittedEmpty:
+		return errors.New("wireclient.Session.Abort: transaction was committed")
+	case txnAborted:
+		return errors.New("wireclient.Session.Abort: transaction was already aborted")
+	case txnStarting:
+		s.state = txnAborted
+		return nil
+	case txnInProgress:
+	}
+
+	s.state = txnAborted
+
+	if err := s.endTransaction(ctx, "abortTransaction"); err != nil {
+		return fmt.Errorf("wireclient.Session.Abort: %w", err)
+	}
+
+	return nil
+}
+
+// EndSession aborts the transaction in progress, if any,
+// and sends `endSessions` command for this session.
+func (s *Session) EndSession(ctx context.Context) error {
+	if s.state == txnStarting || s.state == txnInProgress {
+		// the server aborts the transaction of the ended session anyway
+		_ = s.Abort(ctx)
+	}
+
+	cmd := wirebson.MustDocument(
+		"endSessions", wirebson.MustArray(s.lsid),
+		"$db", "admin",
+	)
+
+	body, err := wire.NewOpMsg(cmd)
+	if err != nil {
+		return fmt.Errorf("wireclient.Session.EndSession: %w", err)
+	}
+
+	if _, err = s.conn.RequestCommand(ctx, body); err != nil {
+		return fmt.Errorf("wireclient.Session.EndSession: %w", err)
+	}
+
+	return nil
+}
+
+// endTransaction sends `commitTransaction` or `abortTransaction` command for the current transaction.
+func (s *Session) endTransaction(ctx context.Context, command string) error {
+	cmd := wirebson.MustDocument(
+		command, int32(1),
+		"lsid", s.lsid,
+		"txnNumber", s.txnNumber,
+		"autocommit", false,
+	)
+
+	if s.opts.WriteConcern != nil {
+		must.NoError(cmd.Add("writeConcern", s.opts.WriteConcern))
+	}
+
+	must.NoError(cmd.Add("$db", "admin"))
+
+	if _, err := s.request(ctx, cmd, nil); err != nil {
+		return fmt.Errorf("wireclient.Session.endTransaction: %w", err)
+	}
+
+	return nil
+}
+
+// request adds `$clusterTime` to the given command document, sends it with sections of kind 1
+// and flags of the original message (that may be nil), and advances the session's times from the response.
+func (s *Session) request(ctx context.Context, doc *wirebson.Document, orig *wire.OpMsg) (*wirebson.Document, error) {
+	if s.clusterTime != nil && doc.Get("$clusterTime") == nil {
+		must.NoError(doc.Add("$clusterTime", s.clusterTime))
+	}
+
+	body, err := wire.NewOpMsg(doc)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Session.request: %w", err)
+	}
+
+	if orig != nil {
+		body.Flags = orig.Flags
+
+		for identifier, docs := range orig.Sequences() {
+			seq := make([]wirebson.AnyDocument, len(docs))
+			for i, d := range docs {
+				seq[i] = d
+			}
+
+			if err = body.AddSequence(identifier, seq); err != nil {
+				return nil, fmt.Errorf("wireclient.Session.request: %w", err)
+			}
+		}
+	}
+
+	res, err := s.conn.RequestCommand(ctx, body)
+
+	reply := res
+
+	var ce *CommandError
+	var we *WriteException
+
+	switch {
+	case errors.As(err, &ce):
+		reply = ce.Reply
+	case errors.As(err, &we):
+		reply = we.Reply
+	}
+
+	if reply != nil {
+		s.advance(reply)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.Session.request: %w", err)
+	}
+
+	return res, nil
+}
+
+// advance updates `$clusterTime` and `operationTime` from the given response document
+// if they are greater than the current values.
+func (s *Session) advance(res *wirebson.Document) {
+	if ct, ok := res.Get("$clusterTime").(*wirebson.Document); ok {
+		ts, _ := ct.Get("clusterTime").(wirebson.Timestamp)
+
+		var cur wirebson.Timestamp
+		if s.clusterTime != nil {
+			cur, _ = s.clusterTime.Get("clusterTime").(wirebson.Timestamp)
+		}
+
+		if s.clusterTime == nil || ts > cur {
+			s.clusterTime = ct
+		}
+	}
+
+	if ts, ok := res.Get("operationTime").(wirebson.Timestamp); ok && ts > s.operationTime {
+		s.operationTime = ts
+	}
+}
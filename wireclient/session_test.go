@@ -0,0 +1,288 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireserver"
+)
+
+// setupSession starts a server that replies to any command with increasing `$clusterTime` and `operationTime`
+// and sends received messages to the returned channel.
+func setupSession(t *testing.T) (*Session, <-chan *wire.OpMsg) {
+	t.Helper()
+
+	reqs := make(chan *wire.OpMsg, 10)
+
+	var n atomic.Uint32
+
+	h := func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		reqs <- req
+
+		ts := wirebson.NewTimestamp(n.Add(1), 1)
+
+		return wire.NewOpMsg(wirebson.MustDocument(
+			"ok", float64(1),
+			"$clusterTime", wirebson.MustDocument("clusterTime", ts, "signature", wirebson.MustDocument("keyId", int64(0))),
+			"operationTime", ts,
+		))
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serve(t, l, wireserver.HandlerFunc(h))
+
+	conn, err := Connect(t.Context(), "mongodb://"+l.Addr().String()+"/", logger(t))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+	})
+
+	return NewSession(conn), reqs
+}
+
+// recv returns the deeply decoded section 0 document of the next received message.
+func recv(t *testing.T, reqs <-chan *wire.OpMsg) *wirebson.Document {
+	t.Helper()
+
+	doc, err := (<-reqs).Section0Raw().DecodeDeep()
+	require.NoError(t, err)
+
+	return doc
+}
+
+func TestSession(t *testing.T) {
+	t.Parallel()
+
+	t.Run("LSID", func(t *testing.T) {
+		t.Parallel()
+
+		s1 := NewSession(nil)
+		s2 := NewSession(nil)
+
+		id, ok := s1.LSID().Get("id").(wirebson.Binary)
+		require.True(t, ok)
+		assert.Equal(t, wirebson.BinaryUUID, id.Subtype)
+		require.Len(t, id.B, 16)
+		assert.Equal(t, byte(0x40), id.B[6]&0xf0)
+		assert.Equal(t, byte(0x80), id.B[8]&0xc0)
+
+		assert.NotEqual(t, s1.LSID(), s2.LSID())
+	})
+
+	t.Run("Command", func(t *testing.T) {
+		t.Parallel()
+
+		s, reqs := setupSession(t)
+
+		cmd := wire.MustOpMsg("insert", "test", "$db", "test")
+		require.NoError(t, cmd.AddSequence("documents", []wirebson.AnyDocument{
+			wirebson.MustDocument("_id", int32(1)),
+			wirebson.MustDocument("_id", int32(2)),
+		}))
+
+		_, err := s.RequestCommand(t.Context(), cmd)
+		require.NoError(t, err)
+
+		msg := <-reqs
+		assert.Len(t, msg.Sequence("documents"), 2)
+
+		req, err := msg.Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+		assert.Equal(t, "insert", req.Command())
+		assert.Equal(t, s.LSID(), req.Get("lsid"))
+		assert.Nil(t, req.Get("txnNumber"))
+		assert.Nil(t, req.Get("autocommit"))
+		assert.Nil(t, req.Get("$clusterTime"))
+
+		doc, err := cmd.Section0Raw().DecodeDeep()
+		require.NoError(t, err)
+		assert.Nil(t, doc.Get("lsid"), "original message should not be modified")
+
+		assert.Equal(t, wirebson.NewTimestamp(1, 1), s.OperationTime())
+		require.NotNil(t, s.ClusterTime())
+		assert.Equal(t, wirebson.NewTimestamp(1, 1), s.ClusterTime().Get("clusterTime"))
+
+		_, err = s.RequestCommand(t.Context(), wire.MustOpMsg("find", "test", "$db", "test"))
+		require.NoError(t, err)
+
+		req = recv(t, reqs)
+		assert.Equal(t, s.LSID(), req.Get("lsid"))
+		clusterTime := req.Get("$clusterTime").(*wirebson.Document)
+		assert.Equal(t, wirebson.NewTimestamp(1, 1), clusterTime.Get("clusterTime"))
+
+		assert.Equal(t, wirebson.NewTimestamp(2, 1), s.OperationTime())
+		assert.Equal(t, wirebson.NewTimestamp(2, 1), s.ClusterTime().Get("clusterTime"))
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		t.Parallel()
+
+		s, reqs := setupSession(t)
+		assert.False(t, s.InTransaction())
+
+		readConcern := wirebson.MustDocument("level", "snapshot")
+		writeConcern := wirebson.MustDocument("w", "majority")
+
+		require.NoError(t, s.StartTransaction(&TransactionOpts{ReadConcern: readConcern, WriteConcern: writeConcern}))
+		assert.True(t, s.InTransaction())
+		assert.Equal(t, int64(1), s.TxnNumber())
+
+		_, err := s.RequestCommand(t.Context(), wire.MustOpMsg("insert", "test", "$db", "test"))
+		require.NoError(t, err)
+
+		req := recv(t, reqs)
+		assert.Equal(t, s.LSID(), req.Get("lsid"))
+		assert.Equal(t, int64(1), req.Get("txnNumber"))
+		assert.Equal(t, true, req.Get("startTransaction"))
+		assert.Equal(t, false, req.Get("autocommit"))
+		assert.Equal(t, readConcern, req.Get("readConcern"))
+
+		_, err = s.RequestCommand(t.Context(), wire.MustOpMsg("find", "test", "$db", "test"))
+		require.NoError(t, err)
+
+		req = recv(t, reqs)
+		assert.Equal(t, int64(1), req.Get("txnNumber"))
+		assert.Nil(t, req.Get("startTransaction"))
+		assert.Equal(t, false, req.Get("autocommit"))
+		assert.Nil(t, req.Get("readConcern"))
+
+		require.NoError(t, s.Commit(t.Context()))
+		assert.False(t, s.InTransaction())
+
+		req = recv(t, reqs)
+		assert.Equal(t, "commitTransaction", req.Command())
+		assert.Equal(t, s.LSID(), req.Get("lsid"))
+		assert.Equal(t, int64(1), req.Get("txnNumber"))
+		assert.Equal(t, false, req.Get("autocommit"))
+		assert.Equal(t, writeConcern, req.Get("writeConcern"))
+		assert.Equal(t, "admin", req.Get("$db"))
+		assert.NotNil(t, req.Get("$clusterTime"))
+
+		require.NoError(t, s.Commit(t.Context()), "commit retry")
+		assert.Equal(t, "commitTransaction", recv(t, reqs).Command())
+
+		require.NoError(t, s.StartTransaction(nil))
+		assert.Equal(t, int64(2), s.TxnNumber())
+
+		_, err = s.RequestCommand(t.Context(), wire.MustOpMsg("delete", "test", "$db", "test"))
+		require.NoError(t, err)
+
+		req = recv(t, reqs)
+		assert.Equal(t, int64(2), req.Get("txnNumber"))
+		assert.Equal(t, true, req.Get("startTransaction"))
+		assert.Nil(t, req.Get("readConcern"))
+
+		require.NoError(t, s.Abort(t.Context()))
+		assert.False(t, s.InTransaction())
+
+		req = recv(t, reqs)
+		assert.Equal(t, "abortTransaction", req.Command())
+		assert.Equal(t, int64(2), req.Get("txnNumber"))
+		assert.Nil(t, req.Get("writeConcern"))
+
+		require.ErrorContains(t, s.Commit(t.Context()), "transaction was aborted")
+		require.ErrorContains(t, s.Abort(t.Context()), "transaction was already aborted")
+
+		_, err = s.RequestCommand(t.Context(), wire.MustOpMsg("find", "test", "$db", "test"))
+		require.NoError(t, err)
+
+		req = recv(t, reqs)
+		assert.Nil(t, req.Get("txnNumber"))
+		assert.Nil(t, req.Get("autocommit"))
+	})
+
+	t.Run("EmptyTransaction", func(t *testing.T) {
+		t.Parallel()
+
+		s, reqs := setupSession(t)
+
+		require.ErrorContains(t, s.Commit(t.Context()), "no transaction started")
+		require.ErrorContains(t, s.Abort(t.Context()), "no transaction started")
+
+		require.NoError(t, s.StartTransaction(nil))
+		require.ErrorContains(t, s.StartTransaction(nil), "transaction already in progress")
+		require.NoError(t, s.Commit(t.Context()))
+		require.NoError(t, s.Commit(t.Context()), "retried commit of empty transaction should be no-op")
+		require.ErrorContains(t, s.Abort(t.Context()), "transaction was committed")
+
+		require.NoError(t, s.StartTransaction(nil))
+		require.NoError(t, s.Abort(t.Context()))
+		assert.Equal(t, int64(2), s.TxnNumber())
+
+		assert.Empty(t, reqs)
+	})
+
+	t.Run("DuplicateFields", func(t *testing.T) {
+		t.Parallel()
+
+		s, reqs := setupSession(t)
+
+		_, err := s.RequestCommand(t.Context(), wire.MustOpMsg("find", "test", "lsid", s.LSID(), "$db", "test"))
+		require.ErrorContains(t, err, `command already contains "lsid" field`)
+
+		// txnNumber is allowed outside of transaction, for example, for retryable writes
+		_, err = s.RequestCommand(t.Context(), wire.MustOpMsg("insert", "test", "txnNumber", int64(1), "$db", "test"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), recv(t, reqs).Get("txnNumber"))
+
+		require.NoError(t, s.StartTransaction(nil))
+
+		for _, f := range []string{"txnNumber", "startTransaction", "autocommit"} {
+			_, err = s.RequestCommand(t.Context(), wire.MustOpMsg("find", "test", f, true, "$db", "test"))
+			require.ErrorContains(t, err, `command already contains "`+f+`" field`)
+		}
+
+		// the transaction is still starting
+		_, err = s.RequestCommand(t.Context(), wire.MustOpMsg("find", "test", "$db", "test"))
+		require.NoError(t, err)
+		assert.Equal(t, true, recv(t, reqs).Get("startTransaction"))
+
+		assert.Empty(t, reqs)
+	})
+
+	t.Run("EndSession", func(t *testing.T) {
+		t.Parallel()
+
+		s, reqs := setupSession(t)
+
+		require.NoError(t, s.StartTransaction(nil))
+
+		_, err := s.RequestCommand(t.Context(), wire.MustOpMsg("insert", "test", "$db", "test"))
+		require.NoError(t, err)
+		assert.Equal(t, "insert", recv(t, reqs).Command())
+
+		require.NoError(t, s.EndSession(t.Context()))
+		assert.False(t, s.InTransaction())
+
+		assert.Equal(t, "abortTransaction", recv(t, reqs).Command())
+
+		req := recv(t, reqs)
+		assert.Equal(t, "endSessions", req.Command())
+		assert.Equal(t, wirebson.MustArray(s.LSID()), req.Get("endSessions"))
+		assert.Equal(t, "admin", req.Get("$db"))
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Resolver performs DNS lookups for `mongodb+srv` URIs.
+//
+// [*net.Resolver] implements it.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// txtOptions contains lowercase names of options that are allowed in TXT records.
+var txtOptions = []string{"authsource", "replicaset", "loadbalanced"}
+
+// ResolveURI parses the connection string with [ParseURI].
+// For `mongodb+srv` scheme, it also performs seedlist discovery:
+// [URI.Hosts] are replaced with all SRV record targets,
+// and `authSource`, `replicaSet`, and `loadBalanced` options are taken from the TXT record
+// unless they are present in the connection string itself.
+//
+// If resolver is nil, [net.DefaultResolver] is used.
+func ResolveURI(ctx context.Context, uri string, r Resolver) (*URI, error) {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.ResolveURI: %w", err)
+	}
+
+	if !u.SRV {
+		return u, nil
+	}
+
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	hosts, txt, err := lookupSeedlist(ctx, r, u.Hosts[0])
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.ResolveURI: %w", err)
+	}
+
+	u.Hosts = hosts
+
+	if txt != "" {
+		for pair := range strings.SplitSeq(txt, "&") {
+			k, _, _ := strings.Cut(pair, "=")
+			if !slices.Contains(txtOptions, strings.ToLower(k)) {
+				return nil, fmt.Errorf("wireclient.ResolveURI: option %q is not allowed in TXT record", k)
+			}
+		}
+
+		var t URI
+		if err = t.parseOptions(txt); err != nil {
+			return nil, fmt.Errorf("wireclient.ResolveURI: invalid TXT record: %w", err)
+		}
+
+		// options from the connection string take precedence
+		_, query, _ := strings.Cut(uri, "?")
+
+		if !hasOption(query, "authSource") && t.AuthSource != "" {
+			u.AuthSource = t.AuthSource
+		}
+
+		if !hasOption(query, "replicaSet") {
+			u.ReplicaSet = t.ReplicaSet
+		}
+
+		if !hasOption(query, "loadBalanced") {
+			u.LoadBalanced = t.LoadBalanced
+		}
+	}
+
+	if err = u.validate(); err != nil {
+		return nil, fmt.Errorf("wireclient.ResolveURI: %w", err)
+	}
+
+	return u, nil
+}
+
+// lookupSeedlist performs SRV and TXT lookups for the host name of `mongodb+srv` URI.
+// It returns `host:port` pairs of all SRV targets and the TXT record content, if any.
+//
+// All targets should share the parent domain with the host name.
+func lookupSeedlist(ctx context.Context, r Resolver, host string) ([]string, string, error) {
+	_, srvs, err := r.LookupSRV(ctx, "mongodb", "tcp", host)
+	if err != nil {
+		return nil, "", fmt.Errorf("lookupSeedlist: SRV lookup failed: %w", err)
+	}
+
+	if len(srvs) == 0 {
+		return nil, "", fmt.Errorf("lookupSeedlist: no SRV records found for %q", host)
+	}
+
+	// host names with less than three parts are their own parent domains
+	domain := host
+	if strings.Count(host, ".") >= 2 {
+		_, domain, _ = strings.Cut(host, ".")
+	}
+
+	hosts := make([]string, 0, len(srvs))
+
+	for _, srv := range srvs {
+		target := strings.ToLower(strings.TrimSuffix(srv.Target, "."))
+
+		if !strings.HasSuffix(target, "."+domain) {
+			return nil, "", fmt.Errorf("lookupSeedlist: SRV target %q is not in the %q domain", target, domain)
+		}
+
+		hosts = append(hosts, net.JoinHostPort(target, strconv.Itoa(int(srv.Port))))
+	}
+
+	txts, err := r.LookupTXT(ctx, host)
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return hosts, "", nil
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("lookupSeedlist: TXT lookup failed: %w", err)
+	}
+
+	switch len(txts) {
+	case 0:
+		return hosts, "", nil
+	case 1:
+		return hosts, txts[0], nil
+	default:
+		return nil, "", fmt.Errorf("lookupSeedlist: expected at most one TXT record, got %d", len(txts))
+	}
+}
+
+// hasOption returns true if the raw query contains the given option, case-insensitively.
+func hasOption(query, name string) bool {
+	for pair := range strings.SplitSeq(query, "&") {
+		if k, _, _ := strings.Cut(pair, "="); strings.EqualFold(k, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check interfaces
+var (
+	_ Resolver = (*net.Resolver)(nil)
+)
@@ -0,0 +1,545 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireclient
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FerretDB/wire"
+)
+
+// DefaultPort is used by [ParseURI] for hosts without explicit port.
+const DefaultPort = "27017"
+
+// URI represents a parsed MongoDB connection string.
+//
+// See https://github.com/mongodb/specifications/blob/master/source/connection-string/connection-string-spec.md
+// and https://www.mongodb.com/docs/manual/reference/connection-string-options/.
+type URI struct {
+	// Credentials are user credentials from the userinfo part; nil if absent.
+	Credentials *url.Userinfo
+
+	// AuthMechanismProperties are `authMechanismProperties` key-value pairs.
+	AuthMechanismProperties map[string]string
+
+	// Database is a database name from the URI path; empty if absent.
+	Database string
+
+	// AuthSource is `authSource` option value or, if absent, Database.
+	// It is always `$external` for MONGODB-X509, MONGODB-AWS, and MONGODB-OIDC mechanisms.
+	// If both are empty, it does not default to "admin"; the caller should handle this case if needed.
+	AuthSource string
+
+	AuthMechanism  string // `authMechanism`
+	ReplicaSet     string // `replicaSet`
+	AppName        string // `appName`
+	ReadPreference string // `readPreference`
+
+	TLSCAFile                     string // `tlsCAFile`
+	TLSCertificateKeyFile         string // `tlsCertificateKeyFile`
+	TLSCertificateKeyFilePassword string // `tlsCertificateKeyFilePassword`
+
+	// Hosts are `host:port` pairs or Unix domain socket paths.
+	// For `mongodb+srv` scheme, there is exactly one host name without port
+	// until SRV targets are resolved by [ResolveURI].
+	Hosts []string
+
+	// Compressors are `compressors` names in the order of preference.
+	Compressors []string
+
+	// UnknownOptions are names of options that are not recognized and were ignored.
+	UnknownOptions []string
+
+	ConnectTimeout         time.Duration // `connectTimeoutMS`
+	SocketTimeout          time.Duration // `socketTimeoutMS`
+	ServerSelectionTimeout time.Duration // `serverSelectionTimeoutMS`
+	HeartbeatFrequency     time.Duration // `heartbeatFrequencyMS`
+	MaxIdleTime            time.Duration // `maxIdleTimeMS`
+
+	// ZlibCompressionLevel is `zlibCompressionLevel` option value;
+	// [wire.DefaultCompressionLevel] if absent.
+	ZlibCompressionLevel int
+
+	// SRV is true for `mongodb+srv` scheme.
+	SRV bool
+
+	// TLS is `tls` (or `ssl`) option value; it defaults to true for `mongodb+srv` scheme.
+	TLS bool
+
+	TLSInsecure                 bool // `tlsInsecure`
+	TLSAllowInvalidHostnames    bool // `tlsAllowInvalidHostnames`
+	TLSAllowInvalidCertificates bool // `tlsAllowInvalidCertificates`
+	DirectConnection            bool // `directConnection`
+	LoadBalanced                bool // `loadBalanced`
+}
+
+// authMechanisms contains all known authentication mechanisms, not only supported by [Conn.Login].
+var authMechanisms = []string{
+	"GSSAPI",
+	"MONGODB-AWS",
+	"MONGODB-OIDC",
+	"MONGODB-X509",
+	"PLAIN",
+	"SCRAM-SHA-1",
+	"SCRAM-SHA-256",
+}
+
+// externalAuthMechanisms contains authentication mechanisms that always use `$external` authSource.
+var externalAuthMechanisms = []string{
+	"MONGODB-AWS",
+	"MONGODB-OIDC",
+	"MONGODB-X509",
+}
+
+// readPreferences contains all valid read preference modes.
+var readPreferences = []string{
+	"primary",
+	"primaryPreferred",
+	"secondary",
+	"secondaryPreferred",
+	"nearest",
+}
+
+// ParseURI parses and validates MongoDB connection string
+// with `mongodb` or `mongodb+srv` scheme.
+//
+// Unlike [url.Parse], it handles seed lists with multiple hosts, Unix domain sockets,
+// case-insensitive option names, and other details of the connection string specification.
+// Unknown options are not rejected, but listed in [URI.UnknownOptions].
+//
+// It does not perform SRV and TXT lookups.
+func ParseURI(uri string) (*URI, error) {
+	res, err := parseURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("wireclient.ParseURI: %w", err)
+	}
+
+	if err = res.validate(); err != nil {
+		return nil, fmt.Errorf("wireclient.ParseURI: %w", err)
+	}
+
+	return res, nil
+}
+
+// parseURI parses MongoDB connection string like [ParseURI],
+// but does not check that options do not conflict with each other and with hosts.
+func parseURI(uri string) (*URI, error) {
+	res := &URI{
+		ZlibCompressionLevel: wire.DefaultCompressionLevel,
+	}
+
+	var rest string
+	var found bool
+
+	if rest, found = strings.CutPrefix(uri, "mongodb://"); !found {
+		if rest, found = strings.CutPrefix(uri, "mongodb+srv://"); !found {
+			return nil, fmt.Errorf("parseURI: invalid scheme in %q", uri)
+		}
+
+		res.SRV = true
+		res.TLS = true
+	}
+
+	authority, rest, hasPath := strings.Cut(rest, "/")
+	if !hasPath && strings.Contains(authority, "?") {
+		return nil, fmt.Errorf("parseURI: options must be preceded by %q", "/")
+	}
+
+	path, query, _ := strings.Cut(rest, "?")
+
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		var err error
+		if res.Credentials, err = parseUserinfo(authority[:i]); err != nil {
+			return nil, fmt.Errorf("parseURI: %w", err)
+		}
+
+		authority = authority[i+1:]
+	}
+
+	if err := res.parseHosts(authority); err != nil {
+		return nil, fmt.Errorf("parseURI: %w", err)
+	}
+
+	if path != "" {
+		db, err := url.PathUnescape(path)
+		if err != nil {
+			return nil, fmt.Errorf("parseURI: invalid database name %q: %w", path, err)
+		}
+
+		if strings.ContainsAny(db, `/\ "`) {
+			return nil, fmt.Errorf("parseURI: invalid database name %q", db)
+		}
+
+		res.Database = db
+	}
+
+	if err := res.parseOptions(query); err != nil {
+		return nil, fmt.Errorf("parseURI: %w", err)
+	}
+
+	switch {
+	case res.AuthSource != "":
+		// set explicitly; checked by validate
+	case slices.Contains(externalAuthMechanisms, res.AuthMechanism):
+		res.AuthSource = "$external"
+	default:
+		res.AuthSource = res.Database
+	}
+
+	return res, nil
+}
+
+// parseUserinfo parses and unescapes userinfo part.
+func parseUserinfo(userinfo string) (*url.Userinfo, error) {
+	username, password, hasPassword := strings.Cut(userinfo, ":")
+
+	if strings.ContainsAny(username, "@/") || strings.ContainsAny(password, "@/:") {
+		return nil, fmt.Errorf("parseUserinfo: userinfo must be percent-encoded")
+	}
+
+	username, err := url.PathUnescape(username)
+	if err != nil {
+		return nil, fmt.Errorf("parseUserinfo: invalid username: %w", err)
+	}
+
+	if username == "" {
+		return nil, fmt.Errorf("parseUserinfo: empty username")
+	}
+
+	if !hasPassword {
+		return url.User(username), nil
+	}
+
+	if password, err = url.PathUnescape(password); err != nil {
+		return nil, fmt.Errorf("parseUserinfo: invalid password: %w", err)
+	}
+
+	return url.UserPassword(username, password), nil
+}
+
+// parseHosts parses comma-separated seed list and sets Hosts.
+func (u *URI) parseHosts(authority string) error {
+	if authority == "" {
+		return fmt.Errorf("parseHosts: empty host")
+	}
+
+	if u.SRV && strings.Contains(authority, ",") {
+		return fmt.Errorf("parseHosts: SRV URI must have exactly one host")
+	}
+
+	for h := range strings.SplitSeq(authority, ",") {
+		host, err := parseHost(h, u.SRV)
+		if err != nil {
+			return fmt.Errorf("parseHosts: %w", err)
+		}
+
+		u.Hosts = append(u.Hosts, host)
+	}
+
+	return nil
+}
+
+// parseHost parses a single host.
+// It returns `host:port` pair with the default port added if needed,
+// or an unescaped Unix domain socket path.
+// For SRV, it returns the host name and checks that the port is absent.
+func parseHost(h string, srv bool) (string, error) {
+	if h == "" {
+		return "", fmt.Errorf("parseHost: empty host")
+	}
+
+	unescaped, err := url.PathUnescape(h)
+	if err != nil {
+		return "", fmt.Errorf("parseHost: invalid host %q: %w", h, err)
+	}
+
+	if strings.HasSuffix(unescaped, ".sock") {
+		if srv {
+			return "", fmt.Errorf("parseHost: Unix domain socket %q is not allowed with SRV", unescaped)
+		}
+
+		return unescaped, nil
+	}
+
+	var host, port string
+
+	if rest, ok := strings.CutPrefix(h, "["); ok {
+		var found bool
+		if host, rest, found = strings.Cut(rest, "]"); !found {
+			return "", fmt.Errorf("parseHost: invalid IP literal %q", h)
+		}
+
+		if net.ParseIP(host) == nil {
+			return "", fmt.Errorf("parseHost: invalid IP literal %q", h)
+		}
+
+		if rest != "" {
+			if port, ok = strings.CutPrefix(rest, ":"); !ok {
+				return "", fmt.Errorf("parseHost: invalid host %q", h)
+			}
+		}
+	} else {
+		host, port, _ = strings.Cut(h, ":")
+
+		if strings.Contains(port, ":") {
+			return "", fmt.Errorf("parseHost: IPv6 address %q must be enclosed in brackets", h)
+		}
+
+		if host == "" {
+			return "", fmt.Errorf("parseHost: empty host name in %q", h)
+		}
+
+		host = strings.ToLower(host)
+	}
+
+	if srv {
+		if port != "" {
+			return "", fmt.Errorf("parseHost: port is not allowed with SRV")
+		}
+
+		return host, nil
+	}
+
+	if port == "" {
+		port = DefaultPort
+	}
+
+	if p, perr := strconv.Atoi(port); perr != nil || p < 1 || p > 65535 {
+		return "", fmt.Errorf("parseHost: invalid port %q", port)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// parseOptions parses options part and sets corresponding fields.
+func (u *URI) parseOptions(query string) error {
+	if query == "" {
+		return nil
+	}
+
+	var tls, ssl string
+
+	for pair := range strings.SplitSeq(query, "&") {
+		k, v, found := strings.Cut(pair, "=")
+		if !found || k == "" {
+			return fmt.Errorf("parseOptions: invalid option %q", pair)
+		}
+
+		v, err := url.PathUnescape(v)
+		if err != nil {
+			return fmt.Errorf("parseOptions: invalid value of option %q: %w", k, err)
+		}
+
+		switch strings.ToLower(k) {
+		case "appname":
+			u.AppName = v
+
+		case "authmechanism":
+			if !slices.Contains(authMechanisms, v) {
+				return fmt.Errorf("parseOptions: unknown authMechanism %q", v)
+			}
+
+			u.AuthMechanism = v
+
+		case "authmechanismproperties":
+			u.AuthMechanismProperties = make(map[string]string)
+
+			for p := range strings.SplitSeq(v, ",") {
+				pk, pv, ok := strings.Cut(p, ":")
+				if !ok || pk == "" {
+					return fmt.Errorf("parseOptions: invalid authMechanismProperties %q", v)
+				}
+
+				u.AuthMechanismProperties[pk] = pv
+			}
+
+		case "authsource":
+			if v == "" {
+				return fmt.Errorf("parseOptions: empty authSource")
+			}
+
+			u.AuthSource = v
+
+		case "compressors":
+			u.Compressors = strings.Split(v, ",")
+
+		case "connecttimeoutms":
+			err = parseDuration(v, &u.ConnectTimeout)
+
+		case "directconnection":
+			err = parseBool(v, &u.DirectConnection)
+
+		case "heartbeatfrequencyms":
+			err = parseDuration(v, &u.HeartbeatFrequency)
+
+		case "loadbalanced":
+			err = parseBool(v, &u.LoadBalanced)
+
+		case "maxidletimems":
+			err = parseDuration(v, &u.MaxIdleTime)
+
+		case "readpreference":
+			if !slices.Contains(readPreferences, v) {
+				return fmt.Errorf("parseOptions: invalid readPreference %q", v)
+			}
+
+			u.ReadPreference = v
+
+		case "replicaset":
+			u.ReplicaSet = v
+
+		case "serverselectiontimeoutms":
+			err = parseDuration(v, &u.ServerSelectionTimeout)
+
+		case "sockettimeoutms":
+			err = parseDuration(v, &u.SocketTimeout)
+
+		case "ssl":
+			ssl = v
+			err = parseBool(v, &u.TLS)
+
+		case "tls":
+			tls = v
+			err = parseBool(v, &u.TLS)
+
+		case "tlsallowinvalidcertificates":
+			err = parseBool(v, &u.TLSAllowInvalidCertificates)
+
+		case "tlsallowinvalidhostnames":
+			err = parseBool(v, &u.TLSAllowInvalidHostnames)
+
+		case "tlscafile":
+			u.TLSCAFile = v
+
+		case "tlscertificatekeyfile":
+			u.TLSCertificateKeyFile = v
+
+		case "tlscertificatekeyfilepassword":
+			u.TLSCertificateKeyFilePassword = v
+
+		case "tlsinsecure":
+			err = parseBool(v, &u.TLSInsecure)
+
+		case "zlibcompressionlevel":
+			var level int
+			if level, err = strconv.Atoi(v); err == nil && (level < -1 || level > 9) {
+				err = fmt.Errorf("must be between -1 and 9")
+			}
+
+			u.ZlibCompressionLevel = level
+
+		default:
+			u.UnknownOptions = append(u.UnknownOptions, k)
+		}
+
+		if err != nil {
+			return fmt.Errorf("parseOptions: invalid value %q of option %q: %w", v, k, err)
+		}
+	}
+
+	if tls != "" && ssl != "" && tls != ssl {
+		return fmt.Errorf("parseOptions: tls and ssl options have conflicting values")
+	}
+
+	return nil
+}
+
+// validate checks that options do not conflict with each other and with hosts.
+func (u *URI) validate() error {
+	if u.SRV && u.DirectConnection {
+		return fmt.Errorf("validate: directConnection is not allowed with SRV")
+	}
+
+	if u.DirectConnection && len(u.Hosts) > 1 {
+		return fmt.Errorf("validate: directConnection is not allowed with multiple hosts")
+	}
+
+	if u.LoadBalanced {
+		switch {
+		case len(u.Hosts) > 1:
+			return fmt.Errorf("validate: loadBalanced is not allowed with multiple hosts")
+		case u.ReplicaSet != "":
+			return fmt.Errorf("validate: loadBalanced is not allowed with replicaSet")
+		case u.DirectConnection:
+			return fmt.Errorf("validate: loadBalanced is not allowed with directConnection")
+		}
+	}
+
+	if u.TLSInsecure && (u.TLSAllowInvalidHostnames || u.TLSAllowInvalidCertificates) {
+		return fmt.Errorf("validate: tlsInsecure is not allowed with tlsAllowInvalidHostnames or tlsAllowInvalidCertificates")
+	}
+
+	switch u.AuthMechanism {
+	case "":
+		// nothing
+
+	case "MONGODB-X509":
+		if _, ok := u.Credentials.Password(); ok {
+			return fmt.Errorf("validate: password is not allowed with %s", u.AuthMechanism)
+		}
+
+		if u.AuthSource != "$external" {
+			return fmt.Errorf("validate: authSource must be $external for %s", u.AuthMechanism)
+		}
+
+	case "MONGODB-AWS", "MONGODB-OIDC":
+		if u.AuthSource != "$external" {
+			return fmt.Errorf("validate: authSource must be $external for %s", u.AuthMechanism)
+		}
+
+	default:
+		if u.Credentials == nil || u.Credentials.Username() == "" {
+			return fmt.Errorf("validate: username is required for %s", u.AuthMechanism)
+		}
+	}
+
+	return nil
+}
+
+// parseBool parses strict "true" or "false" value.
+func parseBool(v string, dst *bool) error {
+	switch v {
+	case "true":
+		*dst = true
+	case "false":
+		*dst = false
+	default:
+		return fmt.Errorf("parseBool: expected true or false")
+	}
+
+	return nil
+}
+
+// parseDuration parses non-negative integer number of milliseconds.
+func parseDuration(v string, dst *time.Duration) error {
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parseDuration: %w", err)
+	}
+
+	if ms < 0 {
+		return fmt.Errorf("parseDuration: negative value")
+	}
+
+	*dst = time.Duration(ms) * time.Millisecond
+
+	return nil
+}
@@ -18,81 +18,60 @@ package wireclient
 import (
 	"context"
 	"fmt"
-	"net"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 )
 
 // Credentials extracts user credentials, authSource, and authMechanism suitable for [Conn.Login]
-// from the given MongoDB URI.
-// It also returns a clean URI suitable for [Connect].
+// from the given MongoDB URI parsed like [ParseURI].
+// Unlike ParseURI, it does not reject conflicting options, such as authMechanism without username;
+// they are checked by [Conn.Login].
+// It also returns a clean URI suitable for [Connect]:
+// without userinfo, database, `authSource`, and `authMechanism`, but with all other hosts and options.
 //
 // If both authSource query parameter and URI path are present, the query parameter takes precedence.
 // If both are empty, it does not defaults to "admin".
 // The caller should handle this case if needed.
 func Credentials(uri string) (cleanURI string, credentials *url.Userinfo, authSource, authMechanism string, err error) {
-	u, err := url.Parse(uri)
+	u, err := parseURI(uri)
 	if err != nil {
+		err = fmt.Errorf("wireclient.Credentials: %w", err)
 		return
 	}
 
-	credentials = u.User
-	u.User = nil
+	credentials = u.Credentials
+	authSource = u.AuthSource
+	authMechanism = u.AuthMechanism
 
-	q := u.Query()
+	// ParseURI already validated the URI, so it could be cut without checks
+	scheme, rest, _ := strings.Cut(uri, "://")
+	authority, rest, _ := strings.Cut(rest, "/")
+	_, query, _ := strings.Cut(rest, "?")
 
-	if q.Has("authMechanism") {
-		v := q["authMechanism"]
-		if l := len(v); l != 1 {
-			err = fmt.Errorf("%q: expected 1 authMechanism, got %d", uri, l)
-			return
-		}
-
-		authMechanism = v[0]
-		q.Del("authMechanism")
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		authority = authority[i+1:]
 	}
 
-	if q.Has("authSource") {
-		v := q["authSource"]
-		if l := len(v); l != 1 {
-			err = fmt.Errorf("%q: expected 1 authSource, got %d", uri, l)
-			return
+	var options []string
+
+	for pair := range strings.SplitSeq(query, "&") {
+		k, _, _ := strings.Cut(pair, "=")
+		if pair == "" || strings.EqualFold(k, "authSource") || strings.EqualFold(k, "authMechanism") {
+			continue
 		}
 
-		authSource = v[0]
-		q.Del("authSource")
+		options = append(options, pair)
 	}
 
-	if authSource == "" {
-		authSource = strings.TrimPrefix(u.Path, "/")
+	cleanURI = scheme + "://" + authority + "/"
+	if len(options) > 0 {
+		cleanURI += "?" + strings.Join(options, "&")
 	}
-	u.Path = "/"
 
-	u.RawQuery = q.Encode()
-	cleanURI = u.String()
 	return
 }
 
-// lookupSrvURI converts mongodb+srv:// URI to mongodb:// URI, performing the simplest SRV lookup.
-func lookupSrvURI(ctx context.Context, u *url.URL) error {
-	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "mongodb", "tcp", u.Hostname())
-	if err != nil {
-		return fmt.Errorf("lookupSrvURI: SRV lookup failed: %w", err)
-	}
-
-	if len(srvs) != 1 {
-		return fmt.Errorf("lookupSrvURI: expected exactly one SRV record, got %d", len(srvs))
-	}
-
-	srv := srvs[0]
-	u.Host = net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
-	u.Scheme = "mongodb"
-
-	return nil
-}
-
 // sleep waits until the given duration is over or the context is canceled.
 func sleep(ctx context.Context, d time.Duration) {
 	ctx, cancel := context.WithTimeout(ctx, d)
@@ -0,0 +1,377 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wirepcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"time"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+)
+
+// maxPacketLen is the maximum length of a single captured packet or pcapng block.
+const maxPacketLen = 16 * 1024 * 1024
+
+// pcap magic numbers as read in little-endian order.
+const (
+	pcapMagicMicro        = 0xa1b2c3d4
+	pcapMagicNano         = 0xa1b23c4d
+	pcapMagicMicroSwapped = 0xd4c3b2a1
+	pcapMagicNanoSwapped  = 0x4d3cb2a1
+)
+
+// pcapng block types.
+const (
+	pcapngSectionHeader        = 0x0a0d0d0a
+	pcapngInterfaceDescription = 0x00000001
+	pcapngPacket               = 0x00000002 // obsolete
+	pcapngSimplePacket         = 0x00000003
+	pcapngEnhancedPacket       = 0x00000006
+)
+
+// pcapngByteOrderMagic is the pcapng section header byte-order magic.
+const pcapngByteOrderMagic = 0x1a2b3c4d
+
+// packet represents a single captured link-layer packet.
+type packet struct {
+	time     time.Time
+	data     []byte
+	linkType uint32
+}
+
+// packetReader reads packets from a capture file.
+type packetReader interface {
+	// next returns the next packet or io.EOF.
+	next() (*packet, error)
+}
+
+// newPacketReader detects the capture file format and returns a suitable reader.
+func newPacketReader(r *bufio.Reader) (packetReader, error) {
+	magic, err := r.Peek(4)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	switch binary.LittleEndian.Uint32(magic) {
+	case pcapngSectionHeader:
+		return &pcapngReader{r: r}, nil
+	case pcapMagicMicro, pcapMagicNano, pcapMagicMicroSwapped, pcapMagicNanoSwapped:
+		return newPcapReader(r)
+	default:
+		return nil, lazyerrors.Errorf("unknown capture file magic %#x", magic)
+	}
+}
+
+// pcapReader reads classic pcap files.
+type pcapReader struct {
+	r        *bufio.Reader
+	order    binary.ByteOrder
+	linkType uint32
+	nano     bool
+}
+
+// newPcapReader reads pcap file header and returns a new reader.
+func newPcapReader(r *bufio.Reader) (*pcapReader, error) {
+	b := make([]byte, 24)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	pr := &pcapReader{
+		r: r,
+	}
+
+	switch binary.LittleEndian.Uint32(b[0:4]) {
+	case pcapMagicMicro:
+		pr.order = binary.LittleEndian
+	case pcapMagicNano:
+		pr.order = binary.LittleEndian
+		pr.nano = true
+	case pcapMagicMicroSwapped:
+		pr.order = binary.BigEndian
+	case pcapMagicNanoSwapped:
+		pr.order = binary.BigEndian
+		pr.nano = true
+	default:
+		return nil, lazyerrors.Errorf("unknown pcap magic %#x", b[0:4])
+	}
+
+	// upper bits may contain FCS information
+	pr.linkType = pr.order.Uint32(b[20:24]) & 0x0fffffff
+
+	return pr, nil
+}
+
+// next implements packetReader.
+func (pr *pcapReader) next() (*packet, error) {
+	h := make([]byte, 16)
+	if _, err := io.ReadFull(pr.r, h); err != nil {
+		return nil, err
+	}
+
+	sec := int64(pr.order.Uint32(h[0:4]))
+	frac := int64(pr.order.Uint32(h[4:8]))
+	inclLen := pr.order.Uint32(h[8:12])
+
+	if inclLen > maxPacketLen {
+		return nil, lazyerrors.Errorf("invalid packet length %d", inclLen)
+	}
+
+	data := make([]byte, inclLen)
+	if _, err := io.ReadFull(pr.r, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	if !pr.nano {
+		frac *= int64(time.Microsecond)
+	}
+
+	return &packet{
+		time:     time.Unix(sec, frac).UTC(),
+		data:     data,
+		linkType: pr.linkType,
+	}, nil
+}
+
+// pcapngInterface represents a pcapng interface description.
+type pcapngInterface struct {
+	unitsPerSecond uint64
+	linkType       uint32
+	snapLen        uint32
+}
+
+// time converts the interface timestamp to time.
+func (iface *pcapngInterface) time(ts uint64) time.Time {
+	sec := ts / iface.unitsPerSecond
+	frac := ts % iface.unitsPerSecond
+
+	hi, lo := bits.Mul64(frac, uint64(time.Second))
+	nsec, _ := bits.Div64(hi, lo, iface.unitsPerSecond)
+
+	return time.Unix(int64(sec), int64(nsec)).UTC()
+}
+
+// pcapngReader reads pcapng files.
+type pcapngReader struct {
+	r          *bufio.Reader
+	order      binary.ByteOrder
+	interfaces []pcapngInterface
+}
+
+// next implements packetReader.
+func (pr *pcapngReader) next() (*packet, error) {
+	for {
+		blockType, body, err := pr.readBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		switch blockType {
+		case pcapngSectionHeader:
+			// byte order was handled by readBlock; interfaces are per-section
+			pr.interfaces = nil
+
+		case pcapngInterfaceDescription:
+			var iface *pcapngInterface
+			if iface, err = pr.parseInterface(body); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+
+			pr.interfaces = append(pr.interfaces, *iface)
+
+		case pcapngEnhancedPacket, pcapngPacket:
+			if len(body) < 20 {
+				return nil, lazyerrors.Errorf("invalid packet block length %d", len(body))
+			}
+
+			var ifaceID uint32
+			if blockType == pcapngPacket {
+				ifaceID = uint32(pr.order.Uint16(body[0:2]))
+			} else {
+				ifaceID = pr.order.Uint32(body[0:4])
+			}
+
+			if int(ifaceID) >= len(pr.interfaces) {
+				return nil, lazyerrors.Errorf("unknown interface %d", ifaceID)
+			}
+
+			iface := &pr.interfaces[ifaceID]
+
+			ts := uint64(pr.order.Uint32(body[4:8]))<<32 | uint64(pr.order.Uint32(body[8:12]))
+
+			capLen := pr.order.Uint32(body[12:16])
+			if int(capLen) > len(body)-20 {
+				return nil, lazyerrors.Errorf("invalid captured length %d", capLen)
+			}
+
+			return &packet{
+				time:     iface.time(ts),
+				data:     body[20 : 20+capLen],
+				linkType: iface.linkType,
+			}, nil
+
+		case pcapngSimplePacket:
+			if len(pr.interfaces) == 0 {
+				return nil, lazyerrors.New("simple packet block without interface")
+			}
+
+			if len(body) < 4 {
+				return nil, lazyerrors.Errorf("invalid simple packet block length %d", len(body))
+			}
+
+			iface := &pr.interfaces[0]
+
+			data := body[4:]
+			if origLen := pr.order.Uint32(body[0:4]); int(origLen) < len(data) {
+				data = data[:origLen]
+			}
+
+			if iface.snapLen > 0 && int(iface.snapLen) < len(data) {
+				data = data[:iface.snapLen]
+			}
+
+			// simple packet blocks have no timestamps
+			return &packet{
+				data:     data,
+				linkType: iface.linkType,
+			}, nil
+
+		default:
+			// skip other blocks
+		}
+	}
+}
+
+// readBlock reads a single block and returns its type and body without the trailing length.
+func (pr *pcapngReader) readBlock() (uint32, []byte, error) {
+	h := make([]byte, 8)
+	if _, err := io.ReadFull(pr.r, h); err != nil {
+		return 0, nil, err
+	}
+
+	blockType := binary.LittleEndian.Uint32(h[0:4])
+
+	if blockType == pcapngSectionHeader {
+		bom, err := pr.r.Peek(4)
+		if err != nil {
+			return 0, nil, unexpectedEOF(err)
+		}
+
+		switch {
+		case binary.LittleEndian.Uint32(bom) == pcapngByteOrderMagic:
+			pr.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(bom) == pcapngByteOrderMagic:
+			pr.order = binary.BigEndian
+		default:
+			return 0, nil, lazyerrors.Errorf("invalid byte-order magic %#x", bom)
+		}
+	}
+
+	if pr.order == nil {
+		return 0, nil, lazyerrors.New("no section header block")
+	}
+
+	blockType = pr.order.Uint32(h[0:4])
+
+	totalLen := pr.order.Uint32(h[4:8])
+	if totalLen < 12 || totalLen%4 != 0 || totalLen > maxPacketLen {
+		return 0, nil, lazyerrors.Errorf("invalid block length %d", totalLen)
+	}
+
+	b := make([]byte, totalLen-8)
+	if _, err := io.ReadFull(pr.r, b); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+
+	if trailing := pr.order.Uint32(b[len(b)-4:]); trailing != totalLen {
+		return 0, nil, lazyerrors.Errorf("block length mismatch: %d != %d", totalLen, trailing)
+	}
+
+	return blockType, b[:len(b)-4], nil
+}
+
+// parseInterface parses interface description block body.
+func (pr *pcapngReader) parseInterface(body []byte) (*pcapngInterface, error) {
+	if len(body) < 8 {
+		return nil, lazyerrors.Errorf("invalid interface description block length %d", len(body))
+	}
+
+	iface := &pcapngInterface{
+		unitsPerSecond: 1_000_000,
+		linkType:       uint32(pr.order.Uint16(body[0:2])),
+		snapLen:        pr.order.Uint32(body[4:8]),
+	}
+
+	opts := body[8:]
+	for len(opts) >= 4 {
+		code := pr.order.Uint16(opts[0:2])
+		l := int(pr.order.Uint16(opts[2:4]))
+
+		if code == 0 { // opt_endofopt
+			break
+		}
+
+		if len(opts) < 4+l {
+			return nil, lazyerrors.Errorf("invalid option length %d", l)
+		}
+
+		if code == 9 && l == 1 { // if_tsresol
+			v := opts[4]
+
+			var ups uint64
+			if v&0x80 == 0 {
+				if v > 19 {
+					return nil, lazyerrors.Errorf("invalid if_tsresol %#x", v)
+				}
+
+				ups = 1
+				for range v {
+					ups *= 10
+				}
+			} else {
+				if v&0x7f > 63 {
+					return nil, lazyerrors.Errorf("invalid if_tsresol %#x", v)
+				}
+
+				ups = 1 << (v & 0x7f)
+			}
+
+			iface.unitsPerSecond = ups
+		}
+
+		// values are padded to 32 bits
+		next := 4 + (l+3)&^3
+		if next > len(opts) {
+			break
+		}
+
+		opts = opts[next:]
+	}
+
+	return iface, nil
+}
+
+// unexpectedEOF converts io.EOF in the middle of a record to io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wirepcap
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+)
+
+// Link types, see https://www.tcpdump.org/linktypes.html.
+const (
+	linkTypeNull      = 0
+	linkTypeEthernet  = 1
+	linkTypeRaw       = 101
+	linkTypeLoop      = 108
+	linkTypeLinuxSLL  = 113
+	linkTypeLinuxSLL2 = 276
+)
+
+// EtherTypes.
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+)
+
+// TCP flags.
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpACK = 0x10
+)
+
+// protocolTCP is the IP protocol number for TCP.
+const protocolTCP = 6
+
+// segment represents a decoded TCP segment.
+type segment struct {
+	src     netip.AddrPort
+	dst     netip.AddrPort
+	payload []byte
+	seq     uint32
+	flags   uint8
+}
+
+// decodePacket decodes TCP segment from the link-layer packet.
+//
+// It returns nil segment without error for packets that are not TCP over IP.
+func decodePacket(linkType uint32, data []byte) (*segment, error) {
+	var ip []byte
+
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, lazyerrors.Errorf("invalid Ethernet frame length %d", len(data))
+		}
+
+		etherType := binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(data) < 4 {
+				return nil, lazyerrors.Errorf("invalid VLAN tag length %d", len(data))
+			}
+
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+
+		if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+			return nil, nil
+		}
+
+		ip = data
+
+	case linkTypeNull, linkTypeLoop:
+		// 4-byte address family in host or network byte order; IP version is checked below
+		if len(data) < 4 {
+			return nil, lazyerrors.Errorf("invalid loopback frame length %d", len(data))
+		}
+
+		ip = data[4:]
+
+	case linkTypeRaw:
+		ip = data
+
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, lazyerrors.Errorf("invalid Linux SLL frame length %d", len(data))
+		}
+
+		if p := binary.BigEndian.Uint16(data[14:16]); p != etherTypeIPv4 && p != etherTypeIPv6 {
+			return nil, nil
+		}
+
+		ip = data[16:]
+
+	case linkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return nil, lazyerrors.Errorf("invalid Linux SLL2 frame length %d", len(data))
+		}
+
+		if p := binary.BigEndian.Uint16(data[0:2]); p != etherTypeIPv4 && p != etherTypeIPv6 {
+			return nil, nil
+		}
+
+		ip = data[20:]
+
+	default:
+		return nil, lazyerrors.Errorf("unsupported link type %d", linkType)
+	}
+
+	if len(ip) == 0 {
+		return nil, lazyerrors.New("empty IP packet")
+	}
+
+	switch ip[0] >> 4 {
+	case 4:
+		return decodeIPv4(ip)
+	case 6:
+		return decodeIPv6(ip)
+	default:
+		return nil, nil
+	}
+}
+
+// decodeIPv4 decodes TCP segment from IPv4 packet.
+func decodeIPv4(b []byte) (*segment, error) {
+	if len(b) < 20 {
+		return nil, lazyerrors.Errorf("invalid IPv4 packet length %d", len(b))
+	}
+
+	ihl := int(b[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(b[2:4]))
+
+	if ihl < 20 || totalLen < ihl || totalLen > len(b) {
+		return nil, lazyerrors.Errorf("invalid IPv4 header: ihl=%d, total=%d, len=%d", ihl, totalLen, len(b))
+	}
+
+	// fragmented packets are not reassembled; TCP segments are rarely fragmented
+	if frag := binary.BigEndian.Uint16(b[6:8]); frag&0x3fff != 0 {
+		return nil, nil
+	}
+
+	if b[9] != protocolTCP {
+		return nil, nil
+	}
+
+	src := netip.AddrFrom4([4]byte(b[12:16]))
+	dst := netip.AddrFrom4([4]byte(b[16:20]))
+
+	// trim Ethernet padding
+	return decodeTCP(src, dst, b[ihl:totalLen])
+}
+
+// decodeIPv6 decodes TCP segment from IPv6 packet.
+func decodeIPv6(b []byte) (*segment, error) {
+	if len(b) < 40 {
+		return nil, lazyerrors.Errorf("invalid IPv6 packet length %d", len(b))
+	}
+
+	payloadLen := int(binary.BigEndian.Uint16(b[4:6]))
+	if 40+payloadLen > len(b) {
+		return nil, lazyerrors.Errorf("invalid IPv6 payload length %d, len=%d", payloadLen, len(b))
+	}
+
+	next := b[6]
+	src := netip.AddrFrom16([16]byte(b[8:24]))
+	dst := netip.AddrFrom16([16]byte(b[24:40]))
+	payload := b[40 : 40+payloadLen]
+
+	for {
+		switch next {
+		case protocolTCP:
+			return decodeTCP(src, dst, payload)
+
+		case 0, 43, 60: // hop-by-hop, routing, destination options
+			if len(payload) < 8 {
+				return nil, lazyerrors.Errorf("invalid IPv6 extension header length %d", len(payload))
+			}
+
+			l := (int(payload[1]) + 1) * 8
+			if l > len(payload) {
+				return nil, lazyerrors.Errorf("invalid IPv6 extension header length %d", l)
+			}
+
+			next = payload[0]
+			payload = payload[l:]
+
+		default:
+			// fragments and other protocols
+			return nil, nil
+		}
+	}
+}
+
+// decodeTCP decodes TCP segment.
+func decodeTCP(src, dst netip.Addr, b []byte) (*segment, error) {
+	if len(b) < 20 {
+		return nil, lazyerrors.Errorf("invalid TCP segment length %d", len(b))
+	}
+
+	dataOffset := int(b[12]>>4) * 4
+	if dataOffset < 20 || dataOffset > len(b) {
+		return nil, lazyerrors.Errorf("invalid TCP data offset %d, len=%d", dataOffset, len(b))
+	}
+
+	return &segment{
+		src:     netip.AddrPortFrom(src.Unmap(), binary.BigEndian.Uint16(b[0:2])),
+		dst:     netip.AddrPortFrom(dst.Unmap(), binary.BigEndian.Uint16(b[2:4])),
+		payload: b[dataOffset:],
+		seq:     binary.BigEndian.Uint32(b[4:8]),
+		flags:   b[13],
+	}, nil
+}
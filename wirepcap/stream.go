@@ -0,0 +1,342 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wirepcap
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+)
+
+// maxPendingSegments is the maximum number of out-of-order segments buffered per stream.
+// When exceeded, the stream is considered to have a gap (lost segments) and is abandoned.
+const maxPendingSegments = 1024
+
+// connKey identifies a TCP connection.
+type connKey struct {
+	client netip.AddrPort
+	server netip.AddrPort
+}
+
+// conn represents a tracked TCP connection.
+type conn struct {
+	key     connKey
+	streams [2]stream // indexed by Direction-1
+	id      int
+}
+
+// chunk represents out-of-order segment data.
+type chunk struct {
+	time time.Time
+	b    []byte
+}
+
+// stream represents a single direction of a TCP connection.
+type stream struct {
+	pending map[uint32]chunk
+	start   time.Time // time of the first byte in buf
+	last    time.Time // time of the last appended data
+	buf     []byte
+	next    uint32 // next expected sequence number
+	init    bool
+	broken  bool // stream can't be parsed anymore
+}
+
+// assembler reassembles TCP streams and extracts wire protocol messages from them.
+type assembler struct {
+	ports   map[uint16]struct{}
+	conns   map[connKey]*conn
+	records []Record
+	lastID  int
+}
+
+// newAssembler creates a new assembler for the given server ports.
+func newAssembler(ports []uint16) *assembler {
+	a := &assembler{
+		ports: make(map[uint16]struct{}, len(ports)),
+		conns: map[connKey]*conn{},
+	}
+
+	for _, p := range ports {
+		a.ports[p] = struct{}{}
+	}
+
+	return a
+}
+
+// add processes a single TCP segment.
+func (a *assembler) add(t time.Time, seg *segment) {
+	var key connKey
+	var dir Direction
+
+	switch {
+	case a.isServer(seg.dst.Port()):
+		key = connKey{client: seg.src, server: seg.dst}
+		dir = ClientToServer
+	case a.isServer(seg.src.Port()):
+		key = connKey{client: seg.dst, server: seg.src}
+		dir = ServerToClient
+	default:
+		return
+	}
+
+	c := a.conns[key]
+
+	// client's SYN starts a new connection, unless it is a retransmission
+	if dir == ClientToServer && seg.flags&tcpSYN != 0 && seg.flags&tcpACK == 0 {
+		if c != nil {
+			if s := &c.streams[dir-1]; s.init && s.next == seg.seq+1 {
+				return
+			}
+
+			a.finish(c)
+		}
+
+		c = nil
+	}
+
+	if c == nil {
+		a.lastID++
+		c = &conn{
+			key: key,
+			id:  a.lastID,
+		}
+		a.conns[key] = c
+	}
+
+	s := &c.streams[dir-1]
+
+	seq := seg.seq
+	if seg.flags&tcpSYN != 0 {
+		// SYN consumes one sequence number
+		seq++
+
+		if !s.init {
+			s.init = true
+			s.next = seq
+		}
+	}
+
+	if len(seg.payload) == 0 {
+		return
+	}
+
+	// capture started in the middle of the connection
+	if !s.init {
+		s.init = true
+		s.next = seq
+	}
+
+	a.write(c, dir, t, seq, seg.payload)
+}
+
+// isServer returns true if the given port is a server port.
+func (a *assembler) isServer(port uint16) bool {
+	_, ok := a.ports[port]
+	return ok
+}
+
+// write handles segment data with the given sequence number.
+func (a *assembler) write(c *conn, dir Direction, t time.Time, seq uint32, payload []byte) {
+	s := &c.streams[dir-1]
+
+	if s.broken {
+		return
+	}
+
+	diff := int32(seq - s.next)
+
+	if diff > 0 {
+		if s.pending == nil {
+			s.pending = map[uint32]chunk{}
+		}
+
+		if existing, ok := s.pending[seq]; !ok || len(existing.b) < len(payload) {
+			s.pending[seq] = chunk{time: t, b: bytes.Clone(payload)}
+		}
+
+		if len(s.pending) > maxPendingSegments {
+			a.abandon(c, dir, lazyerrors.New("missing TCP segments"))
+		}
+
+		return
+	}
+
+	// retransmission
+	if int(-diff) >= len(payload) {
+		return
+	}
+
+	a.append(s, t, payload[-diff:])
+
+	for len(s.pending) > 0 {
+		var found bool
+
+		for pseq, ch := range s.pending {
+			d := int32(pseq - s.next)
+			if d > 0 {
+				continue
+			}
+
+			delete(s.pending, pseq)
+
+			if int(-d) < len(ch.b) {
+				a.append(s, ch.time, ch.b[-d:])
+			}
+
+			found = true
+		}
+
+		if !found {
+			break
+		}
+	}
+
+	a.extract(c, dir)
+}
+
+// append adds in-order data to the stream buffer.
+func (a *assembler) append(s *stream, t time.Time, b []byte) {
+	if len(s.buf) == 0 {
+		s.start = t
+	}
+
+	s.buf = append(s.buf, b...)
+	s.next += uint32(len(b))
+	s.last = t
+}
+
+// extract emits all complete messages from the stream buffer.
+func (a *assembler) extract(c *conn, dir Direction) {
+	s := &c.streams[dir-1]
+
+	for !s.broken && len(s.buf) >= 4 {
+		l := int(int32(binary.LittleEndian.Uint32(s.buf)))
+		if l < wire.MsgHeaderLen || l > wire.MaxMsgLen {
+			// we can't find the next message without a valid length
+			a.abandon(c, dir, lazyerrors.Errorf("invalid message length %d", l))
+			return
+		}
+
+		if len(s.buf) < l {
+			return
+		}
+
+		a.emit(c, dir, s.start, s.buf[:l], nil)
+
+		s.buf = s.buf[l:]
+		s.start = s.last
+	}
+}
+
+// abandon emits buffered data as a malformed record and stops parsing the stream.
+func (a *assembler) abandon(c *conn, dir Direction, err error) {
+	s := &c.streams[dir-1]
+
+	if len(s.buf) > 0 {
+		a.emit(c, dir, s.start, s.buf, err)
+	}
+
+	s.broken = true
+	s.buf = nil
+	s.pending = nil
+}
+
+// finish emits incomplete messages of the connection and stops tracking it.
+func (a *assembler) finish(c *conn) {
+	for i := range c.streams {
+		dir := Direction(i + 1)
+		s := &c.streams[i]
+
+		if s.broken || len(s.buf) == 0 {
+			continue
+		}
+
+		a.abandon(c, dir, lazyerrors.Errorf("incomplete message: %d bytes", len(s.buf)))
+	}
+
+	delete(a.conns, c.key)
+}
+
+// finishAll emits incomplete messages of all connections in the order of their IDs.
+func (a *assembler) finishAll() {
+	conns := make([]*conn, 0, len(a.conns))
+	for _, c := range a.conns {
+		conns = append(conns, c)
+	}
+
+	slices.SortFunc(conns, func(a, b *conn) int { return cmp.Compare(a.id, b.id) })
+
+	for _, c := range conns {
+		a.finish(c)
+	}
+}
+
+// emit adds a record for the given message bytes.
+// If err is nil, the message is parsed by [wire.ReadMessage].
+func (a *assembler) emit(c *conn, dir Direction, t time.Time, b []byte, err error) {
+	rec := Record{
+		Time:      t,
+		Client:    c.key.client,
+		Server:    c.key.server,
+		ConnID:    c.id,
+		Direction: dir,
+	}
+
+	if err == nil {
+		rec.Record = newRecord(b)
+	} else {
+		n := min(len(b), wire.MsgHeaderLen)
+		rec.Record = wire.Record{
+			HeaderB: bytes.Clone(b[:n]),
+			BodyB:   bytes.Clone(b[n:]),
+			Err:     err,
+		}
+	}
+
+	a.records = append(a.records, rec)
+}
+
+// newRecord parses a complete message.
+func newRecord(b []byte) wire.Record {
+	header, body, err := wire.ReadMessage(bufio.NewReader(bytes.NewReader(b)))
+	if err == nil {
+		// OP_COMPRESSED messages are stored decompressed, as with wire.LoadRecords
+		rec := wire.Record{
+			Header: header,
+			Body:   body,
+		}
+
+		if rec.HeaderB, err = header.MarshalBinary(); err == nil {
+			if rec.BodyB, err = body.MarshalBinary(); err == nil {
+				return rec
+			}
+		}
+	}
+
+	return wire.Record{
+		Header:  header,
+		HeaderB: bytes.Clone(b[:wire.MsgHeaderLen]),
+		BodyB:   bytes.Clone(b[wire.MsgHeaderLen:]),
+		Err:     err,
+	}
+}
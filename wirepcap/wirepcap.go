@@ -0,0 +1,197 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wirepcap imports wire protocol messages from pcap and pcapng packet captures.
+//
+// TCP streams on configured ports are reassembled,
+// and messages are parsed into records compatible with [wire.LoadRecords].
+// IP fragments are not reassembled.
+package wirepcap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+)
+
+// DefaultPort is the default MongoDB server port.
+const DefaultPort = 27017
+
+// Opts represents capture import options.
+type Opts struct {
+	// Ports are server TCP ports; [DefaultPort] is used if empty.
+	// Segments sent to those ports are considered client requests.
+	Ports []uint16
+}
+
+// Direction represents message direction.
+type Direction int
+
+const (
+	// ClientToServer is a direction of requests.
+	ClientToServer Direction = iota + 1
+
+	// ServerToClient is a direction of responses.
+	ServerToClient
+)
+
+// String returns a string representation for logging.
+func (d Direction) String() string {
+	switch d {
+	case ClientToServer:
+		return "client->server"
+	case ServerToClient:
+		return "server->client"
+	default:
+		return "unknown"
+	}
+}
+
+// Record represents a single wire protocol message extracted from a packet capture.
+//
+// Malformed and incomplete messages have [wire.Record.Err] set, like records returned by [wire.LoadRecords].
+type Record struct {
+	// Time is the capture time of the packet with the first byte of the message.
+	// It is zero for pcapng simple packet blocks.
+	Time time.Time
+
+	Client netip.AddrPort
+	Server netip.AddrPort
+
+	wire.Record
+
+	// ConnID identifies TCP connection within a single capture file, starting from 1.
+	ConnID int
+
+	Direction Direction
+}
+
+// Read reads pcap or pcapng capture from the given reader and returns records in the order of their completion.
+//
+// A truncated last packet (for example, when capture was interrupted) is ignored.
+// Packets that can't be decoded are skipped.
+func Read(r io.Reader, opts *Opts) ([]Record, error) {
+	if opts == nil {
+		opts = new(Opts)
+	}
+
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = []uint16{DefaultPort}
+	}
+
+	pr, err := newPacketReader(bufio.NewReader(r))
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	a := newAssembler(ports)
+
+	for {
+		var p *packet
+		if p, err = pr.next(); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+
+			return nil, lazyerrors.Error(err)
+		}
+
+		var seg *segment
+		if seg, err = decodePacket(p.linkType, p.data); err != nil || seg == nil {
+			continue
+		}
+
+		a.add(p.time, seg)
+	}
+
+	a.finishAll()
+
+	return a.records, nil
+}
+
+// ReadFile reads a single pcap or pcapng file. See [Read].
+func ReadFile(file string, opts *Opts) ([]Record, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	defer f.Close() //nolint:errcheck // we are only reading it
+
+	res, err := Read(f, opts)
+	if err != nil {
+		return nil, lazyerrors.Errorf("%s: %w", file, err)
+	}
+
+	return res, nil
+}
+
+// LoadRecords finds all .pcap and .pcapng files recursively,
+// selects up to the limit at random (or all if limit <= 0), and reads them.
+//
+// It is a counterpart of [wire.LoadRecords] for packet captures.
+// Connection IDs are unique only within a single file.
+func LoadRecords(dir string, limit int, opts *Opts) ([]Record, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		switch filepath.Ext(entry.Name()) {
+		case ".pcap", ".pcapng":
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, lazyerrors.Error(err)
+	}
+
+	if limit > 0 && len(files) > limit {
+		f := make([]string, limit)
+		for fI, filesI := range rand.Perm(len(files))[:limit] {
+			f[fI] = files[filesI]
+		}
+		files = f
+	}
+
+	var res []Record
+
+	for _, file := range files {
+		var r []Record
+		if r, err = ReadFile(file, opts); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		res = append(res, r...)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,335 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wirepcap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+)
+
+// testPacket represents a packet for the test capture.
+type testPacket struct {
+	time    time.Time
+	src     netip.AddrPort
+	dst     netip.AddrPort
+	payload []byte
+	seq     uint32
+	flags   uint8
+}
+
+// ip returns IPv4 or IPv6 packet with TCP segment.
+func (p *testPacket) ip() []byte {
+	tcp := make([]byte, 20, 20+len(p.payload))
+	binary.BigEndian.PutUint16(tcp[0:2], p.src.Port())
+	binary.BigEndian.PutUint16(tcp[2:4], p.dst.Port())
+	binary.BigEndian.PutUint32(tcp[4:8], p.seq)
+	tcp[12] = 5 << 4
+	tcp[13] = p.flags
+	tcp = append(tcp, p.payload...)
+
+	if p.src.Addr().Is4() {
+		ip := make([]byte, 20, 20+len(tcp))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(tcp)))
+		ip[8] = 64
+		ip[9] = protocolTCP
+		copy(ip[12:16], p.src.Addr().AsSlice())
+		copy(ip[16:20], p.dst.Addr().AsSlice())
+
+		return append(ip, tcp...)
+	}
+
+	ip := make([]byte, 40, 40+len(tcp))
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:6], uint16(len(tcp)))
+	ip[6] = protocolTCP
+	ip[7] = 64
+	copy(ip[8:24], p.src.Addr().AsSlice())
+	copy(ip[24:40], p.dst.Addr().AsSlice())
+
+	return append(ip, tcp...)
+}
+
+// ethernet returns Ethernet frame with IP packet.
+func (p *testPacket) ethernet() []byte {
+	frame := make([]byte, 14)
+	frame[0] = 0x02
+	frame[6] = 0x02
+
+	etherType := uint16(etherTypeIPv4)
+	if p.src.Addr().Is6() {
+		etherType = etherTypeIPv6
+	}
+
+	binary.BigEndian.PutUint16(frame[12:14], etherType)
+
+	return append(frame, p.ip()...)
+}
+
+// writePcap returns a pcap file with Ethernet frames.
+func writePcap(packets []testPacket) []byte {
+	b := make([]byte, 24)
+	binary.LittleEndian.PutUint32(b[0:4], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(b[4:6], 2)
+	binary.LittleEndian.PutUint16(b[6:8], 4)
+	binary.LittleEndian.PutUint32(b[16:20], 65535)
+	binary.LittleEndian.PutUint32(b[20:24], linkTypeEthernet)
+
+	for _, p := range packets {
+		frame := p.ethernet()
+
+		h := make([]byte, 16)
+		binary.LittleEndian.PutUint32(h[0:4], uint32(p.time.Unix()))
+		binary.LittleEndian.PutUint32(h[4:8], uint32(p.time.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(h[8:12], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(h[12:16], uint32(len(frame)))
+
+		b = append(b, h...)
+		b = append(b, frame...)
+	}
+
+	return b
+}
+
+// pcapngBlock returns a big-endian pcapng block.
+func pcapngBlock(blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+
+	l := uint32(12 + len(body))
+
+	b := binary.BigEndian.AppendUint32(nil, blockType)
+	b = binary.BigEndian.AppendUint32(b, l)
+	b = append(b, body...)
+
+	return binary.BigEndian.AppendUint32(b, l)
+}
+
+// writePcapng returns a big-endian pcapng file with raw IP packets and nanosecond timestamps.
+func writePcapng(packets []testPacket) []byte {
+	shb := binary.BigEndian.AppendUint32(nil, pcapngByteOrderMagic)
+	shb = binary.BigEndian.AppendUint16(shb, 1)
+	shb = binary.BigEndian.AppendUint16(shb, 0)
+	shb = binary.BigEndian.AppendUint64(shb, 0xffffffffffffffff)
+	b := pcapngBlock(pcapngSectionHeader, shb)
+
+	// unrelated block that should be skipped
+	b = append(b, pcapngBlock(0x00000005, []byte{1, 2, 3, 4})...)
+
+	idb := binary.BigEndian.AppendUint16(nil, linkTypeRaw)
+	idb = binary.BigEndian.AppendUint16(idb, 0)
+	idb = binary.BigEndian.AppendUint32(idb, 0)
+	idb = binary.BigEndian.AppendUint16(idb, 9) // if_tsresol
+	idb = binary.BigEndian.AppendUint16(idb, 1)
+	idb = append(idb, 9, 0, 0, 0)
+	idb = binary.BigEndian.AppendUint32(idb, 0) // opt_endofopt
+	b = append(b, pcapngBlock(pcapngInterfaceDescription, idb)...)
+
+	for _, p := range packets {
+		data := p.ip()
+		ts := uint64(p.time.UnixNano())
+
+		epb := binary.BigEndian.AppendUint32(nil, 0)
+		epb = binary.BigEndian.AppendUint32(epb, uint32(ts>>32))
+		epb = binary.BigEndian.AppendUint32(epb, uint32(ts))
+		epb = binary.BigEndian.AppendUint32(epb, uint32(len(data)))
+		epb = binary.BigEndian.AppendUint32(epb, uint32(len(data)))
+		epb = append(epb, data...)
+
+		b = append(b, pcapngBlock(pcapngEnhancedPacket, epb)...)
+	}
+
+	return b
+}
+
+// message returns a marshaled OP_MSG message.
+func message(tb testing.TB, requestID, responseTo int32, pairs ...any) []byte {
+	tb.Helper()
+
+	body := wire.MustOpMsg(pairs...)
+	header := &wire.MsgHeader{
+		MessageLength: int32(body.Size() + wire.MsgHeaderLen),
+		RequestID:     requestID,
+		ResponseTo:    responseTo,
+		OpCode:        wire.OpCodeMsg,
+	}
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	require.NoError(tb, wire.WriteMessage(w, header, body))
+	require.NoError(tb, w.Flush())
+
+	return buf.Bytes()
+}
+
+// command returns the command name of the record's OP_MSG.
+func command(tb testing.TB, rec *Record) string {
+	tb.Helper()
+
+	require.NoError(tb, rec.Err)
+
+	doc, err := rec.Body.(*wire.OpMsg).Document()
+	require.NoError(tb, err)
+
+	return doc.Command()
+}
+
+// testPackets returns packets for two connections.
+//
+// The first IPv4 connection has a request split into out-of-order and retransmitted segments,
+// and a response.
+// The second IPv6 connection starts in the middle and has a request followed by garbage.
+func testPackets(tb testing.TB, start time.Time) []testPacket {
+	tb.Helper()
+
+	client := netip.MustParseAddrPort("10.0.0.1:50000")
+	server := netip.MustParseAddrPort("10.0.0.2:27017")
+	client6 := netip.MustParseAddrPort("[fd00::1]:50001")
+	server6 := netip.MustParseAddrPort("[fd00::2]:27017")
+
+	req := message(tb, 1, 0, "ping", int32(1), "$db", "admin")
+	res := message(tb, 2, 1, "ok", float64(1))
+	req6 := message(tb, 3, 0, "hello", int32(1), "$db", "admin")
+
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	return []testPacket{
+		{time: at(0), src: client, dst: server, seq: 999, flags: tcpSYN},
+		{time: at(1), src: server, dst: client, seq: 4999, flags: tcpSYN | tcpACK},
+		{time: at(2), src: client, dst: server, seq: 1000 + 10, payload: req[10:20]},
+		{time: at(3), src: client, dst: server, seq: 1000, payload: req[:10]},
+		{time: at(4), src: client, dst: server, seq: 1000, payload: req[:15]}, // retransmission with overlap
+		{time: at(5), src: client, dst: server, seq: 1000 + 20, payload: req[20:]},
+		{time: at(6), src: server, dst: client, seq: 5000, payload: res},
+		{time: at(7), src: client6, dst: server6, seq: 42, payload: req6},
+		{time: at(8), src: client6, dst: server6, seq: 42 + uint32(len(req6)), payload: []byte{1, 2, 3, 4, 5, 6}},
+		{time: at(9), src: server, dst: client, seq: 5000 + uint32(len(res)), flags: tcpFIN},
+	}
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)
+	packets := testPackets(t, start)
+
+	for name, b := range map[string][]byte{
+		"pcap":   writePcap(packets),
+		"pcapng": writePcapng(packets),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			records, err := Read(bytes.NewReader(b), nil)
+			require.NoError(t, err)
+			require.Len(t, records, 4)
+
+			assert.Equal(t, "ping", command(t, &records[0]))
+			assert.Equal(t, ClientToServer, records[0].Direction)
+			assert.Equal(t, 1, records[0].ConnID)
+			assert.Equal(t, netip.MustParseAddrPort("10.0.0.1:50000"), records[0].Client)
+			assert.Equal(t, netip.MustParseAddrPort("10.0.0.2:27017"), records[0].Server)
+			assert.Equal(t, start.Add(3*time.Millisecond), records[0].Time) // the first byte is in the delayed segment
+			assert.Equal(t, int32(1), records[0].Header.RequestID)
+
+			assert.Equal(t, "ok", command(t, &records[1]))
+			assert.Equal(t, ServerToClient, records[1].Direction)
+			assert.Equal(t, 1, records[1].ConnID)
+			assert.Equal(t, int32(1), records[1].Header.ResponseTo)
+			assert.Equal(t, start.Add(6*time.Millisecond), records[1].Time)
+
+			assert.Equal(t, "hello", command(t, &records[2]))
+			assert.Equal(t, ClientToServer, records[2].Direction)
+			assert.Equal(t, 2, records[2].ConnID)
+			assert.Equal(t, netip.MustParseAddrPort("[fd00::1]:50001"), records[2].Client)
+
+			assert.Error(t, records[3].Err)
+			assert.Nil(t, records[3].Body)
+			assert.Equal(t, 2, records[3].ConnID)
+			assert.Equal(t, []byte{1, 2, 3, 4, 5, 6}, append(records[3].HeaderB, records[3].BodyB...))
+		})
+	}
+}
+
+func TestReadPorts(t *testing.T) {
+	t.Parallel()
+
+	b := writePcap(testPackets(t, time.Now()))
+
+	records, err := Read(bytes.NewReader(b), &Opts{Ports: []uint16{27018}})
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestReadIncomplete(t *testing.T) {
+	t.Parallel()
+
+	client := netip.MustParseAddrPort("10.0.0.1:50000")
+	server := netip.MustParseAddrPort("10.0.0.2:27017")
+	req := message(t, 1, 0, "ping", int32(1), "$db", "admin")
+
+	b := writePcap([]testPacket{
+		{src: client, dst: server, seq: 1, payload: req[:len(req)-1]},
+	})
+
+	// truncated last packet is ignored
+	b = append(b, 0x01, 0x02)
+
+	records, err := Read(bytes.NewReader(b), nil)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	assert.Error(t, records[0].Err)
+	assert.Equal(t, req[:wire.MsgHeaderLen], records[0].HeaderB)
+	assert.Equal(t, req[wire.MsgHeaderLen:len(req)-1], records[0].BodyB)
+}
+
+func TestReadInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := Read(bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7, 8}), nil)
+	require.Error(t, err)
+}
+
+func TestLoadRecords(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	packets := testPackets(t, time.Now())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.pcap"), writePcap(packets), 0o666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.pcapng"), writePcapng(packets), 0o666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.bin"), []byte{1, 2, 3}, 0o666))
+
+	records, err := LoadRecords(dir, 0, nil)
+	require.NoError(t, err)
+	assert.Len(t, records, 8)
+
+	records, err = LoadRecords(dir, 1, nil)
+	require.NoError(t, err)
+	assert.Len(t, records, 4)
+}
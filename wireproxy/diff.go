@@ -0,0 +1,595 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/bsondiff"
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireclient"
+)
+
+// DiffOpts represents [DiffProxy] options.
+type DiffOpts struct {
+	// Output receives [DiffRecord]s as JSON lines.
+	Output io.Writer
+
+	// DialContext is used to connect to upstream servers.
+	// If nil, [net.Dialer.DialContext] is used.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Logger is used only for debug-level messages; if nil, nothing is logged.
+	Logger *slog.Logger
+
+	// SecondaryCredentials are used to authenticate each secondary connection with [wireclient.Conn.Login]
+	// right after it is established, if set.
+	// Client's own authentication conversation can't be replayed against the secondary,
+	// because SCRAM proofs depend on the server nonce.
+	SecondaryCredentials *url.Userinfo
+
+	// Primary is the TCP address of the upstream server whose responses are sent to clients.
+	Primary string
+
+	// Secondary is the TCP address of the upstream server whose responses are only compared.
+	Secondary string
+
+	// SecondaryAuthSource is the authentication database for SecondaryCredentials; `admin` if empty.
+	SecondaryAuthSource string
+
+	// SecondaryAuthMechanism is passed to [wireclient.Conn.Login]; if empty, it is negotiated.
+	SecondaryAuthMechanism string
+
+	// IgnoreFields contains names of top-level response fields that are not compared,
+	// for example, `$clusterTime`, `operationTime`, or `connectionId`.
+	IgnoreFields []string
+}
+
+// primaryOnlyCommands contains commands that are sent only to the primary and not compared:
+// handshake and authentication commands, commands that use primary's cursor IDs,
+// and commands that make sense only with session fields.
+var primaryOnlyCommands = []string{
+	"hello",
+	"isMaster",
+	"ismaster",
+	"saslStart",
+	"saslContinue",
+	"authenticate",
+	"getnonce",
+	"logout",
+	"getMore",
+	"killCursors",
+	"commitTransaction",
+	"abortTransaction",
+	"endSessions",
+}
+
+// sessionFields contains names of top-level request fields
+// that are removed from requests sent to the secondary.
+var sessionFields = []string{
+	"lsid",
+	"txnNumber",
+	"startTransaction",
+	"autocommit",
+	"$clusterTime",
+}
+
+// DiffRecord represents the difference between primary and secondary responses to the same request.
+type DiffRecord struct {
+	Time      time.Time          `json:"time"`
+	Request   *wirebson.Document `json:"request"`             // section 0 only
+	Primary   *wirebson.Document `json:"primary"`             // the first response only for exhaust cursors
+	Secondary *wirebson.Document `json:"secondary,omitempty"` // nil if Error is set
+	Command   string             `json:"command"`
+	Diff      string             `json:"diff,omitempty"` // unified diff without ignored fields
+	Error     string             `json:"error,omitempty"`
+	ConnID    int64              `json:"conn"`
+}
+
+// DiffProxy forwards wire protocol messages from clients to the primary upstream server,
+// sends the same OP_MSG requests to the secondary upstream server,
+// and records differences between their responses.
+//
+// Clients receive only primary's responses.
+// Messages with other opcodes (such as legacy OP_QUERY handshakes)
+// and handshake and authentication commands are sent only to the primary and not compared;
+// see [DiffOpts.SecondaryCredentials].
+// Requests from a single client connection are handled one by one:
+// the next request is read after both upstream servers respond.
+//
+// Cursor IDs are not mapped between servers, so `getMore` and `killCursors` are sent only to the primary,
+// and only the first batches of cursors are compared.
+// `lsid`, `txnNumber`, `startTransaction`, `autocommit`, and `$clusterTime` fields are removed
+// from requests sent to the secondary (they are not valid there),
+// and transaction and session commands are sent only to the primary.
+// Because of that, all secondary commands run outside of sessions and transactions.
+type DiffProxy struct {
+	opts       *DiffOpts
+	l          *slog.Logger
+	lastConnID atomic.Int64
+	m          sync.Mutex // protects Output
+}
+
+// NewDiff creates a new diff proxy.
+func NewDiff(opts *DiffOpts) (*DiffProxy, error) {
+	switch {
+	case opts == nil || opts.Primary == "":
+		return nil, lazyerrors.New("primary upstream is not set")
+	case opts.Secondary == "":
+		return nil, lazyerrors.New("secondary upstream is not set")
+	case opts.Output == nil:
+		return nil, lazyerrors.New("output is not set")
+	}
+
+	o := *opts
+
+	if o.DialContext == nil {
+		var d net.Dialer
+		o.DialContext = d.DialContext
+	}
+
+	l := o.Logger
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+
+	return &DiffProxy{
+		opts: &o,
+		l:    l,
+	}, nil
+}
+
+// ListenAndServe listens on the TCP network address and calls [DiffProxy.Serve].
+func (p *DiffProxy) ListenAndServe(ctx context.Context, addr string) error {
+	var lc net.ListenConfig
+
+	l, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return p.Serve(ctx, l)
+}
+
+// Serve accepts client connections on the given listener and proxies them in separate goroutines
+// until ctx is canceled or the listener fails.
+// The listener is closed on return.
+//
+// When ctx is canceled or the listener fails, all connections are closed.
+// Serve waits for all connection goroutines to exit and returns nil or the listener error.
+func (p *DiffProxy) Serve(ctx context.Context, l net.Listener) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = l.Close()
+	})
+	defer stop()
+
+	defer l.Close() //nolint:errcheck // listener could be already closed
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// close connections before waiting for them, even if the listener fails
+	connCtx, connCancel := context.WithCancel(ctx)
+	defer connCancel()
+
+	p.l.DebugContext(
+		ctx, "Listening",
+		slog.String("addr", l.Addr().String()),
+		slog.String("primary", p.opts.Primary), slog.String("secondary", p.opts.Secondary),
+	)
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				p.l.DebugContext(ctx, "Stopped listening", slog.String("addr", l.Addr().String()))
+				return nil
+			}
+
+			return lazyerrors.Error(err)
+		}
+
+		id := p.lastConnID.Add(1)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			p.serveConn(connCtx, nc, id)
+		}()
+	}
+}
+
+// upstream represents a connection to the upstream server.
+type upstream struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+// dial connects to the upstream server.
+func (p *DiffProxy) dial(ctx context.Context, addr string) (*upstream, error) {
+	nc, err := p.opts.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &upstream{
+		nc: nc,
+		r:  bufio.NewReader(nc),
+		w:  bufio.NewWriter(nc),
+	}, nil
+}
+
+// write writes the message to the upstream server.
+func (u *upstream) write(header *wire.MsgHeader, body wire.MsgBody) error {
+	if err := wire.WriteMessage(u.w, header, body); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if err := u.w.Flush(); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// responses reads responses to the given request from the upstream server, calling f for each of them,
+// until the response without moreToCome flag is read.
+// It does nothing if the request does not expect a response.
+func (u *upstream) responses(req wire.MsgBody, f func(*wire.MsgHeader, wire.MsgBody) error) error {
+	if !expectsResponse(req) {
+		return nil
+	}
+
+	for {
+		header, body, err := wire.ReadMessage(u.r)
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		if err = f(header, body); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		if msg, ok := body.(*wire.OpMsg); !ok || !msg.Flags.FlagSet(wire.OpMsgMoreToCome) {
+			return nil
+		}
+	}
+}
+
+// serveConn proxies a single client connection until either the client or the primary closes it,
+// an error happens, or ctx is canceled.
+//
+// Secondary errors after both connections are established do not close the client connection;
+// they are recorded, and subsequent requests are sent only to the primary.
+func (p *DiffProxy) serveConn(ctx context.Context, client net.Conn, id int64) {
+	l := p.l.With(slog.Int64("conn", id), slog.String("client", client.RemoteAddr().String()))
+
+	defer client.Close() //nolint:errcheck // we are closing it anyway
+
+	primary, dialErr := p.dial(ctx, p.opts.Primary)
+	if dialErr != nil {
+		l.DebugContext(ctx, "Failed to connect to primary", slog.String("error", dialErr.Error()))
+		return
+	}
+
+	defer primary.nc.Close() //nolint:errcheck // we are closing it anyway
+
+	secondary, dialErr := p.dial(ctx, p.opts.Secondary)
+	if dialErr != nil {
+		l.DebugContext(ctx, "Failed to connect to secondary", slog.String("error", dialErr.Error()))
+		return
+	}
+
+	// secondary is set to nil on error, but the connection should be closed anyway
+	secondaryNC := secondary.nc
+	defer secondaryNC.Close() //nolint:errcheck // we are closing it anyway
+
+	if err := p.login(ctx, secondaryNC, l); err != nil {
+		l.DebugContext(ctx, "Failed to log in to secondary", slog.String("error", err.Error()))
+
+		_ = secondaryNC.Close()
+		secondary = nil
+	}
+
+	// unblock reads on all sides
+	stop := context.AfterFunc(ctx, func() {
+		_ = client.Close()
+		_ = primary.nc.Close()
+		_ = secondaryNC.Close()
+	})
+	defer stop()
+
+	l.DebugContext(ctx, "Connection accepted")
+
+	r := bufio.NewReader(client)
+	w := bufio.NewWriter(client)
+
+	for {
+		header, body, err := wire.ReadMessage(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, wire.ErrZeroRead), ctx.Err() != nil:
+				l.DebugContext(ctx, "Connection closed")
+			default:
+				l.DebugContext(ctx, "Failed to read message", slog.String("error", err.Error()))
+			}
+
+			return
+		}
+
+		msg, _ := body.(*wire.OpMsg)
+
+		var secondaryDone chan *wire.OpMsg
+		var secondaryErr error
+
+		if msg != nil && secondary != nil && !primaryOnly(msg) {
+			secondaryDone = make(chan *wire.OpMsg, 1)
+
+			go func() {
+				var res *wire.OpMsg
+				var secondaryHeader *wire.MsgHeader
+				var secondaryBody *wire.OpMsg
+
+				secondaryHeader, secondaryBody, secondaryErr = secondaryRequest(header, msg)
+				if secondaryErr == nil {
+					secondaryErr = secondary.write(secondaryHeader, secondaryBody)
+				}
+
+				if secondaryErr == nil {
+					secondaryErr = secondary.responses(secondaryBody, func(_ *wire.MsgHeader, body wire.MsgBody) error {
+						if res == nil {
+							res, _ = body.(*wire.OpMsg)
+						}
+
+						return nil
+					})
+				}
+
+				secondaryDone <- res
+			}()
+		}
+
+		var primaryRes *wire.OpMsg
+
+		if err = primary.write(header, body); err == nil {
+			err = primary.responses(body, func(header *wire.MsgHeader, body wire.MsgBody) error {
+				if primaryRes == nil {
+					primaryRes, _ = body.(*wire.OpMsg)
+				}
+
+				if werr := wire.WriteMessage(w, header, body); werr != nil {
+					return lazyerrors.Error(werr)
+				}
+
+				return w.Flush()
+			})
+		}
+
+		if err != nil {
+			if ctx.Err() == nil {
+				l.DebugContext(ctx, "Failed to proxy message to primary", slog.String("error", err.Error()))
+			}
+
+			return
+		}
+
+		if secondaryDone == nil {
+			continue
+		}
+
+		secondaryRes := <-secondaryDone
+
+		if secondaryErr != nil {
+			l.DebugContext(ctx, "Failed to proxy message to secondary", slog.String("error", secondaryErr.Error()))
+
+			_ = secondary.nc.Close()
+			secondary = nil
+		}
+
+		if primaryRes == nil {
+			// moreToCome request
+			continue
+		}
+
+		rec, err := p.compare(msg, primaryRes, secondaryRes, secondaryErr)
+		if err != nil {
+			l.DebugContext(ctx, "Failed to compare responses", slog.String("error", err.Error()))
+			continue
+		}
+
+		if rec == nil {
+			continue
+		}
+
+		rec.ConnID = id
+
+		if err = p.write(rec); err != nil {
+			l.DebugContext(ctx, "Failed to write record", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// login authenticates the secondary connection with [DiffOpts.SecondaryCredentials], if set.
+func (p *DiffProxy) login(ctx context.Context, nc net.Conn, l *slog.Logger) error {
+	if p.opts.SecondaryCredentials == nil {
+		return nil
+	}
+
+	authSource := p.opts.SecondaryAuthSource
+	if authSource == "" {
+		authSource = "admin"
+	}
+
+	// the connection is not closed; it is used by the upstream after login
+	conn := wireclient.New(nc, l)
+
+	if err := conn.Login(ctx, p.opts.SecondaryCredentials, authSource, p.opts.SecondaryAuthMechanism); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// primaryOnly returns true if the request should be sent only to the primary.
+func primaryOnly(msg *wire.OpMsg) bool {
+	doc, err := msg.Section0()
+	if err != nil {
+		return true
+	}
+
+	return slices.Contains(primaryOnlyCommands, doc.Command())
+}
+
+// secondaryRequest returns the request for the secondary without [sessionFields].
+// The original request is returned if there are no such fields.
+func secondaryRequest(header *wire.MsgHeader, msg *wire.OpMsg) (*wire.MsgHeader, *wire.OpMsg, error) {
+	doc, err := msg.Section0()
+	if err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+
+	res := wirebson.MakeDocument(doc.Len())
+
+	for k, v := range doc.All() {
+		if !slices.Contains(sessionFields, k) {
+			must.NoError(res.Add(k, v))
+		}
+	}
+
+	if res.Len() == doc.Len() {
+		return header, msg, nil
+	}
+
+	body, err := wire.NewOpMsg(res)
+	if err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+
+	body.Flags = msg.Flags
+
+	for identifier, docs := range msg.Sequences() {
+		seq := make([]wirebson.AnyDocument, len(docs))
+		for i, d := range docs {
+			seq[i] = d
+		}
+
+		if err = body.AddSequence(identifier, seq); err != nil {
+			return nil, nil, lazyerrors.Error(err)
+		}
+	}
+
+	h := *header
+	h.MessageLength = int32(wire.MsgHeaderLen + body.Size())
+
+	return &h, body, nil
+}
+
+// compare compares primary and secondary responses to the given request.
+// It returns nil record if there is no difference.
+func (p *DiffProxy) compare(req, primaryRes, secondaryRes *wire.OpMsg, secondaryErr error) (*DiffRecord, error) {
+	reqDoc, err := req.Section0Raw().DecodeDeep()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	primaryDoc, err := primaryRes.Section0Raw().DecodeDeep()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	rec := &DiffRecord{
+		Time:    time.Now(),
+		Request: reqDoc,
+		Primary: primaryDoc,
+		Command: reqDoc.Command(),
+	}
+
+	switch {
+	case secondaryErr != nil:
+		rec.Error = secondaryErr.Error()
+		return rec, nil
+
+	case secondaryRes == nil:
+		rec.Error = "secondary response is not OP_MSG"
+		return rec, nil
+	}
+
+	if rec.Secondary, err = secondaryRes.Section0Raw().DecodeDeep(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if rec.Diff, err = bsondiff.Diff(p.strip(rec.Primary), p.strip(rec.Secondary)); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if rec.Diff == "" {
+		return nil, nil
+	}
+
+	return rec, nil
+}
+
+// strip returns a shallow copy of the document without ignored fields.
+func (p *DiffProxy) strip(doc *wirebson.Document) *wirebson.Document {
+	if len(p.opts.IgnoreFields) == 0 {
+		return doc
+	}
+
+	res := wirebson.MakeDocument(doc.Len())
+
+	for k, v := range doc.All() {
+		if !slices.Contains(p.opts.IgnoreFields, k) {
+			must.NoError(res.Add(k, v))
+		}
+	}
+
+	return res
+}
+
+// write writes a single record to the output.
+func (p *DiffProxy) write(rec *DiffRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	b = append(b, '\n')
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if _, err = p.opts.Output.Write(b); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
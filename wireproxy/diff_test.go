@@ -0,0 +1,331 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// chanWriter sends each written slice to the channel.
+type chanWriter chan []byte
+
+// Write implements [io.Writer].
+func (w chanWriter) Write(b []byte) (int, error) {
+	w <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func TestDiffProxy(t *testing.T) {
+	t.Parallel()
+
+	primary := setupServer(t, func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("n", int32(1), "server", "primary", "ok", float64(1)), nil
+	})
+
+	secondary := setupServer(t, func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		doc, err := req.Document()
+		require.NoError(t, err)
+
+		n := int32(1)
+		if doc.Command() == "different" {
+			n = 2
+		}
+
+		return wire.MustOpMsg("n", n, "server", "secondary", "ok", float64(1)), nil
+	})
+
+	out := make(chanWriter, 10)
+
+	p, err := NewDiff(&DiffOpts{
+		Output:       out,
+		Primary:      primary,
+		Secondary:    secondary,
+		IgnoreFields: []string{"server"},
+	})
+	require.NoError(t, err)
+
+	l := listen(t)
+	serve(t, func(ctx context.Context) error { return p.Serve(ctx, l) })
+
+	conn := dial(t, l.Addr().String())
+
+	for _, cmd := range []string{"same", "different", "same"} {
+		_, body, rerr := conn.Request(t.Context(), wire.MustOpMsg(cmd, int32(1), "$db", "admin"))
+		require.NoError(t, rerr)
+
+		doc, derr := body.(*wire.OpMsg).Document()
+		require.NoError(t, derr)
+		assert.Equal(t, "primary", doc.Get("server"), "client should receive primary's response")
+	}
+
+	var line []byte
+
+	select {
+	case line = <-out:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no diff record")
+	}
+
+	var rec DiffRecord
+	require.NoError(t, json.Unmarshal(line, &rec))
+
+	assert.Equal(t, "different", rec.Command)
+	assert.Equal(t, int64(1), rec.ConnID)
+	assert.Empty(t, rec.Error)
+	assert.Equal(t, wirebson.MustDocument("different", int32(1), "$db", "admin"), rec.Request)
+	assert.Equal(t, wirebson.MustDocument("n", int32(1), "server", "primary", "ok", float64(1)), rec.Primary)
+	assert.Equal(t, wirebson.MustDocument("n", int32(2), "server", "secondary", "ok", float64(1)), rec.Secondary)
+
+	expected := "--- expected\n+++ actual\n@@ -1,3 +1,3 @@\n {\n-  `n`: 1,\n+  `n`: 2,\n   `ok`: 1.0,\n"
+	assert.Equal(t, expected, rec.Diff)
+
+	select {
+	case line = <-out:
+		t.Fatalf("unexpected diff record: %s", line)
+	default:
+	}
+}
+
+func TestDiffProxySecondaryError(t *testing.T) {
+	t.Parallel()
+
+	primary := setupServer(t, func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	// secondary closes the connection after reading the request
+	sl := listen(t)
+
+	go func() {
+		nc, err := sl.Accept()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, _, err = wire.ReadMessage(bufio.NewReader(nc))
+		assert.NoError(t, err)
+		assert.NoError(t, nc.Close())
+	}()
+
+	t.Cleanup(func() { _ = sl.Close() })
+
+	out := make(chanWriter, 10)
+
+	p, err := NewDiff(&DiffOpts{
+		Output:    out,
+		Primary:   primary,
+		Secondary: sl.Addr().String(),
+	})
+	require.NoError(t, err)
+
+	l := listen(t)
+	serve(t, func(ctx context.Context) error { return p.Serve(ctx, l) })
+
+	conn := dial(t, l.Addr().String())
+
+	// the client connection is not closed, and subsequent requests are not compared
+	for range 2 {
+		_, _, err = conn.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+		require.NoError(t, err)
+	}
+
+	var rec DiffRecord
+	require.NoError(t, json.Unmarshal(<-out, &rec))
+
+	assert.Equal(t, "ping", rec.Command)
+	assert.NotEmpty(t, rec.Error)
+	assert.Nil(t, rec.Secondary)
+	assert.Empty(t, out)
+}
+
+func TestDiffProxyAuth(t *testing.T) {
+	t.Parallel()
+
+	primary := setupServer(t, func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	reqs := make(chan *wirebson.Document, 10)
+
+	secondary := setupServer(t, func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		doc, err := req.DocumentDeep()
+		require.NoError(t, err)
+
+		reqs <- doc
+
+		if doc.Command() == "different" {
+			return wire.MustOpMsg("n", int32(2), "ok", float64(1)), nil
+		}
+
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	out := make(chanWriter, 10)
+
+	p, err := NewDiff(&DiffOpts{
+		Output:                 out,
+		Primary:                primary,
+		Secondary:              secondary,
+		SecondaryCredentials:   url.UserPassword("user", "pass"),
+		SecondaryAuthMechanism: "PLAIN",
+	})
+	require.NoError(t, err)
+
+	l := listen(t)
+	serve(t, func(ctx context.Context) error { return p.Serve(ctx, l) })
+
+	conn := dial(t, l.Addr().String())
+
+	for _, cmd := range []string{"hello", "saslStart", "saslContinue", "different"} {
+		_, _, err = conn.Request(t.Context(), wire.MustOpMsg(cmd, int32(1), "$db", "admin"))
+		require.NoError(t, err)
+	}
+
+	var rec DiffRecord
+	require.NoError(t, json.Unmarshal(<-out, &rec))
+	assert.Equal(t, "different", rec.Command, "handshake and authentication commands should not be compared")
+
+	doc := <-reqs
+	assert.Equal(t, "saslStart", doc.Command())
+	assert.Equal(t, "PLAIN", doc.Get("mechanism"))
+	assert.Equal(t, wirebson.Binary{B: []byte("\x00user\x00pass")}, doc.Get("payload"))
+
+	assert.Equal(t, "listDatabases", (<-reqs).Command())
+	assert.Equal(t, "different", (<-reqs).Command())
+	assert.Empty(t, reqs)
+}
+
+func TestDiffProxySessionFields(t *testing.T) {
+	t.Parallel()
+
+	primary := setupServer(t, func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	reqs := make(chan *wire.OpMsg, 10)
+
+	secondary := setupServer(t, func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		reqs <- req
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	out := make(chanWriter, 10)
+
+	p, err := NewDiff(&DiffOpts{
+		Output:    out,
+		Primary:   primary,
+		Secondary: secondary,
+	})
+	require.NoError(t, err)
+
+	l := listen(t)
+	serve(t, func(ctx context.Context) error { return p.Serve(ctx, l) })
+
+	conn := dial(t, l.Addr().String())
+
+	lsid := wirebson.MustDocument("id", wirebson.Binary{B: make([]byte, 16), Subtype: wirebson.BinaryUUID})
+	clusterTime := wirebson.MustDocument("clusterTime", wirebson.NewTimestamp(1, 1))
+
+	insert := wire.MustOpMsg(
+		"insert", "test",
+		"lsid", lsid,
+		"txnNumber", int64(1),
+		"startTransaction", true,
+		"autocommit", false,
+		"$clusterTime", clusterTime,
+		"$db", "test",
+	)
+	require.NoError(t, insert.AddSequence("documents", []wirebson.AnyDocument{wirebson.MustDocument("_id", int32(1))}))
+
+	for _, msg := range []*wire.OpMsg{
+		insert,
+		wire.MustOpMsg("getMore", int64(42), "collection", "test", "lsid", lsid, "$db", "test"),
+		wire.MustOpMsg("commitTransaction", int32(1), "lsid", lsid, "txnNumber", int64(1), "$db", "admin"),
+		wire.MustOpMsg("find", "test", "$db", "test"),
+	} {
+		_, _, err = conn.Request(t.Context(), msg)
+		require.NoError(t, err)
+	}
+
+	req := <-reqs
+	doc, err := req.Section0()
+	require.NoError(t, err)
+	assert.Equal(t, wirebson.MustDocument("insert", "test", "$db", "test"), doc)
+	assert.Len(t, req.Sequence("documents"), 1)
+
+	doc, err = (<-reqs).Section0()
+	require.NoError(t, err)
+	assert.Equal(t, "find", doc.Command())
+
+	assert.Empty(t, reqs, "getMore and commitTransaction should not be sent to the secondary")
+	assert.Empty(t, out)
+}
+
+func TestDiffProxyAcceptError(t *testing.T) {
+	t.Parallel()
+
+	upstream := setupUpstream(t)
+
+	p, err := NewDiff(&DiffOpts{
+		Output:    make(chanWriter, 10),
+		Primary:   upstream,
+		Secondary: upstream,
+	})
+	require.NoError(t, err)
+
+	l := &failingListener{Listener: listen(t), fail: make(chan struct{})}
+	done := make(chan error)
+
+	go func() {
+		done <- p.Serve(t.Context(), l)
+	}()
+
+	conn := dial(t, l.Addr().String())
+
+	_, _, err = conn.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	require.NoError(t, err)
+
+	close(l.fail)
+
+	// Serve returns without waiting for the client to disconnect
+	require.ErrorContains(t, <-done, "accept failed")
+
+	_, _, err = conn.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	require.Error(t, err)
+}
+
+func TestNewDiff(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewDiff(nil)
+	assert.Error(t, err)
+
+	_, err = NewDiff(&DiffOpts{Primary: "127.0.0.1:27017"})
+	assert.Error(t, err)
+
+	_, err = NewDiff(&DiffOpts{Primary: "127.0.0.1:27017", Secondary: "127.0.0.1:27018"})
+	assert.Error(t, err)
+}
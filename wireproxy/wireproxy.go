@@ -0,0 +1,374 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wireproxy provides wire protocol proxy with inspection hooks.
+//
+// Each client connection is forwarded to a separate upstream connection.
+// Messages are parsed in both directions, so OP_COMPRESSED messages are forwarded decompressed.
+package wireproxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+)
+
+// Hook is called for each message passing through the proxy.
+//
+// It may observe the message, or return a different body to forward instead;
+// header's MessageLength and OpCode are updated automatically,
+// so the returned body could have a different type (for example, OP_MSG instead of OP_QUERY).
+// If it returns nil body without error, the message is not forwarded.
+// If it returns an error, both client and upstream connections are closed.
+//
+// Hooks are called concurrently for different connections and directions.
+type Hook func(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (wire.MsgBody, error)
+
+// Opts represents [Proxy] options.
+type Opts struct {
+	// DialContext is used to connect to the upstream server.
+	// If nil, [net.Dialer.DialContext] is used.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// OnRequest is called for messages from the client, if set.
+	OnRequest Hook
+
+	// OnResponse is called for messages from the upstream, if set.
+	OnResponse Hook
+
+	// Logger is used only for debug-level messages; if nil, nothing is logged.
+	Logger *slog.Logger
+
+	// Upstream is the TCP address of the upstream server.
+	Upstream string
+
+	// RewriteIDs makes proxy use its own request IDs for requests sent to the upstream,
+	// and restore original IDs in ResponseTo fields of responses.
+	// It is useful when hooks inject messages or when IDs from different clients should be unique.
+	RewriteIDs bool
+}
+
+// Proxy forwards wire protocol messages between clients and an upstream server.
+type Proxy struct {
+	opts          *Opts
+	l             *slog.Logger
+	lastConnID    atomic.Int64
+	lastRequestID atomic.Int32
+}
+
+// New creates a new proxy.
+func New(opts *Opts) (*Proxy, error) {
+	if opts == nil || opts.Upstream == "" {
+		return nil, lazyerrors.New("upstream is not set")
+	}
+
+	o := *opts
+
+	if o.DialContext == nil {
+		var d net.Dialer
+		o.DialContext = d.DialContext
+	}
+
+	l := o.Logger
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+
+	return &Proxy{
+		opts: &o,
+		l:    l,
+	}, nil
+}
+
+// ConnInfo represents proxied connection information.
+type ConnInfo struct {
+	ClientAddr   net.Addr
+	UpstreamAddr net.Addr
+	ID           int64 // unique for the proxy, starting from 1
+}
+
+// connInfoKey is the context key for *ConnInfo.
+type connInfoKey struct{}
+
+// ConnInfoFromContext returns proxied connection information from the context passed to [Hook].
+// It returns nil if there is none.
+func ConnInfoFromContext(ctx context.Context) *ConnInfo {
+	ci, _ := ctx.Value(connInfoKey{}).(*ConnInfo)
+	return ci
+}
+
+// ListenAndServe listens on the TCP network address and calls [Proxy.Serve].
+func (p *Proxy) ListenAndServe(ctx context.Context, addr string) error {
+	var lc net.ListenConfig
+
+	l, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return p.Serve(ctx, l)
+}
+
+// Serve accepts client connections on the given listener and proxies them in separate goroutines
+// until ctx is canceled or the listener fails.
+// The listener is closed on return.
+//
+// When ctx is canceled or the listener fails, all connections are closed.
+// Serve waits for all connection goroutines to exit and returns nil or the listener error.
+func (p *Proxy) Serve(ctx context.Context, l net.Listener) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = l.Close()
+	})
+	defer stop()
+
+	defer l.Close() //nolint:errcheck // listener could be already closed
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// close connections before waiting for them, even if the listener fails
+	connCtx, connCancel := context.WithCancel(ctx)
+	defer connCancel()
+
+	p.l.DebugContext(ctx, "Listening", slog.String("addr", l.Addr().String()), slog.String("upstream", p.opts.Upstream))
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				p.l.DebugContext(ctx, "Stopped listening", slog.String("addr", l.Addr().String()))
+				return nil
+			}
+
+			return lazyerrors.Error(err)
+		}
+
+		ci := &ConnInfo{
+			ClientAddr: nc.RemoteAddr(),
+			ID:         p.lastConnID.Add(1),
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			p.serveConn(connCtx, nc, ci)
+		}()
+	}
+}
+
+// serveConn proxies a single client connection until either side closes it, an error happens, or ctx is canceled.
+func (p *Proxy) serveConn(ctx context.Context, client net.Conn, ci *ConnInfo) {
+	l := p.l.With(slog.Int64("conn", ci.ID), slog.String("client", ci.ClientAddr.String()))
+
+	defer client.Close() //nolint:errcheck // we are closing it anyway
+
+	upstream, err := p.opts.DialContext(ctx, "tcp", p.opts.Upstream)
+	if err != nil {
+		l.DebugContext(ctx, "Failed to connect to upstream", slog.String("error", err.Error()))
+		return
+	}
+
+	defer upstream.Close() //nolint:errcheck // we are closing it anyway
+
+	ci.UpstreamAddr = upstream.RemoteAddr()
+
+	connCtx, cancel := context.WithCancel(context.WithValue(ctx, connInfoKey{}, ci))
+	defer cancel()
+
+	// unblock reads on both sides
+	stop := context.AfterFunc(connCtx, func() {
+		_ = client.Close()
+		_ = upstream.Close()
+	})
+	defer stop()
+
+	l.DebugContext(ctx, "Connection accepted", slog.String("upstream", ci.UpstreamAddr.String()))
+
+	var ids *idMap
+	if p.opts.RewriteIDs {
+		ids = &idMap{
+			ids:  map[int32]int32{},
+			last: &p.lastRequestID,
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		defer cancel()
+
+		p.forward(connCtx, l.With(slog.String("dir", "request")), client, upstream, p.opts.OnRequest, ids.request)
+	}()
+
+	go func() {
+		defer wg.Done()
+		defer cancel()
+
+		p.forward(connCtx, l.With(slog.String("dir", "response")), upstream, client, p.opts.OnResponse, ids.response)
+	}()
+
+	wg.Wait()
+
+	l.DebugContext(ctx, "Connection closed")
+}
+
+// forward reads messages from src, calls the hook, and writes messages to dst
+// until an error happens.
+func (p *Proxy) forward(ctx context.Context, l *slog.Logger, src, dst net.Conn, hook Hook, rewrite func(*wire.MsgHeader, wire.MsgBody)) {
+	r := bufio.NewReader(src)
+	w := bufio.NewWriter(dst)
+
+	for {
+		header, body, err := wire.ReadMessage(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, wire.ErrZeroRead), ctx.Err() != nil:
+				// connection closed
+			default:
+				l.DebugContext(ctx, "Failed to read message", slog.String("error", err.Error()))
+			}
+
+			return
+		}
+
+		if hook != nil {
+			if body, err = hook(ctx, header, body); err != nil {
+				l.DebugContext(ctx, "Hook failed", slog.String("error", err.Error()))
+				return
+			}
+
+			if body == nil {
+				l.DebugContext(ctx, "Message dropped by hook", slog.Any("header", header))
+				continue
+			}
+		}
+
+		var ok bool
+		if header.OpCode, ok = opCode(body); !ok {
+			l.DebugContext(ctx, "Unsupported message body type", slog.String("type", fmt.Sprintf("%T", body)))
+			return
+		}
+
+		header.MessageLength = int32(body.Size() + wire.MsgHeaderLen)
+		rewrite(header, body)
+
+		if err = wire.WriteMessage(w, header, body); err == nil {
+			err = w.Flush()
+		}
+
+		if err != nil {
+			if ctx.Err() == nil {
+				l.DebugContext(ctx, "Failed to write message", slog.String("error", err.Error()))
+			}
+
+			return
+		}
+	}
+}
+
+// opCode returns the opcode for the given message body type.
+func opCode(body wire.MsgBody) (wire.OpCode, bool) {
+	switch body.(type) {
+	case *wire.OpReply:
+		return wire.OpCodeReply, true
+	case *wire.OpUpdate:
+		return wire.OpCodeUpdate, true
+	case *wire.OpInsert:
+		return wire.OpCodeInsert, true
+	case *wire.OpQuery:
+		return wire.OpCodeQuery, true
+	case *wire.OpGetMore:
+		return wire.OpCodeGetMore, true
+	case *wire.OpDelete:
+		return wire.OpCodeDelete, true
+	case *wire.OpKillCursors:
+		return wire.OpCodeKillCursors, true
+	case *wire.OpCompressed:
+		return wire.OpCodeCompressed, true
+	case *wire.OpMsg:
+		return wire.OpCodeMsg, true
+	default:
+		return 0, false
+	}
+}
+
+// idMap maps proxy's request IDs to the client's request IDs for a single connection.
+//
+// Methods do nothing if map is nil.
+type idMap struct {
+	last *atomic.Int32
+	ids  map[int32]int32
+	m    sync.Mutex
+}
+
+// request replaces request ID with the proxy's one.
+func (m *idMap) request(header *wire.MsgHeader, body wire.MsgBody) {
+	if m == nil {
+		return
+	}
+
+	orig := header.RequestID
+	header.RequestID = m.last.Add(1)
+
+	if !expectsResponse(body) {
+		return
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	m.ids[header.RequestID] = orig
+}
+
+// response restores the client's request ID in ResponseTo field.
+//
+// Responses that are not mapped (for example, subsequent exhaust replies that
+// reference the previous reply's request ID) are left as is.
+func (m *idMap) response(header *wire.MsgHeader, _ wire.MsgBody) {
+	if m == nil {
+		return
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if orig, ok := m.ids[header.ResponseTo]; ok {
+		delete(m.ids, header.ResponseTo)
+		header.ResponseTo = orig
+	}
+}
+
+// expectsResponse returns true if the server replies to the given request.
+func expectsResponse(body wire.MsgBody) bool {
+	switch body := body.(type) {
+	case *wire.OpMsg:
+		return !body.Flags.FlagSet(wire.OpMsgMoreToCome)
+	case *wire.OpQuery, *wire.OpGetMore:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireproxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/must"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireclient"
+	"github.com/FerretDB/wire/wireserver"
+)
+
+// listen returns a new local TCP listener.
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	return l
+}
+
+// serve runs f until the test ends.
+func serve(t *testing.T, f func(ctx context.Context) error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- f(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+}
+
+// failingListener is a listener that fails to accept after the first connection
+// when fail channel is closed.
+type failingListener struct {
+	net.Listener
+	fail     chan struct{}
+	accepted bool
+}
+
+// Accept implements [net.Listener].
+func (l *failingListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return l.Listener.Accept()
+	}
+
+	<-l.fail
+
+	return nil, errors.New("accept failed")
+}
+
+// setupServer starts wireserver with the given handler and returns its address.
+func setupServer(t *testing.T, h wireserver.HandlerFunc) string {
+	t.Helper()
+
+	l := listen(t)
+	s := wireserver.New(&wireserver.ServerOpts{Handler: h})
+
+	serve(t, func(ctx context.Context) error { return s.Serve(ctx, l) })
+
+	return l.Addr().String()
+}
+
+// setupUpstream starts wireserver with echo handler and returns its address.
+func setupUpstream(t *testing.T) string {
+	t.Helper()
+
+	return setupServer(t, func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		doc, err := req.DocumentDeep()
+		require.NoError(t, err)
+
+		return wire.MustOpMsg("echo", doc, "ok", float64(1)), nil
+	})
+}
+
+// setupProxy starts the proxy and returns its address.
+func setupProxy(t *testing.T, opts *Opts) string {
+	t.Helper()
+
+	p, err := New(opts)
+	require.NoError(t, err)
+
+	l := listen(t)
+
+	serve(t, func(ctx context.Context) error { return p.Serve(ctx, l) })
+
+	return l.Addr().String()
+}
+
+// dial connects to the given address.
+func dial(t *testing.T, addr string) *wireclient.Conn {
+	t.Helper()
+
+	nc, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+
+	conn := wireclient.New(nc, slog.New(slog.DiscardHandler))
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+
+	upstream := setupUpstream(t)
+
+	var m sync.Mutex
+	var requests, responses []string
+
+	addr := setupProxy(t, &Opts{
+		Upstream: upstream,
+		OnRequest: func(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (wire.MsgBody, error) {
+			assert.NotNil(t, ConnInfoFromContext(ctx))
+
+			doc, err := body.(*wire.OpMsg).Document()
+			require.NoError(t, err)
+
+			m.Lock()
+			requests = append(requests, doc.Command())
+			m.Unlock()
+
+			if doc.Command() != "rename" {
+				return body, nil
+			}
+
+			return wire.MustOpMsg("renamed", int32(1), "$db", "admin"), nil
+		},
+		OnResponse: func(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (wire.MsgBody, error) {
+			doc, err := body.(*wire.OpMsg).DocumentDeep()
+			require.NoError(t, err)
+
+			m.Lock()
+			responses = append(responses, doc.Get("echo").(*wirebson.Document).Command())
+			m.Unlock()
+
+			return body, nil
+		},
+	})
+
+	conn := dial(t, addr)
+
+	_, body, err := conn.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	require.NoError(t, err)
+
+	doc, err := body.(*wire.OpMsg).DocumentDeep()
+	require.NoError(t, err)
+	assert.Equal(t, wirebson.MustDocument("ping", int32(1), "$db", "admin"), doc.Get("echo"))
+
+	// the request is modified by the hook, so the message length changes
+	_, body, err = conn.Request(t.Context(), wire.MustOpMsg("rename", int32(1), "$db", "admin"))
+	require.NoError(t, err)
+
+	doc, err = body.(*wire.OpMsg).DocumentDeep()
+	require.NoError(t, err)
+	assert.Equal(t, wirebson.MustDocument("renamed", int32(1), "$db", "admin"), doc.Get("echo"))
+
+	m.Lock()
+	defer m.Unlock()
+
+	assert.Equal(t, []string{"ping", "rename"}, requests)
+	assert.Equal(t, []string{"ping", "renamed"}, responses)
+}
+
+func TestProxyRewriteIDs(t *testing.T) {
+	t.Parallel()
+
+	// upstream that records request IDs
+	ids := make(chan int32, 1)
+	l := listen(t)
+
+	go func() {
+		nc, err := l.Accept()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		defer nc.Close() //nolint:errcheck // test
+
+		r := bufio.NewReader(nc)
+		w := bufio.NewWriter(nc)
+
+		header, _, err := wire.ReadMessage(r)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		ids <- header.RequestID
+
+		res := wire.MustOpMsg("ok", float64(1))
+		resHeader := &wire.MsgHeader{
+			MessageLength: int32(res.Size() + wire.MsgHeaderLen),
+			RequestID:     1000,
+			ResponseTo:    header.RequestID,
+			OpCode:        wire.OpCodeMsg,
+		}
+
+		assert.NoError(t, wire.WriteMessage(w, resHeader, res))
+		assert.NoError(t, w.Flush())
+	}()
+
+	t.Cleanup(func() { _ = l.Close() })
+
+	addr := setupProxy(t, &Opts{
+		Upstream:   l.Addr().String(),
+		RewriteIDs: true,
+	})
+
+	conn := dial(t, addr)
+
+	req := wire.MustOpMsg("ping", int32(1), "$db", "admin")
+	header := &wire.MsgHeader{
+		MessageLength: int32(req.Size() + wire.MsgHeaderLen),
+		RequestID:     12345,
+		OpCode:        wire.OpCodeMsg,
+	}
+
+	require.NoError(t, conn.Write(t.Context(), header, req))
+
+	resHeader, _, err := conn.Read(t.Context())
+	require.NoError(t, err)
+
+	assert.NotEqual(t, int32(12345), <-ids)
+	assert.Equal(t, int32(12345), resHeader.ResponseTo)
+	assert.Equal(t, int32(1000), resHeader.RequestID)
+}
+
+func TestProxyConvertQuery(t *testing.T) {
+	t.Parallel()
+
+	addr := setupProxy(t, &Opts{
+		Upstream: setupUpstream(t),
+		OnRequest: func(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (wire.MsgBody, error) {
+			query, ok := body.(*wire.OpQuery)
+			if !ok {
+				return body, nil
+			}
+
+			doc, err := query.Query()
+			if err != nil {
+				return nil, err
+			}
+
+			must.NoError(doc.Add("$db", "admin"))
+
+			return wire.NewOpMsg(doc)
+		},
+	})
+
+	conn := dial(t, addr)
+
+	query := wire.MustOpQuery("ping", int32(1))
+	query.FullCollectionName = "admin.$cmd"
+
+	resHeader, body, err := conn.Request(t.Context(), query)
+	require.NoError(t, err)
+	assert.Equal(t, wire.OpCodeMsg, resHeader.OpCode)
+
+	doc, err := body.(*wire.OpMsg).DocumentDeep()
+	require.NoError(t, err)
+	assert.Equal(t, wirebson.MustDocument("ping", int32(1), "$db", "admin"), doc.Get("echo"))
+}
+
+func TestProxyAcceptError(t *testing.T) {
+	t.Parallel()
+
+	p, err := New(&Opts{Upstream: setupUpstream(t)})
+	require.NoError(t, err)
+
+	l := &failingListener{Listener: listen(t), fail: make(chan struct{})}
+	done := make(chan error)
+
+	go func() {
+		done <- p.Serve(t.Context(), l)
+	}()
+
+	conn := dial(t, l.Addr().String())
+
+	_, _, err = conn.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	require.NoError(t, err)
+
+	close(l.fail)
+
+	// Serve returns without waiting for the client to disconnect
+	require.ErrorContains(t, <-done, "accept failed")
+
+	_, _, err = conn.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	require.Error(t, err)
+}
+
+func TestProxyNoUpstream(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(&Opts{})
+	require.Error(t, err)
+}
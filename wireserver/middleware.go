@@ -0,0 +1,213 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/FerretDB/wire"
+)
+
+// CodeMaxTimeMSExpired is the error code returned by [Timeout] middleware.
+const CodeMaxTimeMSExpired = int32(50) // MaxTimeMSExpired
+
+// Middleware wraps a handler to add behavior before and/or after it.
+type Middleware func(Handler) Handler
+
+// Chain returns a middleware that applies all given middlewares.
+// The first middleware is the outermost one: it sees the request first and the response last.
+func Chain(mws ...Middleware) Middleware {
+	return func(h Handler) Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+
+		return h
+	}
+}
+
+// Logging returns a middleware that logs requests, responses, errors, and durations
+// with the given logger at debug level.
+func Logging(l *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+			cmd, _ := command(req)
+
+			attrs := []any{slog.String("command", cmd)}
+			if ci := ConnInfoFromContext(ctx); ci != nil {
+				attrs = append(attrs, slog.Int64("conn", ci.ID))
+			}
+
+			logger := l.With(attrs...)
+
+			if logger.Enabled(ctx, slog.LevelDebug) {
+				logger.DebugContext(ctx, "Request:\n"+req.StringIndent())
+			}
+
+			start := time.Now()
+			res, err := next.Handle(ctx, req)
+			d := slog.Duration("duration", time.Since(start))
+
+			switch {
+			case err != nil:
+				logger.DebugContext(ctx, "Error", slog.String("error", err.Error()), d)
+			case logger.Enabled(ctx, slog.LevelDebug):
+				logger.DebugContext(ctx, "Response:\n"+res.StringIndent(), d)
+			}
+
+			return res, err
+		})
+	}
+}
+
+// Recover returns a middleware that recovers from handler panics.
+//
+// Panic is converted to InternalError [*Error], which [Server] sends as `{ok: 0, errmsg, code, codeName}` reply.
+// If logger is not nil, the panic value and the stack trace are logged at error level.
+func Recover(l *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (res *wire.OpMsg, err error) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+
+				if l != nil {
+					l.ErrorContext(ctx, "Handler panicked", slog.Any("panic", p), slog.String("stack", string(debug.Stack())))
+				}
+
+				res = nil
+				err = panicError(p)
+			}()
+
+			return next.Handle(ctx, req)
+		})
+	}
+}
+
+// Timeout returns a middleware that limits handler execution time.
+//
+// When the timeout is reached, the handler's context is canceled,
+// and MaxTimeMSExpired [*Error] is returned without waiting for the handler.
+// The handler continues to run in the background until it returns;
+// its result is discarded.
+// If the parent context is canceled first, its error is returned unchanged.
+//
+// The handler runs in a separate goroutine, so [Recover] middleware outside Timeout can't recover its panics;
+// they are converted to InternalError [*Error] by Timeout itself.
+//
+// For per-command timeouts, wrap individual handlers before registering them in [Mux].
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(parent context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+			ctx, cancel := context.WithTimeout(parent, d)
+
+			type result struct {
+				res *wire.OpMsg
+				err error
+			}
+
+			done := make(chan result, 1)
+
+			go func() {
+				defer cancel()
+
+				defer func() {
+					if p := recover(); p != nil {
+						done <- result{err: panicError(p)}
+					}
+				}()
+
+				res, err := next.Handle(ctx, req)
+				done <- result{res: res, err: err}
+			}()
+
+			// the handler may return ctx.Err() as soon as the deadline is reached,
+			// so the context is checked for such results
+			expired := func() bool {
+				return errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil
+			}
+
+			timeoutErr := &Error{
+				Message: "operation exceeded time limit",
+				Name:    "MaxTimeMSExpired",
+				Code:    CodeMaxTimeMSExpired,
+			}
+
+			select {
+			case r := <-done:
+				if isContextErr(r.err) && expired() {
+					return nil, timeoutErr
+				}
+
+				return r.res, r.err
+
+			case <-ctx.Done():
+				if expired() {
+					return nil, timeoutErr
+				}
+
+				// the handler could finish at the same time
+				select {
+				case r := <-done:
+					return r.res, r.err
+				default:
+				}
+
+				return nil, parent.Err()
+			}
+		})
+	}
+}
+
+// panicError returns InternalError [*Error] for the given recovered panic value.
+func panicError(p any) *Error {
+	return &Error{
+		Message: fmt.Sprintf("panic: %v", p),
+		Name:    "InternalError",
+		Code:    CodeInternalError,
+	}
+}
+
+// isContextErr returns true if the given error is caused by context cancellation or deadline.
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// MetricsFunc is called by [Metrics] middleware after each handler call
+// with the command name, the handler duration, and the returned error (or nil).
+type MetricsFunc func(ctx context.Context, command string, d time.Duration, err error)
+
+// Metrics returns a middleware that calls f after each handler call.
+// It could be used to update counters and histograms of any metrics library.
+func Metrics(f MetricsFunc) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+			cmd, _ := command(req)
+
+			start := time.Now()
+			res, err := next.Handle(ctx, req)
+			f(ctx, cmd, time.Since(start), err)
+
+			return res, err
+		})
+	}
+}
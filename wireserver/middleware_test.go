@@ -0,0 +1,191 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	var calls []string
+
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+				calls = append(calls, name+" before")
+				res, err := next.Handle(ctx, req)
+				calls = append(calls, name+" after")
+
+				return res, err
+			})
+		}
+	}
+
+	h := HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		calls = append(calls, "handler")
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	_, err := Chain(mw("a"), mw("b"))(h).Handle(t.Context(), wire.MustOpMsg("ping", int32(1)))
+	require.NoError(t, err)
+
+	expected := []string{"a before", "b before", "handler", "b after", "a after"}
+	assert.Equal(t, expected, calls)
+}
+
+func TestLogging(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	h := Logging(l)(HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	}))
+
+	_, err := h.Handle(t.Context(), wire.MustOpMsg("ping", int32(1)))
+	require.NoError(t, err)
+
+	assert.Contains(t, buf.String(), "command=ping")
+	assert.Contains(t, buf.String(), "Request:")
+	assert.Contains(t, buf.String(), "Response:")
+}
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+
+	h := Recover(nil)(HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		panic("boom")
+	}))
+
+	res, err := h.Handle(t.Context(), wire.MustOpMsg("ping", int32(1)))
+	assert.Nil(t, res)
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, CodeInternalError, e.Code)
+
+	doc, err := ErrorReply(err).DocumentDeep()
+	require.NoError(t, err)
+
+	expected := wirebson.MustDocument(
+		"ok", float64(0),
+		"errmsg", "panic: boom",
+		"code", int32(1),
+		"codeName", "InternalError",
+	)
+	assert.Equal(t, expected, doc)
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	h := Timeout(10 * time.Millisecond)(HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		if doc, _ := req.Document(); doc.Command() == "fast" {
+			return wire.MustOpMsg("ok", float64(1)), nil
+		}
+
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	}))
+
+	res, err := h.Handle(t.Context(), wire.MustOpMsg("fast", int32(1)))
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+
+	res, err = h.Handle(t.Context(), wire.MustOpMsg("slow", int32(1)))
+	assert.Nil(t, res)
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, CodeMaxTimeMSExpired, e.Code)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	res, err = h.Handle(ctx, wire.MustOpMsg("slow", int32(1)))
+	assert.Nil(t, res)
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, errors.As(err, &e))
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	t.Parallel()
+
+	// Recover is outside Timeout, so it can't recover panics in the handler goroutine
+	h := Chain(Recover(nil), Timeout(time.Second))(HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		panic("boom")
+	}))
+
+	res, err := h.Handle(t.Context(), wire.MustOpMsg("ping", int32(1)))
+	assert.Nil(t, res)
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, CodeInternalError, e.Code)
+	assert.Equal(t, "panic: boom", e.Message)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	var m sync.Mutex
+	counts := map[string]int{}
+	var errs int
+
+	f := func(ctx context.Context, command string, d time.Duration, err error) {
+		m.Lock()
+		defer m.Unlock()
+
+		counts[command]++
+		if err != nil {
+			errs++
+		}
+	}
+
+	mux := NewMux()
+	mux.RegisterFunc("ping", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	addr := setup(t, Chain(Metrics(f), Recover(nil))(mux))
+	conn := dial(t, addr)
+
+	request(t, conn, wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	request(t, conn, wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	doc := request(t, conn, wire.MustOpMsg("unknown", int32(1), "$db", "admin"))
+	assert.Equal(t, CodeCommandNotFound, doc.Get("code"))
+
+	m.Lock()
+	defer m.Unlock()
+
+	assert.Equal(t, map[string]int{"ping": 2, "unknown": 1}, counts)
+	assert.Equal(t, 1, errs)
+}
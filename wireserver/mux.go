@@ -0,0 +1,96 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+)
+
+// Mux is a [Handler] that routes requests to other handlers by command name
+// (the first field name of the section 0 document, see [wirebson.Document.Command]).
+//
+// Unknown commands are handled by NotFound handler if set;
+// otherwise, CommandNotFound error is returned.
+//
+// It is safe for concurrent use.
+type Mux struct {
+	// NotFound handles unknown commands if set.
+	// It should be set before the first request.
+	NotFound Handler
+
+	handlers map[string]Handler
+	rw       sync.RWMutex
+}
+
+// NewMux creates a new empty Mux.
+func NewMux() *Mux {
+	return &Mux{
+		handlers: map[string]Handler{},
+	}
+}
+
+// Register registers the handler for the given command name.
+// It replaces the previously registered handler, if any.
+func (m *Mux) Register(command string, h Handler) {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	m.handlers[command] = h
+}
+
+// RegisterFunc registers the handler function for the given command name.
+func (m *Mux) RegisterFunc(command string, f func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error)) {
+	m.Register(command, HandlerFunc(f))
+}
+
+// Handler returns the handler for the given command name, or nil.
+func (m *Mux) Handler(command string) Handler {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+
+	return m.handlers[command]
+}
+
+// Handle implements [Handler].
+func (m *Mux) Handle(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+	cmd, err := command(req)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if h := m.Handler(cmd); h != nil {
+		return h.Handle(ctx, req)
+	}
+
+	if m.NotFound != nil {
+		return m.NotFound.Handle(ctx, req)
+	}
+
+	return nil, &Error{
+		Message: fmt.Sprintf("no such command: '%s'", cmd),
+		Name:    "CommandNotFound",
+		Code:    CodeCommandNotFound,
+	}
+}
+
+// check interfaces
+var (
+	_ Handler = (*Mux)(nil)
+)
@@ -0,0 +1,281 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+)
+
+// ServerOpts represents [Server] options.
+type ServerOpts struct {
+	// Handler handles all commands; usually, it is [*Mux].
+	Handler Handler
+
+	// Logger is used only for debug-level messages; if nil, nothing is logged.
+	Logger *slog.Logger
+}
+
+// Server accepts client connections and calls the handler for each command.
+//
+// It is safe for concurrent use.
+type Server struct {
+	h             Handler
+	l             *slog.Logger
+	lastConnID    atomic.Int64
+	lastRequestID atomic.Int32
+}
+
+// New creates a new server.
+func New(opts *ServerOpts) *Server {
+	l := opts.Logger
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+
+	return &Server{
+		h: opts.Handler,
+		l: l,
+	}
+}
+
+// ConnInfo represents client connection information.
+type ConnInfo struct {
+	RemoteAddr net.Addr
+	ID         int64 // unique for the server, starting from 1
+}
+
+// connInfoKey is the context key for *ConnInfo.
+type connInfoKey struct{}
+
+// ConnInfoFromContext returns client connection information from the context passed to [Handler].
+// It returns nil if there is none.
+func ConnInfoFromContext(ctx context.Context) *ConnInfo {
+	ci, _ := ctx.Value(connInfoKey{}).(*ConnInfo)
+	return ci
+}
+
+// ListenAndServe listens on the TCP network address and calls [Server.Serve].
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	var lc net.ListenConfig
+
+	l, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts connections on the given listener and serves them in separate goroutines
+// until ctx is canceled or the listener fails.
+// The listener is closed on return.
+//
+// When ctx is canceled or the listener fails, connections stop reading new requests
+// and are closed after writing responses for requests that are being handled.
+// Contexts passed to handlers are not canceled at that moment, so they could finish their work;
+// they are canceled when the connection is closed.
+// Serve waits for all connections to be closed and returns nil or the listener error.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = l.Close()
+	})
+	defer stop()
+
+	defer l.Close() //nolint:errcheck // listener could be already closed
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// stop connections before waiting for them, even if the listener fails
+	connCtx, connCancel := context.WithCancel(ctx)
+	defer connCancel()
+
+	s.l.DebugContext(ctx, "Listening", slog.String("addr", l.Addr().String()))
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				s.l.DebugContext(ctx, "Stopped listening", slog.String("addr", l.Addr().String()))
+				return nil
+			}
+
+			return lazyerrors.Error(err)
+		}
+
+		ci := &ConnInfo{
+			RemoteAddr: nc.RemoteAddr(),
+			ID:         s.lastConnID.Add(1),
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			s.serveConn(connCtx, nc, ci)
+		}()
+	}
+}
+
+// serveConn handles a single connection until it is closed by the client,
+// a protocol error happens, or ctx is canceled.
+func (s *Server) serveConn(ctx context.Context, nc net.Conn, ci *ConnInfo) {
+	l := s.l.With(slog.Int64("conn", ci.ID), slog.String("remote", ci.RemoteAddr.String()))
+
+	defer func() {
+		if err := nc.Close(); err != nil {
+			l.DebugContext(ctx, "Failed to close connection", slog.String("error", err.Error()))
+		}
+	}()
+
+	// interrupt blocked read, but let in-flight request finish
+	stop := context.AfterFunc(ctx, func() {
+		_ = nc.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	hCtx, hCancel := context.WithCancel(context.WithValue(context.WithoutCancel(ctx), connInfoKey{}, ci))
+	defer hCancel()
+
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+
+	l.DebugContext(ctx, "Connection accepted")
+
+	for {
+		if ctx.Err() != nil {
+			l.DebugContext(ctx, "Connection closed by server")
+			return
+		}
+
+		header, body, err := wire.ReadMessage(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, wire.ErrZeroRead):
+				l.DebugContext(ctx, "Connection closed by client")
+			case ctx.Err() != nil:
+				l.DebugContext(ctx, "Connection closed by server")
+			default:
+				l.DebugContext(ctx, "Failed to read message", slog.String("error", err.Error()))
+			}
+
+			return
+		}
+
+		l.DebugContext(ctx, "Request", slog.Any("header", header), slog.Any("body", body))
+
+		var resHeader *wire.MsgHeader
+		var resBody wire.MsgBody
+
+		if resHeader, resBody, err = s.handle(hCtx, header, body); err != nil {
+			l.DebugContext(ctx, "Failed to handle message", slog.String("error", err.Error()))
+			return
+		}
+
+		if resBody == nil {
+			continue
+		}
+
+		l.DebugContext(ctx, "Response", slog.Any("header", resHeader), slog.Any("body", resBody))
+
+		if err = wire.WriteMessage(w, resHeader, resBody); err == nil {
+			err = w.Flush()
+		}
+
+		if err != nil {
+			l.DebugContext(ctx, "Failed to write message", slog.String("error", err.Error()))
+			return
+		}
+	}
+}
+
+// handle calls the handler for the request and returns the response.
+//
+// It returns nil response without error if no response should be sent.
+// Returned error means that the connection should be closed.
+func (s *Server) handle(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+	var resBody wire.MsgBody
+
+	switch body := body.(type) {
+	case *wire.OpMsg:
+		res := s.call(ctx, body)
+
+		if body.Flags.FlagSet(wire.OpMsgMoreToCome) {
+			return nil, nil, nil
+		}
+
+		resBody = res
+
+	case *wire.OpQuery:
+		req, err := queryToMsg(body)
+		if err != nil {
+			return nil, nil, lazyerrors.Error(err)
+		}
+
+		res := s.call(ctx, req)
+
+		doc, err := res.Section0()
+		if err != nil {
+			return nil, nil, lazyerrors.Error(err)
+		}
+
+		if resBody, err = wire.NewOpReply(doc); err != nil {
+			return nil, nil, lazyerrors.Error(err)
+		}
+
+	default:
+		return nil, nil, lazyerrors.Errorf("unsupported request opcode %s", header.OpCode)
+	}
+
+	resHeader := &wire.MsgHeader{
+		MessageLength: int32(resBody.Size() + wire.MsgHeaderLen),
+		RequestID:     s.lastRequestID.Add(1),
+		ResponseTo:    header.RequestID,
+	}
+
+	switch resBody.(type) {
+	case *wire.OpMsg:
+		resHeader.OpCode = wire.OpCodeMsg
+	case *wire.OpReply:
+		resHeader.OpCode = wire.OpCodeReply
+	}
+
+	return resHeader, resBody, nil
+}
+
+// call calls the handler and converts errors to replies.
+func (s *Server) call(ctx context.Context, req *wire.OpMsg) *wire.OpMsg {
+	res, err := s.h.Handle(ctx, req)
+
+	switch {
+	case err != nil:
+		return ErrorReply(err)
+	case res == nil:
+		return ErrorReply(errors.New("handler returned nil response"))
+	default:
+		return res
+	}
+}
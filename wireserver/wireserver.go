@@ -0,0 +1,141 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wireserver provides low-level wire protocol server.
+package wireserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/internal/util/lazyerrors"
+	"github.com/FerretDB/wire/wirebson"
+)
+
+// Handler handles a single command.
+//
+// The request is an OP_MSG message; legacy OP_QUERY commands are converted to it by [Server].
+// Returned error is sent to the client as a command error; see [ErrorReply].
+//
+// Handlers may be called concurrently for different connections.
+// They must not retain the request after returning.
+type Handler interface {
+	Handle(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error)
+}
+
+// HandlerFunc is an adapter to use ordinary functions as [Handler].
+type HandlerFunc func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error)
+
+// Handle implements [Handler].
+func (f HandlerFunc) Handle(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+	return f(ctx, req)
+}
+
+// Error codes used by this package.
+const (
+	CodeInternalError   = int32(1)  // InternalError
+	CodeCommandNotFound = int32(59) // CommandNotFound
+)
+
+// Error represents a command error that is sent to the client.
+type Error struct {
+	Message string
+	Name    string // code name
+	Code    int32
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Name, e.Code, e.Message)
+}
+
+// ErrorReply returns an OP_MSG reply document `{ok: 0, errmsg, code, codeName}` for the given error.
+//
+// If the error is not (and does not wrap) [*Error], InternalError code is used.
+func ErrorReply(err error) *wire.OpMsg {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{
+			Message: err.Error(),
+			Name:    "InternalError",
+			Code:    CodeInternalError,
+		}
+	}
+
+	return wire.MustOpMsg(
+		"ok", float64(0),
+		"errmsg", e.Message,
+		"code", e.Code,
+		"codeName", e.Name,
+	)
+}
+
+// command returns the command name of the request.
+func command(req *wire.OpMsg) (string, error) {
+	doc, err := req.Section0()
+	if err != nil {
+		return "", lazyerrors.Error(err)
+	}
+
+	return doc.Command(), nil
+}
+
+// queryToMsg converts legacy OP_QUERY command to OP_MSG.
+func queryToMsg(query *wire.OpQuery) (*wire.OpMsg, error) {
+	doc, err := query.Query()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	// commands with read preference are wrapped
+	for _, wrapper := range []string{"$query", "query"} {
+		if doc.Command() != wrapper {
+			continue
+		}
+
+		if v, ok := doc.Get(wrapper).(wirebson.AnyDocument); ok {
+			if doc, err = v.Decode(); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+		}
+
+		break
+	}
+
+	if doc.Get("$db") == nil {
+		// full collection name is like `db.$cmd`
+		db, _, _ := strings.Cut(query.FullCollectionName, ".")
+
+		doc = doc.Copy()
+		if err = doc.Add("$db", db); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	msg, err := wire.NewOpMsg(doc)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return msg, nil
+}
+
+// check interfaces
+var (
+	_ Handler = HandlerFunc(nil)
+	_ error   = (*Error)(nil)
+)
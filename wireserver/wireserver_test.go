@@ -0,0 +1,261 @@
+// Copyright 2021 FerretDB Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/FerretDB/wire"
+	"github.com/FerretDB/wire/wirebson"
+	"github.com/FerretDB/wire/wireclient"
+)
+
+// setup starts a server with the given handler and returns its address.
+// The server is stopped when the test ends.
+func setup(t *testing.T, h Handler) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	s := New(&ServerOpts{
+		Handler: h,
+	})
+
+	go func() {
+		done <- s.Serve(ctx, l)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	return l.Addr().String()
+}
+
+// dial connects to the server.
+func dial(t *testing.T, addr string) *wireclient.Conn {
+	t.Helper()
+
+	nc, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+
+	conn := wireclient.New(nc, slog.New(slog.DiscardHandler))
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+// request sends OP_MSG request and returns response document.
+func request(t *testing.T, conn *wireclient.Conn, req *wire.OpMsg) *wirebson.Document {
+	t.Helper()
+
+	_, body, err := conn.Request(t.Context(), req)
+	require.NoError(t, err)
+
+	doc, err := body.(*wire.OpMsg).DocumentDeep()
+	require.NoError(t, err)
+
+	return doc
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	mux := NewMux()
+
+	mux.RegisterFunc("ping", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	mux.RegisterFunc("whoami", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		ci := ConnInfoFromContext(ctx)
+		return wire.MustOpMsg("conn", ci.ID, "ok", float64(1)), nil
+	})
+
+	mux.RegisterFunc("fail", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return nil, &Error{Message: "failed", Name: "BadValue", Code: 2}
+	})
+
+	mux.RegisterFunc("internal", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return nil, errors.New("boom")
+	})
+
+	addr := setup(t, mux)
+	conn := dial(t, addr)
+
+	t.Run("Ping", func(t *testing.T) {
+		doc := request(t, conn, wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+		assert.Equal(t, float64(1), doc.Get("ok"))
+	})
+
+	t.Run("ConnInfo", func(t *testing.T) {
+		doc := request(t, conn, wire.MustOpMsg("whoami", int32(1), "$db", "admin"))
+		id := doc.Get("conn")
+
+		doc = request(t, dial(t, addr), wire.MustOpMsg("whoami", int32(1), "$db", "admin"))
+		assert.NotEqual(t, id, doc.Get("conn"))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		doc := request(t, conn, wire.MustOpMsg("fail", int32(1), "$db", "admin"))
+		expected := wirebson.MustDocument("ok", float64(0), "errmsg", "failed", "code", int32(2), "codeName", "BadValue")
+		assert.Equal(t, expected, doc)
+	})
+
+	t.Run("InternalError", func(t *testing.T) {
+		doc := request(t, conn, wire.MustOpMsg("internal", int32(1), "$db", "admin"))
+		expected := wirebson.MustDocument("ok", float64(0), "errmsg", "boom", "code", int32(1), "codeName", "InternalError")
+		assert.Equal(t, expected, doc)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		doc := request(t, conn, wire.MustOpMsg("unknown", int32(1), "$db", "admin"))
+		assert.Equal(t, int32(59), doc.Get("code"))
+		assert.Equal(t, "no such command: 'unknown'", doc.Get("errmsg"))
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		query := wire.MustOpQuery("$query", wirebson.MustDocument("ping", int32(1)))
+		query.FullCollectionName = "admin.$cmd"
+		query.NumberToReturn = -1
+
+		header, body, err := conn.Request(t.Context(), query)
+		require.NoError(t, err)
+		assert.Equal(t, wire.OpCodeReply, header.OpCode)
+
+		doc, err := body.(*wire.OpReply).DocumentDeep()
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), doc.Get("ok"))
+	})
+}
+
+func TestServerShutdown(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+
+	h := HandlerFunc(func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		close(started)
+		<-finish
+
+		return wire.MustOpMsg("ok", float64(1), "canceled", ctx.Err() != nil), nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error)
+
+	go func() {
+		done <- New(&ServerOpts{Handler: h}).Serve(ctx, l)
+	}()
+
+	conn := dial(t, l.Addr().String())
+
+	res := make(chan *wirebson.Document)
+
+	go func() {
+		_, body, reqErr := conn.Request(t.Context(), wire.MustOpMsg("slow", int32(1), "$db", "admin"))
+		if !assert.NoError(t, reqErr) {
+			close(res)
+			return
+		}
+
+		doc, docErr := body.(*wire.OpMsg).DocumentDeep()
+		assert.NoError(t, docErr)
+		res <- doc
+	}()
+
+	<-started
+	cancel()
+
+	// in-flight request is finished
+	close(finish)
+
+	doc := <-res
+	require.NotNil(t, doc)
+	assert.Equal(t, wirebson.MustDocument("ok", float64(1), "canceled", false), doc)
+
+	require.NoError(t, <-done)
+
+	// connection is closed after that
+	_, _, err = conn.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	require.Error(t, err)
+}
+
+// failingListener is a listener that fails to accept after the first connection
+// when fail channel is closed.
+type failingListener struct {
+	net.Listener
+	fail     chan struct{}
+	accepted bool
+}
+
+// Accept implements [net.Listener].
+func (l *failingListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return l.Listener.Accept()
+	}
+
+	<-l.fail
+
+	return nil, errors.New("accept failed")
+}
+
+func TestServerAcceptError(t *testing.T) {
+	t.Parallel()
+
+	mux := NewMux()
+
+	mux.RegisterFunc("ping", func(ctx context.Context, req *wire.OpMsg) (*wire.OpMsg, error) {
+		return wire.MustOpMsg("ok", float64(1)), nil
+	})
+
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	l := &failingListener{Listener: nl, fail: make(chan struct{})}
+	done := make(chan error)
+
+	go func() {
+		done <- New(&ServerOpts{Handler: mux}).Serve(t.Context(), l)
+	}()
+
+	conn := dial(t, nl.Addr().String())
+	request(t, conn, wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+
+	close(l.fail)
+
+	// Serve returns without waiting for the client to disconnect
+	require.ErrorContains(t, <-done, "accept failed")
+
+	_, _, err = conn.Request(t.Context(), wire.MustOpMsg("ping", int32(1), "$db", "admin"))
+	require.Error(t, err)
+}
@@ -19,10 +19,10 @@ import (
 	"fmt"
 	"testing"
 
-	"github.com/pmezard/go-difflib/difflib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/FerretDB/wire/internal/util/bsondiff"
 	"github.com/FerretDB/wire/wirebson"
 )
 
@@ -34,13 +34,7 @@ func diff(tb testing.TB, expected, actual any) (expectedS, actualS, diff string)
 	actualS = wirebson.LogMessageIndent(actual)
 
 	var err error
-	diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
-		A:        difflib.SplitLines(expectedS),
-		FromFile: "expected",
-		B:        difflib.SplitLines(actualS),
-		ToFile:   "actual",
-		Context:  1,
-	})
+	diff, err = bsondiff.Unified(expectedS, actualS)
 	require.NoError(tb, err)
 
 	return
@@ -64,13 +58,7 @@ func diffSlices[T any](tb testing.TB, expected, actual []T) (expectedS, actualS,
 	actualS = wirebson.LogMessageIndent(actualA)
 
 	var err error
-	diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
-		A:        difflib.SplitLines(expectedS),
-		FromFile: "expected",
-		B:        difflib.SplitLines(actualS),
-		ToFile:   "actual",
-		Context:  1,
-	})
+	diff, err = bsondiff.Unified(expectedS, actualS)
 	require.NoError(tb, err)
 
 	return